@@ -0,0 +1,380 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// Built-in packet capture, modeled on Tailscale wgengine's capture package:
+// a tun.Device shim fans out every Read/Write payload to registered sinks,
+// each of which streams a pcapng capture an operator can hand straight to
+// `tcpdump -r -` or Wireshark without the bridge process writing anything
+// to disk. See StartCapture/StopCapture.
+
+const (
+	pcapngByteOrderMagic    = 0x1A2B3C4D
+	blockTypeSectionHeader  = 0x0A0D0D0A
+	blockTypeInterfaceDesc  = 0x00000001
+	blockTypeEnhancedPacket = 0x00000006
+
+	linkTypeRaw = 101 // LINKTYPE_RAW — no link-layer header, as tun.Device hands us
+
+	captureSinkBuffer = 256 // frames queued per sink before dropping
+)
+
+type captureDir uint8
+
+const (
+	captureIngress captureDir = iota // device -> host, tun.Device.Read
+	captureEgress                    // host -> device, tun.Device.Write
+)
+
+// capturedFrame is one packet queued for a sink's pcapng writer goroutine.
+type capturedFrame struct {
+	dir  captureDir
+	data []byte
+	ts   time.Time
+}
+
+// captureSink is one live StartCapture subscriber.
+type captureSink struct {
+	ch chan capturedFrame
+	pw *io.PipeWriter
+}
+
+// captureHub fans a single interface's traffic out to any number of
+// concurrent captureSinks. One hub exists per live tun.Device (primary or
+// multihop), registered when that device starts and torn down when it
+// stops.
+type captureHub struct {
+	mu      sync.Mutex
+	sinks   map[*captureSink]struct{}
+	dropped int64
+}
+
+func newCaptureHub() *captureHub {
+	return &captureHub{sinks: make(map[*captureSink]struct{})}
+}
+
+// addSink registers a new subscriber and returns the read end of its pcapng
+// stream. The writer goroutine started here exits once the caller closes
+// the returned ReadCloser, or the hub is torn down via closeAll.
+func (h *captureHub) addSink() io.ReadCloser {
+	pr, pw := io.Pipe()
+	sink := &captureSink{ch: make(chan capturedFrame, captureSinkBuffer), pw: pw}
+
+	h.mu.Lock()
+	h.sinks[sink] = struct{}{}
+	h.mu.Unlock()
+
+	go h.serve(sink)
+
+	return &captureReader{PipeReader: pr, hub: h, sink: sink}
+}
+
+// serve writes the pcapng preamble (section header + one interface
+// description per direction) and then streams an Enhanced Packet Block per
+// frame until sink.ch is closed or the reader hangs up.
+func (h *captureHub) serve(sink *captureSink) {
+	defer func() { _ = sink.pw.Close() }()
+
+	if _, err := sink.pw.Write(sectionHeaderBlock()); err != nil {
+		return
+	}
+	if _, err := sink.pw.Write(interfaceDescBlock("ingress")); err != nil {
+		return
+	}
+	if _, err := sink.pw.Write(interfaceDescBlock("egress")); err != nil {
+		return
+	}
+
+	for frame := range sink.ch {
+		if _, err := sink.pw.Write(enhancedPacketBlock(frame)); err != nil {
+			return
+		}
+	}
+}
+
+// remove unregisters sink, e.g. once its subscriber closes its reader.
+func (h *captureHub) remove(sink *captureSink) {
+	h.mu.Lock()
+	if _, ok := h.sinks[sink]; ok {
+		delete(h.sinks, sink)
+		close(sink.ch)
+	}
+	h.mu.Unlock()
+}
+
+// closeAll tears down every active sink on this hub, e.g. on StopCapture or
+// device shutdown.
+func (h *captureHub) closeAll() {
+	h.mu.Lock()
+	sinks := make([]*captureSink, 0, len(h.sinks))
+	for s := range h.sinks {
+		sinks = append(sinks, s)
+	}
+	h.sinks = make(map[*captureSink]struct{})
+	h.mu.Unlock()
+
+	for _, s := range sinks {
+		close(s.ch)
+	}
+}
+
+// fanOut queues data on every registered sink, dropping (and counting) on a
+// full channel instead of blocking the device's Read/Write path.
+func (h *captureHub) fanOut(dir captureDir, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.sinks) == 0 {
+		return
+	}
+	frame := capturedFrame{dir: dir, data: append([]byte(nil), data...), ts: time.Now()}
+	for sink := range h.sinks {
+		select {
+		case sink.ch <- frame:
+		default:
+			h.dropped++
+		}
+	}
+}
+
+func (h *captureHub) stat(ifname string) CaptureStat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return CaptureStat{Interface: ifname, Sinks: len(h.sinks), Dropped: h.dropped}
+}
+
+// captureReader is the io.ReadCloser handed back by StartCapture; Close
+// unregisters the sink from its hub so the serve goroutine exits.
+type captureReader struct {
+	*io.PipeReader
+	hub  *captureHub
+	sink *captureSink
+}
+
+func (r *captureReader) Close() error {
+	r.hub.remove(r.sink)
+	return r.PipeReader.Close()
+}
+
+// captureTap wraps a tun.Device so every packet that crosses Read or Write
+// is fanned out to hub's sinks, without the device or the lazy-peer
+// hydration path needing to know capture exists.
+type captureTap struct {
+	tun.Device
+	hub *captureHub
+}
+
+func (c *captureTap) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n, err := c.Device.Read(bufs, sizes, offset)
+	for i := 0; i < n; i++ {
+		c.hub.fanOut(captureIngress, bufs[i][offset:offset+sizes[i]])
+	}
+	return n, err
+}
+
+func (c *captureTap) Write(bufs [][]byte, offset int) (int, error) {
+	for _, b := range bufs {
+		c.hub.fanOut(captureEgress, b[offset:])
+	}
+	return c.Device.Write(bufs, offset)
+}
+
+// --- registry: one hub per live tun.Device, keyed by interface name ---
+
+var (
+	captureRegistry   = make(map[string]*captureHub)
+	captureRegistryMu sync.Mutex
+)
+
+// registerCaptureHub returns ifname's hub, creating it if this is its
+// device's first Start. Called from State.Start and startMultihopDevice.
+func registerCaptureHub(ifname string) *captureHub {
+	captureRegistryMu.Lock()
+	defer captureRegistryMu.Unlock()
+	h, ok := captureRegistry[ifname]
+	if !ok {
+		h = newCaptureHub()
+		captureRegistry[ifname] = h
+	}
+	return h
+}
+
+// unregisterCaptureHub closes out every subscriber on ifname's hub and
+// drops it from the registry. Called when that interface's device stops.
+func unregisterCaptureHub(ifname string) {
+	captureRegistryMu.Lock()
+	h, ok := captureRegistry[ifname]
+	delete(captureRegistry, ifname)
+	captureRegistryMu.Unlock()
+	if ok {
+		h.closeAll()
+	}
+}
+
+// CaptureStat is one interface's live packet-capture accounting, surfaced
+// by State.GetStatus.
+type CaptureStat struct {
+	Interface string `json:"interface"`
+	Sinks     int    `json:"sinks"`
+	Dropped   int64  `json:"dropped"`
+}
+
+// captureStats snapshots every currently-registered hub, for GetStatus.
+func captureStats() []CaptureStat {
+	captureRegistryMu.Lock()
+	defer captureRegistryMu.Unlock()
+	if len(captureRegistry) == 0 {
+		return nil
+	}
+	stats := make([]CaptureStat, 0, len(captureRegistry))
+	for ifname, h := range captureRegistry {
+		stats = append(stats, h.stat(ifname))
+	}
+	return stats
+}
+
+// StartCapture begins a live pcap stream for ifname — the primary device's
+// own ifname, or any running multihop tunnel's interface name. The
+// returned ReadCloser yields a pcapng stream (an Enhanced Packet Block per
+// frame, one Interface Description Block per direction) suitable for
+// `tcpdump -r -` or Wireshark; closing it ends only that subscription.
+func (s *State) StartCapture(ifname string) (io.ReadCloser, error) {
+	captureRegistryMu.Lock()
+	h, ok := captureRegistry[ifname]
+	captureRegistryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no live capture source for interface %q", ifname)
+	}
+	return h.addSink(), nil
+}
+
+// StopCapture ends every live capture subscription on ifname without
+// affecting the interface itself — e.g. an operator killing a forgotten
+// debug session rather than each subscriber closing its own pipe.
+func (s *State) StopCapture(ifname string) {
+	captureRegistryMu.Lock()
+	h, ok := captureRegistry[ifname]
+	captureRegistryMu.Unlock()
+	if ok {
+		h.closeAll()
+	}
+}
+
+// --- minimal pcapng block encoding ---
+//
+// Only what StartCapture needs: a Section Header Block, two Interface
+// Description Blocks (ingress/egress, both LINKTYPE_RAW), and an Enhanced
+// Packet Block per frame with a microsecond timestamp. All fields are
+// little-endian, matching the byte-order magic written below.
+
+func blockPad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+func wrapBlock(blockType uint32, body []byte) []byte {
+	totalLen := uint32(8 + len(body) + 4)
+	out := make([]byte, 0, totalLen)
+	var u32 [4]byte
+	binary.LittleEndian.PutUint32(u32[:], blockType)
+	out = append(out, u32[:]...)
+	binary.LittleEndian.PutUint32(u32[:], totalLen)
+	out = append(out, u32[:]...)
+	out = append(out, body...)
+	binary.LittleEndian.PutUint32(u32[:], totalLen)
+	out = append(out, u32[:]...)
+	return out
+}
+
+func sectionHeaderBlock() []byte {
+	var body []byte
+	var u16 [2]byte
+	var u32 [4]byte
+
+	binary.LittleEndian.PutUint32(u32[:], pcapngByteOrderMagic)
+	body = append(body, u32[:]...)
+	binary.LittleEndian.PutUint16(u16[:], 1) // major version
+	body = append(body, u16[:]...)
+	binary.LittleEndian.PutUint16(u16[:], 0) // minor version
+	body = append(body, u16[:]...)
+
+	sectionLen := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sectionLen, ^uint64(0)) // unspecified
+	body = append(body, sectionLen...)
+
+	return wrapBlock(blockTypeSectionHeader, body)
+}
+
+func interfaceDescBlock(name string) []byte {
+	var body []byte
+	var u16 [2]byte
+	var u32 [4]byte
+
+	binary.LittleEndian.PutUint16(u16[:], linkTypeRaw)
+	body = append(body, u16[:]...)
+	binary.LittleEndian.PutUint16(u16[:], 0) // reserved
+	body = append(body, u16[:]...)
+	binary.LittleEndian.PutUint32(u32[:], 0) // snaplen: no limit
+	body = append(body, u32[:]...)
+	body = append(body, ifNameOption(name)...)
+
+	return wrapBlock(blockTypeInterfaceDesc, body)
+}
+
+// ifNameOption builds the if_name (code 2) option TLV plus the terminating
+// opt_endofopt, the minimum an Interface Description Block needs for
+// Wireshark to label ingress vs. egress.
+func ifNameOption(name string) []byte {
+	const optIfName = 2
+	val := []byte(name)
+	pad := blockPad4(len(val))
+
+	var opt []byte
+	var u16 [2]byte
+	binary.LittleEndian.PutUint16(u16[:], optIfName)
+	opt = append(opt, u16[:]...)
+	binary.LittleEndian.PutUint16(u16[:], uint16(len(val)))
+	opt = append(opt, u16[:]...)
+	opt = append(opt, val...)
+	opt = append(opt, make([]byte, pad)...)
+
+	binary.LittleEndian.PutUint16(u16[:], 0) // opt_endofopt code
+	opt = append(opt, u16[:]...)
+	binary.LittleEndian.PutUint16(u16[:], 0) // opt_endofopt length
+	opt = append(opt, u16[:]...)
+	return opt
+}
+
+func enhancedPacketBlock(frame capturedFrame) []byte {
+	var ifaceID uint32
+	if frame.dir == captureEgress {
+		ifaceID = 1
+	}
+	micros := uint64(frame.ts.UnixMicro())
+	pktLen := uint32(len(frame.data))
+	pad := blockPad4(len(frame.data))
+
+	var body []byte
+	var u32 [4]byte
+
+	binary.LittleEndian.PutUint32(u32[:], ifaceID)
+	body = append(body, u32[:]...)
+	binary.LittleEndian.PutUint32(u32[:], uint32(micros>>32))
+	body = append(body, u32[:]...)
+	binary.LittleEndian.PutUint32(u32[:], uint32(micros))
+	body = append(body, u32[:]...)
+	binary.LittleEndian.PutUint32(u32[:], pktLen) // captured len
+	body = append(body, u32[:]...)
+	binary.LittleEndian.PutUint32(u32[:], pktLen) // original len, never truncated here
+	body = append(body, u32[:]...)
+	body = append(body, frame.data...)
+	body = append(body, make([]byte, pad)...)
+
+	return wrapBlock(blockTypeEnhancedPacket, body)
+}
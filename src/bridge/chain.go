@@ -0,0 +1,123 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"wireguard-go-bridge/multihop"
+)
+
+// chainRegistry holds every multihop.Manager this process has brought up via
+// ChainUp, keyed by a handle the caller uses for ChainStatus/ChainDown — the
+// same handle-based shape the package-main FFI layer's other registries use,
+// kept here instead of there since a Manager's lifecycle is owned by
+// bridge.State, not by the C layer.
+var (
+	chainRegistry   = make(map[int64]*multihop.Manager)
+	chainRegistryMu sync.Mutex
+	chainSeq        int64
+)
+
+// ChainUp unmarshals chainJSON into a multihop.Chain, brings it up via
+// multihop.Up, and persists the resulting chain (with its auto-allocated
+// fwmarks and keys filled in) to BridgeDB so restoreActiveChain can bring it
+// back after a restart. It returns a handle for ChainStatus/ChainDown.
+func (s *State) ChainUp(chainJSON string) (int64, error) {
+	var chain multihop.Chain
+	if err := json.Unmarshal([]byte(chainJSON), &chain); err != nil {
+		return 0, fmt.Errorf("unmarshal chain: %w", err)
+	}
+
+	mgr, err := multihop.Up(chain)
+	if err != nil {
+		return 0, fmt.Errorf("chain up: %w", err)
+	}
+
+	s.mu.RLock()
+	db := s.db
+	s.mu.RUnlock()
+	if db != nil {
+		if persisted, err := json.Marshal(mgr.Chain()); err == nil {
+			_ = db.SaveActiveChain(string(persisted), time.Now().Unix())
+		}
+	}
+
+	chainRegistryMu.Lock()
+	chainSeq++
+	handle := chainSeq
+	chainRegistry[handle] = mgr
+	chainRegistryMu.Unlock()
+
+	return handle, nil
+}
+
+// ChainDown tears down the chain registered under handle and clears it from
+// BridgeDB so a later restart doesn't try to bring it back.
+func (s *State) ChainDown(handle int64) error {
+	chainRegistryMu.Lock()
+	mgr, ok := chainRegistry[handle]
+	if ok {
+		delete(chainRegistry, handle)
+	}
+	chainRegistryMu.Unlock()
+	if !ok {
+		return fmt.Errorf("chain handle %d not found", handle)
+	}
+
+	mgr.Down()
+
+	s.mu.RLock()
+	db := s.db
+	s.mu.RUnlock()
+	if db != nil {
+		_ = db.ClearActiveChain()
+	}
+	return nil
+}
+
+// ChainStatus returns the chain registered under handle's per-hop status,
+// marshaled to JSON for the C layer, matching how ListMultihopTunnels and
+// GetMultihopTunnel return JSON rather than Go structs.
+func (s *State) ChainStatus(handle int64) (string, error) {
+	chainRegistryMu.Lock()
+	mgr, ok := chainRegistry[handle]
+	chainRegistryMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("chain handle %d not found", handle)
+	}
+
+	out, err := json.Marshal(mgr.Status())
+	if err != nil {
+		return "", fmt.Errorf("marshal chain status: %w", err)
+	}
+	return string(out), nil
+}
+
+// restoreActiveChain brings back whatever chain was active when the process
+// last called ChainUp, the same crash-recovery role restoreMultihopTunnels
+// plays for bridge.State's own tunnels. Called from Start with s.mu already
+// held, so it touches s.db directly rather than through ChainUp (which takes
+// s.mu.RLock itself).
+func (s *State) restoreActiveChain() {
+	chainJSON, err := s.db.GetActiveChain()
+	if err != nil || chainJSON == "" {
+		return
+	}
+
+	var chain multihop.Chain
+	if err := json.Unmarshal([]byte(chainJSON), &chain); err != nil {
+		return
+	}
+
+	mgr, err := multihop.Up(chain)
+	if err != nil {
+		return
+	}
+
+	chainRegistryMu.Lock()
+	chainSeq++
+	chainRegistry[chainSeq] = mgr
+	chainRegistryMu.Unlock()
+}
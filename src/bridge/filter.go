@@ -0,0 +1,451 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+
+	"wireguard-go-bridge/db"
+)
+
+// Stateful per-peer packet filter, modeled on Tailscale wgengine's
+// filter package: rules loaded from db.PeerACL (see State.SetPeerACL) are
+// evaluated against every packet crossing the primary or a multihop
+// tun.Device, classified to its owning peer via the same allowed-IP trie
+// lazyTUN's hydration path uses. A small conntrack table auto-allows
+// return traffic for flows an "out" packet already had accepted, so an
+// operator only has to write a rule for the direction traffic
+// originates in. A peer with no rules at all is unrestricted — default
+// policy is allow-all, matching the pre-filter AllowedIPs=0.0.0.0/0
+// behavior.
+
+// connTrackTTL is how long an accepted flow's reverse leg stays
+// auto-allowed after Decide last refreshed it.
+const connTrackTTL = 5 * time.Minute
+
+// aclStatsFlushInterval is how often Filter flushes its in-memory
+// accept/drop counters to bridge-db and publishes EventACLDrop for any
+// peer whose dropped count grew, mirroring StatsSyncer's own
+// tick-then-batch-write shape.
+const aclStatsFlushInterval = 15 * time.Second
+
+// flowKey identifies one tracked 5-tuple without regard to direction: the
+// two endpoints are stored in a canonical (sorted) order, so the same key
+// is computed whether Decide sees this flow's outbound or return leg.
+type flowKey struct {
+	proto        db.ACLProto
+	ipA, ipB     string
+	portA, portB uint16
+}
+
+func newFlowKey(proto db.ACLProto, ip1 net.IP, port1 uint16, ip2 net.IP, port2 uint16) flowKey {
+	s1, s2 := ip1.String(), ip2.String()
+	if s1 > s2 || (s1 == s2 && port1 > port2) {
+		s1, s2, port1, port2 = s2, s1, port2, port1
+	}
+	return flowKey{proto: proto, ipA: s1, portA: port1, ipB: s2, portB: port2}
+}
+
+// peerCounters holds one peer's not-yet-flushed accept/drop deltas.
+type peerCounters struct {
+	accepted int64
+	dropped  int64
+}
+
+// Filter is the stateful ACL enforcement point filterTap consults. One
+// Filter is shared by the primary device and every multihop tunnel's
+// device, since rules are keyed by peer, not by interface.
+type Filter struct {
+	db      *db.BridgeDB
+	publish func(db.PeerEvent)
+
+	rulesMu sync.RWMutex
+	rules   map[string][]db.PeerACL // by owning peer's public key
+
+	trackMu sync.Mutex
+	track   map[flowKey]time.Time
+
+	countersMu sync.Mutex
+	counters   map[string]*peerCounters
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFilter loads the current rule set from bdb and starts the periodic
+// counter flusher. publish, if non-nil, is called with an EventACLDrop
+// PeerEvent whenever a peer's dropped count grows — State wires this to
+// its StatsSyncer's Publish method so ACL drops ride the same subscriber
+// fan-out as handshake/endpoint/quota events.
+func NewFilter(bdb *db.BridgeDB, publish func(db.PeerEvent)) *Filter {
+	f := &Filter{
+		db:       bdb,
+		publish:  publish,
+		rules:    make(map[string][]db.PeerACL),
+		track:    make(map[flowKey]time.Time),
+		counters: make(map[string]*peerCounters),
+		stop:     make(chan struct{}),
+	}
+	f.ReloadAll()
+	f.wg.Add(1)
+	go f.flushLoop()
+	return f
+}
+
+// ReloadAll refreshes the whole rule cache from bridge-db. Best-effort: a
+// query failure leaves the previous cache in place.
+func (f *Filter) ReloadAll() {
+	rules, err := f.db.ListAllPeerACLs()
+	if err != nil {
+		return
+	}
+	f.rulesMu.Lock()
+	f.rules = rules
+	f.rulesMu.Unlock()
+}
+
+// Reload replaces pubKey's cached rules, e.g. right after State.SetPeerACL
+// writes them to bridge-db, so the change takes effect without waiting
+// for the next ReloadAll.
+func (f *Filter) Reload(pubKey string, rules []db.PeerACL) {
+	f.rulesMu.Lock()
+	defer f.rulesMu.Unlock()
+	if len(rules) == 0 {
+		delete(f.rules, pubKey)
+		return
+	}
+	f.rules[pubKey] = rules
+}
+
+// Close stops the counter flusher, flushing one last time first.
+func (f *Filter) Close() {
+	close(f.stop)
+	f.wg.Wait()
+}
+
+func (f *Filter) flushLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(aclStatsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.flush()
+		case <-f.stop:
+			f.flush()
+			return
+		}
+	}
+}
+
+// flush writes every peer's accumulated counters to bridge-db and
+// publishes an EventACLDrop for any peer whose dropped count grew.
+func (f *Filter) flush() {
+	f.countersMu.Lock()
+	pending := f.counters
+	f.counters = make(map[string]*peerCounters)
+	f.countersMu.Unlock()
+
+	for pubKey, c := range pending {
+		ev, err := f.db.UpdateACLCounters(pubKey, c.accepted, c.dropped)
+		if err == nil && ev != nil && f.publish != nil {
+			f.publish(*ev)
+		}
+	}
+}
+
+// record accumulates one packet's verdict for pubKey's next flush.
+func (f *Filter) record(pubKey string, allowed bool) {
+	f.countersMu.Lock()
+	defer f.countersMu.Unlock()
+	c, ok := f.counters[pubKey]
+	if !ok {
+		c = &peerCounters{}
+		f.counters[pubKey] = c
+	}
+	if allowed {
+		c.accepted++
+	} else {
+		c.dropped++
+	}
+}
+
+// Decide classifies pkt (a raw IPv4/IPv6 packet, no link-layer header, as
+// tun.Device hands them) against peer's rules for dir and reports whether
+// it should pass, updating peer's accept/drop counters either way.
+func (f *Filter) Decide(dir db.ACLDirection, pkt []byte, peer *db.ClientRecord) bool {
+	meta, ok := parsePacketMeta(pkt)
+	if !ok {
+		// Unparseable payload (too short, not IPv4/IPv6): fail open, the
+		// same choice packetDstIP's callers make for anything it can't
+		// classify.
+		return true
+	}
+
+	if f.trackedAllow(dir, meta) {
+		f.record(peer.PublicKey, true)
+		return true
+	}
+
+	f.rulesMu.RLock()
+	rules := f.rules[peer.PublicKey]
+	f.rulesMu.RUnlock()
+
+	allow := true // default policy: allow-all for a peer with no rules
+	if len(rules) > 0 {
+		allow = false // once a peer has rules, unmatched traffic is denied
+		for _, rule := range rules {
+			if ruleMatches(rule, dir, meta) {
+				allow = rule.Action == db.ACLAllow
+				break
+			}
+		}
+	}
+
+	if allow && meta.proto != db.ACLProtoICMP {
+		f.trackMu.Lock()
+		f.track[meta.key] = time.Now().Add(connTrackTTL)
+		f.trackMu.Unlock()
+	}
+
+	f.record(peer.PublicKey, allow)
+	return allow
+}
+
+// trackedAllow reports whether meta's flow already has a live conntrack
+// entry recorded by an earlier "out" packet, auto-allowing its "in"
+// return traffic without re-evaluating rules.
+func (f *Filter) trackedAllow(dir db.ACLDirection, meta packetMeta) bool {
+	if dir != db.ACLIn || meta.proto == db.ACLProtoICMP {
+		return false
+	}
+	f.trackMu.Lock()
+	defer f.trackMu.Unlock()
+	expiry, ok := f.track[meta.key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(f.track, meta.key)
+		return false
+	}
+	return true
+}
+
+// ruleMatches reports whether rule applies to meta in dir. Src/Dst CIDRs
+// match the packet's literal source/destination, not peer-relative ones —
+// direction only selects which of a peer's two traffic legs the rule is
+// for, the same split tun.Device's own Read (ACLOut, host->peer) and
+// Write (ACLIn, peer->host) give us. Port ranges are checked against the
+// destination port, the conventional "which service" firewalls match on.
+func ruleMatches(rule db.PeerACL, dir db.ACLDirection, meta packetMeta) bool {
+	if rule.Direction != dir {
+		return false
+	}
+	if rule.Proto != db.ACLProtoAny && rule.Proto != meta.proto {
+		return false
+	}
+	if !cidrContainsOrAny(rule.SrcCIDR, meta.srcIP) {
+		return false
+	}
+	if !cidrContainsOrAny(rule.DstCIDR, meta.dstIP) {
+		return false
+	}
+	if meta.proto == db.ACLProtoTCP || meta.proto == db.ACLProtoUDP {
+		if !portInRange(rule, meta.dstPort) {
+			return false
+		}
+	}
+	return true
+}
+
+func cidrContainsOrAny(cidr string, ip net.IP) bool {
+	if cidr == "" {
+		return true
+	}
+	_, prefix, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(ip)
+}
+
+func portInRange(rule db.PeerACL, port uint16) bool {
+	if rule.PortLow == 0 && rule.PortHigh == 0 {
+		return true
+	}
+	high := rule.PortHigh
+	if high == 0 {
+		high = rule.PortLow
+	}
+	return int(port) >= rule.PortLow && int(port) <= high
+}
+
+// --- header parsing ---
+//
+// Just enough of IPv4/IPv6 + TCP/UDP/ICMP to classify a packet for rule
+// matching: source/destination address, transport protocol, and ports
+// where the protocol has them. IPv4 options are skipped using the header's
+// IHL field. IPv6 extension headers are not walked: a packet carrying one
+// is classified by its first Next Header value, which matches no transport
+// protocol, so it evaluates as ACLProtoAny with port 0.
+
+const (
+	ipProtoICMP   = 1
+	ipProtoTCP    = 6
+	ipProtoUDP    = 17
+	ipProtoICMPv6 = 58
+)
+
+// packetMeta is what ruleMatches and the conntrack table need from one
+// packet, extracted once by parsePacketMeta.
+type packetMeta struct {
+	proto            db.ACLProto
+	srcIP, dstIP     net.IP
+	srcPort, dstPort uint16
+	key              flowKey
+}
+
+func parsePacketMeta(pkt []byte) (packetMeta, bool) {
+	if len(pkt) < 1 {
+		return packetMeta{}, false
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		return parseIPv4Meta(pkt)
+	case 6:
+		return parseIPv6Meta(pkt)
+	default:
+		return packetMeta{}, false
+	}
+}
+
+func parseIPv4Meta(pkt []byte) (packetMeta, bool) {
+	if len(pkt) < 20 {
+		return packetMeta{}, false
+	}
+	ihl := int(pkt[0]&0x0f) * 4
+	if ihl < 20 || len(pkt) < ihl {
+		return packetMeta{}, false
+	}
+	meta := packetMeta{srcIP: net.IP(pkt[12:16]), dstIP: net.IP(pkt[16:20])}
+	fillTransport(&meta, pkt[9], pkt[ihl:])
+	meta.key = newFlowKey(meta.proto, meta.srcIP, meta.srcPort, meta.dstIP, meta.dstPort)
+	return meta, true
+}
+
+func parseIPv6Meta(pkt []byte) (packetMeta, bool) {
+	if len(pkt) < 40 {
+		return packetMeta{}, false
+	}
+	meta := packetMeta{srcIP: net.IP(pkt[8:24]), dstIP: net.IP(pkt[24:40])}
+	fillTransport(&meta, pkt[6], pkt[40:])
+	meta.key = newFlowKey(meta.proto, meta.srcIP, meta.srcPort, meta.dstIP, meta.dstPort)
+	return meta, true
+}
+
+func fillTransport(meta *packetMeta, ipProto byte, payload []byte) {
+	switch ipProto {
+	case ipProtoTCP, ipProtoUDP:
+		if ipProto == ipProtoTCP {
+			meta.proto = db.ACLProtoTCP
+		} else {
+			meta.proto = db.ACLProtoUDP
+		}
+		if len(payload) >= 4 {
+			meta.srcPort = binary.BigEndian.Uint16(payload[0:2])
+			meta.dstPort = binary.BigEndian.Uint16(payload[2:4])
+		}
+	case ipProtoICMP, ipProtoICMPv6:
+		meta.proto = db.ACLProtoICMP
+	default:
+		meta.proto = db.ACLProtoAny
+	}
+}
+
+// packetSrcIP extracts the source address from a raw IPv4 or IPv6 packet
+// (no link-layer header), the ACLIn-direction counterpart of lazy_peers.go's
+// packetDstIP.
+func packetSrcIP(pkt []byte) net.IP {
+	if len(pkt) < 1 {
+		return nil
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) < 20 {
+			return nil
+		}
+		return net.IP(pkt[12:16])
+	case 6:
+		if len(pkt) < 40 {
+			return nil
+		}
+		return net.IP(pkt[8:24])
+	default:
+		return nil
+	}
+}
+
+// filterTap wraps a tun.Device so every packet crossing Read (host ->
+// peer, ACLOut) or Write (peer -> host, ACLIn) is classified by filter
+// and dropped if disallowed, without device.Device or the capture/lazy-peer
+// taps needing to know the filter exists.
+type filterTap struct {
+	tun.Device
+	filter *Filter
+	db     *db.BridgeDB
+}
+
+func (t *filterTap) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n, err := t.Device.Read(bufs, sizes, offset)
+	kept := 0
+	for i := 0; i < n; i++ {
+		if t.allow(db.ACLOut, bufs[i][offset:offset+sizes[i]]) {
+			if kept != i {
+				bufs[kept], sizes[kept] = bufs[i], sizes[i]
+			}
+			kept++
+		}
+	}
+	return kept, err
+}
+
+func (t *filterTap) Write(bufs [][]byte, offset int) (int, error) {
+	kept := make([][]byte, 0, len(bufs))
+	for _, b := range bufs {
+		if t.allow(db.ACLIn, b[offset:]) {
+			kept = append(kept, b)
+		}
+	}
+	if len(kept) == 0 {
+		return len(bufs), nil
+	}
+	if _, err := t.Device.Write(kept, offset); err != nil {
+		return 0, err
+	}
+	return len(bufs), nil
+}
+
+// allow looks up the peer owning pkt's in-tunnel address (dst for
+// ACLOut, src for ACLIn — the same split lazyTUN's hydration path uses)
+// and asks filter to decide. A packet the allowed-IP trie can't attribute
+// to any known peer passes through unfiltered.
+func (t *filterTap) allow(dir db.ACLDirection, pkt []byte) bool {
+	var ip net.IP
+	if dir == db.ACLOut {
+		ip = packetDstIP(pkt)
+	} else {
+		ip = packetSrcIP(pkt)
+	}
+	if ip == nil {
+		return true
+	}
+	peer, err := t.db.LookupPeerByIP(ip)
+	if err != nil {
+		return true
+	}
+	return t.filter.Decide(dir, pkt, peer)
+}
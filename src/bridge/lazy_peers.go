@@ -0,0 +1,231 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// Lazy-peer configuration, modeled on Tailscale wgengine's "lazy peers"
+// approach: bridge-db stays the full source of truth for peer config, but a
+// peer is only IPC-configured into the live device when traffic for it is
+// observed (via lazyTUN.Read, below) or an operator pins it (see
+// db.ClientRecord.Pinned). An idle-reaper removes un-pinned peers that go
+// quiet for longer than lazyIdleTimeout. This lets a deployment carry
+// thousands of DB-known peers without all of them costing device-side
+// memory/CPU at once.
+
+const (
+	// defaultLazyIdleTimeout is used by SetLazyPeers callers that pass 0.
+	defaultLazyIdleTimeout = 5 * time.Minute
+
+	// lazyReapInterval is how often the reaper walks activePeers looking for
+	// entries older than lazyIdleTimeout.
+	lazyReapInterval = 30 * time.Second
+)
+
+// SetLazyPeers turns lazy-peer mode on or off. idleTimeout <= 0 uses
+// defaultLazyIdleTimeout. Takes effect on the next Start() for whether
+// peers are eagerly configured; the reaper goroutine itself starts/stops
+// immediately so toggling it off promptly stops reaping a running device.
+func (s *State) SetLazyPeers(enabled bool, idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultLazyIdleTimeout
+	}
+
+	s.lazyMu.Lock()
+	wasEnabled := s.lazyEnabled
+	s.lazyEnabled = enabled
+	s.lazyIdleTimeout = idleTimeout
+	s.lazyMu.Unlock()
+
+	if enabled && !wasEnabled {
+		s.startLazyReaper()
+	} else if !enabled && wasEnabled {
+		s.stopLazyReaper()
+	}
+}
+
+// markPeerActive records pubKey as having been seen just now, hydrating it
+// into the device first if it wasn't already configured. No-op if lazy mode
+// isn't enabled — activePeers is only meaningful as a reap candidate list.
+func (s *State) markPeerActive(pubKey string) {
+	s.lazyMu.Lock()
+	if !s.lazyEnabled {
+		s.lazyMu.Unlock()
+		return
+	}
+	_, wasActive := s.activePeers[pubKey]
+	s.activePeers[pubKey] = time.Now()
+	s.lazyMu.Unlock()
+
+	if !wasActive {
+		s.hydratePeer(pubKey)
+	}
+}
+
+// clearPeerActive drops pubKey from activePeers, e.g. on explicit
+// disable/remove so a stale entry doesn't outlive the peer.
+func (s *State) clearPeerActive(pubKey string) {
+	s.lazyMu.Lock()
+	delete(s.activePeers, pubKey)
+	s.lazyMu.Unlock()
+}
+
+// hydratePeer re-adds pubKey to the live device. Called outside s.mu (it's
+// reached from lazyTUN.Read and the stats-event goroutine, neither of which
+// holds it), so it takes its own brief read lock just to snapshot s.dev.
+func (s *State) hydratePeer(pubKey string) {
+	s.mu.RLock()
+	dev := s.dev
+	s.mu.RUnlock()
+	if dev == nil {
+		return
+	}
+
+	client, err := s.db.GetClient(pubKey)
+	if err != nil {
+		return
+	}
+	configurePeerOnDevice(dev, *client)
+}
+
+// startLazyReaper launches the idle-peer reaper goroutine. Caller must not
+// hold s.lazyMu.
+func (s *State) startLazyReaper() {
+	s.lazyMu.Lock()
+	if s.lazyStop != nil {
+		s.lazyMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.lazyStop = stop
+	s.lazyMu.Unlock()
+
+	s.lazyWG.Add(1)
+	go s.lazyReaper(stop)
+}
+
+// stopLazyReaper halts the reaper goroutine started by startLazyReaper.
+func (s *State) stopLazyReaper() {
+	s.lazyMu.Lock()
+	stop := s.lazyStop
+	s.lazyStop = nil
+	s.lazyMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		s.lazyWG.Wait()
+	}
+}
+
+func (s *State) lazyReaper(stop chan struct{}) {
+	defer s.lazyWG.Done()
+
+	ticker := time.NewTicker(lazyReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reapIdlePeers()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reapIdlePeers IPC-removes every tracked peer that has been idle longer
+// than lazyIdleTimeout, except pinned peers, which are re-marked active
+// instead of removed so they don't get checked again every tick.
+func (s *State) reapIdlePeers() {
+	s.lazyMu.Lock()
+	timeout := s.lazyIdleTimeout
+	now := time.Now()
+	var idle []string
+	for pubKey, last := range s.activePeers {
+		if now.Sub(last) >= timeout {
+			idle = append(idle, pubKey)
+		}
+	}
+	s.lazyMu.Unlock()
+
+	if len(idle) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	dev := s.dev
+	s.mu.RUnlock()
+	if dev == nil {
+		return
+	}
+
+	for _, pubKey := range idle {
+		client, err := s.db.GetClient(pubKey)
+		if err == nil && client.Pinned {
+			s.lazyMu.Lock()
+			s.activePeers[pubKey] = now
+			s.lazyMu.Unlock()
+			continue
+		}
+
+		_ = dev.IpcSet(fmt.Sprintf("public_key=%s\nremove=true\n", pubKey))
+		s.clearPeerActive(pubKey)
+	}
+}
+
+// lazyTUN wraps a tun.Device so that Read can inspect each packet's
+// destination address and hydrate the owning peer into the device before
+// the packet is handed upstream, the same trick used to hydrate on the
+// send path in wgengine's lazy-peer implementation.
+type lazyTUN struct {
+	tun.Device
+	state *State
+}
+
+func (t *lazyTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n, err := t.Device.Read(bufs, sizes, offset)
+	for i := 0; i < n; i++ {
+		dst := packetDstIP(bufs[i][offset : offset+sizes[i]])
+		if dst == nil {
+			continue
+		}
+		t.state.touchPeerForIP(dst)
+	}
+	return n, err
+}
+
+// touchPeerForIP looks up the peer owning dst in the allowed-IP trie and
+// marks it active, hydrating it into the device if needed.
+func (s *State) touchPeerForIP(dst net.IP) {
+	client, err := s.db.LookupPeerByIP(dst)
+	if err != nil {
+		return
+	}
+	s.markPeerActive(client.PublicKey)
+}
+
+// packetDstIP extracts the destination address from a raw IPv4 or IPv6
+// packet (no link-layer header, matching tun.Device's Read contract).
+// Returns nil for anything shorter than a minimal IP header or not IPv4/6.
+func packetDstIP(pkt []byte) net.IP {
+	if len(pkt) < 1 {
+		return nil
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) < 20 {
+			return nil
+		}
+		return net.IP(pkt[16:20])
+	case 6:
+		if len(pkt) < 40 {
+			return nil
+		}
+		return net.IP(pkt[24:40])
+	default:
+		return nil
+	}
+}
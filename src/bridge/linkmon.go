@@ -0,0 +1,209 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"wireguard-go-bridge/events"
+)
+
+// Network change monitor, modeled on Tailscale wgengine's netmon: watch the
+// host's routing/link state and react to a network change (new default
+// route, interface up/down, address change — e.g. a laptop moving from
+// Wi-Fi to Ethernet, or a VPN rebind after a carrier NAT refresh) by
+// rebinding the UDP socket and re-advertising the listen port, the same
+// recovery a user would otherwise have to trigger manually via Stop/Start.
+// Platform-specific watching lives in linkmon_linux.go (real rtnetlink
+// socket) and linkmon_other.go (portable polling fallback) behind the
+// shared watchLinkChanges(stop, notify) signature.
+
+// linkMonDebounce coalesces a burst of link/route events (common when an
+// interface flaps or NetworkManager reconfigures several addresses at
+// once) into a single rebind instead of one per event.
+const linkMonDebounce = 2 * time.Second
+
+// eventsChanCapacity bounds how many unread State.Events() entries a slow
+// consumer can fall behind by, mirroring events.ringCapacity's
+// drop-oldest-on-overflow tradeoff for the same reason: a stalled FFI
+// caller must not back-pressure the data plane.
+const eventsChanCapacity = 64
+
+// StartLinkMonitor begins watching the host's network link/route state and
+// triggers onLinkChange on a relevant change. No-op if already running.
+func (s *State) StartLinkMonitor() error {
+	s.mu.Lock()
+	if s.linkMonStop != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	s.linkMonStop = stop
+	s.mu.Unlock()
+
+	notify := make(chan struct{}, 1)
+	s.linkMonWG.Add(2)
+	go func() {
+		defer s.linkMonWG.Done()
+		if err := watchLinkChanges(stop, notify); err != nil && s.logger != nil {
+			s.logger.Errorf("link monitor: %v", err)
+		}
+	}()
+	go s.linkChangeLoop(stop, notify)
+
+	return nil
+}
+
+// StopLinkMonitor halts the monitor goroutines started by StartLinkMonitor.
+// No-op if not running.
+func (s *State) StopLinkMonitor() {
+	s.mu.Lock()
+	stop := s.linkMonStop
+	s.linkMonStop = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		s.linkMonWG.Wait()
+	}
+}
+
+// linkChangeLoop debounces notify and calls onLinkChange once per settled
+// burst of link activity, until stop is closed.
+func (s *State) linkChangeLoop(stop <-chan struct{}, notify <-chan struct{}) {
+	defer s.linkMonWG.Done()
+	var debounce *time.Timer
+	var fire <-chan time.Time
+
+	for {
+		select {
+		case <-notify:
+			if debounce == nil {
+				debounce = time.NewTimer(linkMonDebounce)
+			} else {
+				if !debounce.Stop() {
+					select {
+					case <-debounce.C:
+					default:
+					}
+				}
+				debounce.Reset(linkMonDebounce)
+			}
+			fire = debounce.C
+		case <-fire:
+			fire = nil
+			s.onLinkChange()
+		case <-stop:
+			if debounce != nil {
+				debounce.Stop()
+			}
+			return
+		}
+	}
+}
+
+// onLinkChange rebinds the primary device's UDP socket and re-applies its
+// listen port/fwmark, then restarts every live multihop tunnel the same
+// way, and publishes a KindLinkChanged event for State.Events() subscribers.
+func (s *State) onLinkChange() {
+	s.mu.Lock()
+	dev := s.dev
+	database := s.db
+	s.linkChangeCount++
+	count := s.linkChangeCount
+	s.mu.Unlock()
+
+	if dev != nil && database != nil {
+		if devRec, err := database.GetDevice(); err == nil && devRec != nil {
+			if err := dev.BindClose(); err != nil && s.logger != nil {
+				s.logger.Errorf("link monitor: bind close: %v", err)
+			}
+			ipcConfig := fmt.Sprintf("listen_port=%d\n", devRec.ListenPort)
+			if serverCfg, err := database.GetServerConfig(1); err == nil && serverCfg.FWMark != 0 {
+				ipcConfig += fmt.Sprintf("fwmark=%d\n", serverCfg.FWMark)
+			}
+			if err := dev.IpcSet(ipcConfig); err != nil && s.logger != nil {
+				s.logger.Errorf("link monitor: rebind: %v", err)
+			}
+		}
+	}
+
+	s.restartMultihopTunnels()
+
+	s.publishEvent(events.NewEvent(events.KindLinkChanged, map[string]string{
+		"count": fmt.Sprintf("%d", count),
+	}))
+}
+
+// restartMultihopTunnels tears down and recreates every currently-running
+// multihop tunnel, so each picks up a fresh TUN/bind on the new network
+// path the same way onLinkChange rebinds the primary device.
+func (s *State) restartMultihopTunnels() {
+	s.mu.RLock()
+	database := s.db
+	s.mu.RUnlock()
+	if database == nil {
+		return
+	}
+
+	multihopRegistryMu.Lock()
+	names := make([]string, 0, len(multihopRegistry))
+	for name := range multihopRegistry {
+		names = append(names, name)
+	}
+	multihopRegistryMu.Unlock()
+
+	for _, name := range names {
+		t, err := database.GetMultihopTunnel(name)
+		if err != nil || t == nil {
+			continue
+		}
+		s.stopMultihopDevice(t)
+		if err := s.startMultihopDevice(t); err != nil {
+			_ = database.SetMultihopStatus(t.Name, "error", err.Error(), nil)
+			if s.logger != nil {
+				s.logger.Errorf("link monitor: multihop restart %s: %v", t.Name, err)
+			}
+			continue
+		}
+		now := time.Now().Unix()
+		_ = database.SetMultihopStatus(t.Name, "running", "", &now)
+	}
+}
+
+// Events returns a read-only channel of link-change (and future) events.
+// The channel is created on first call and lives for the State's lifetime;
+// a slow or absent consumer can't block publishing — see publishEvent.
+func (s *State) Events() <-chan events.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.eventsCh == nil {
+		s.eventsCh = make(chan events.Event, eventsChanCapacity)
+	}
+	return s.eventsCh
+}
+
+// publishEvent delivers ev to the events channel, dropping the oldest
+// buffered event on overflow rather than blocking the caller — the same
+// drop-oldest tradeoff events.Subscription.push makes.
+func (s *State) publishEvent(ev events.Event) {
+	s.mu.Lock()
+	if s.eventsCh == nil {
+		s.eventsCh = make(chan events.Event, eventsChanCapacity)
+	}
+	ch := s.eventsCh
+	s.mu.Unlock()
+
+	select {
+	case ch <- ev:
+		return
+	default:
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- ev:
+	default:
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package bridge
+
+import (
+	"syscall"
+	"time"
+)
+
+// Netlink multicast group bits (linux/rtnetlink.h). syscall doesn't define
+// these (only golang.org/x/sys/unix does, which this repo uses elsewhere
+// for TUN ioctls — see l2) so they're named here rather than pulling in a
+// second netlink-adjacent package for five constants.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// watchLinkChanges subscribes to an rtnetlink socket for link, address, and
+// route change notifications and signals notify (non-blocking; a full
+// buffer just means a change is already pending) on each one, until stop
+// is closed. A read timeout on the socket bounds how long Recvfrom can
+// block so the loop can notice stop promptly without a second
+// wakeup-fd — the same tradeoff SO_RCVTIMEO-based polling makes elsewhere
+// a true blocking read would otherwise need extra plumbing to interrupt.
+func watchLinkChanges(stop <-chan struct{}, notify chan<- struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	tv := syscall.NsecToTimeval((500 * time.Millisecond).Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return err
+	}
+
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr | rtmgrpIPv4Route | rtmgrpIPv6Route,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 8192)
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+				continue
+			}
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.RTM_NEWLINK, syscall.RTM_DELLINK,
+				syscall.RTM_NEWADDR, syscall.RTM_DELADDR,
+				syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+				select {
+				case notify <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
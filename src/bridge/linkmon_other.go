@@ -0,0 +1,65 @@
+//go:build !linux
+
+package bridge
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// linkPollInterval is how often the portable fallback re-snapshots the
+// host's interface addresses looking for a change.
+const linkPollInterval = 2 * time.Second
+
+// watchLinkChanges is the non-Linux fallback for the real rtnetlink
+// watcher in linkmon_linux.go: this repo targets Linux WireGuard servers
+// first, so rather than binding platform-specific APIs (Windows'
+// GetIpInterfaceTable, BSD's routing socket) this just polls
+// net.InterfaceAddrs and signals notify when the set of addresses changes.
+// It won't catch a link flap that doesn't change any address, but it
+// covers the common case (DHCP renewal, interface up/down, VPN rebind)
+// without a per-platform implementation.
+func watchLinkChanges(stop <-chan struct{}, notify chan<- struct{}) error {
+	last, err := addrFingerprint()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(linkPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			cur, err := addrFingerprint()
+			if err != nil {
+				continue
+			}
+			if cur != last {
+				last = cur
+				select {
+				case notify <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// addrFingerprint returns a stable string summarizing every address on
+// every host interface, so two calls can be compared for equality.
+func addrFingerprint() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		parts = append(parts, a.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ","), nil
+}
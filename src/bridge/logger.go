@@ -28,24 +28,27 @@ func SetLogCallback(fn LogCallback, ctx unsafe.Pointer) {
 	logCallbackCtx = ctx
 }
 
-// newCallbackLogger creates a wireguard-go Logger that routes through
-// the registered callback. If no callback is set, logs are discarded.
+// newCallbackLogger creates a wireguard-go Logger that routes through the
+// registered callback (legacy SetLogCallback, or SetStructuredLogCallback
+// plus the ring buffer — see emitStructuredLog). If neither is set, logs
+// are still buffered for DrainLogs but otherwise discarded.
 func newCallbackLogger(level int, prepend string) *device.Logger {
 	logger := &device.Logger{
 		Verbosef: device.DiscardLogf,
 		Errorf:   device.DiscardLogf,
 	}
+	subsystem := subsystemFromPrepend(prepend)
 
 	if level >= device.LogLevelError {
 		logger.Errorf = func(format string, args ...any) {
 			msg := fmt.Sprintf(prepend+format, args...)
-			emitLog(1, msg)
+			emitStructuredLog(LogLevelError, subsystem, msg)
 		}
 	}
 	if level >= device.LogLevelVerbose {
 		logger.Verbosef = func(format string, args ...any) {
 			msg := fmt.Sprintf(prepend+format, args...)
-			emitLog(2, msg)
+			emitStructuredLog(LogLevelInfo, subsystem, msg)
 		}
 	}
 
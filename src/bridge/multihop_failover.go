@@ -0,0 +1,147 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"wireguard-go-bridge/db"
+)
+
+// multihopFailoverInterval is how often the failover selector checks each
+// running tunnel's active peer for a stale handshake.
+const multihopFailoverInterval = 30 * time.Second
+
+// StartMultihopFailover starts the background health-driven peer selector:
+// every multihopFailoverInterval it checks each running multihop tunnel's
+// active peer and, if it hasn't handshaked within hopStalledAfter, demotes
+// it and promotes the next-priority candidate — all via IpcSet, without
+// touching the tun device.
+func (s *State) StartMultihopFailover() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return fmt.Errorf("not initialized")
+	}
+	if s.failoverStop != nil {
+		return fmt.Errorf("multihop failover already running")
+	}
+
+	s.failoverStop = make(chan struct{})
+	stop := s.failoverStop
+	s.failoverWG.Add(1)
+	go func() {
+		defer s.failoverWG.Done()
+		ticker := time.NewTicker(multihopFailoverInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.checkMultihopFailoverOnce()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopMultihopFailover stops the background failover selector.
+func (s *State) StopMultihopFailover() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failoverStop == nil {
+		return nil
+	}
+	close(s.failoverStop)
+	s.failoverStop = nil
+	s.failoverWG.Wait()
+	return nil
+}
+
+// checkMultihopFailoverOnce scrapes every registered multihop device's
+// active peer and promotes the next candidate wherever it looks stalled.
+// Tunnels with only one candidate (the common case) are left alone — there
+// would be nothing to promote to.
+func (s *State) checkMultihopFailoverOnce() {
+	multihopRegistryMu.Lock()
+	entries := make([]*multihopEntry, 0, len(multihopRegistry))
+	for _, entry := range multihopRegistry {
+		if len(entry.peers) > 1 {
+			entries = append(entries, entry)
+		}
+	}
+	multihopRegistryMu.Unlock()
+
+	for _, entry := range entries {
+		s.failoverEntryIfStalled(entry)
+	}
+}
+
+// failoverEntryIfStalled checks entry's active peer and, if stalled,
+// promotes the next candidate in priority order (wrapping past the end
+// back to the start, so a chain of all-stalled candidates just keeps
+// cycling rather than giving up).
+func (s *State) failoverEntryIfStalled(entry *multihopEntry) {
+	output, err := entry.device.IpcGet()
+	if err != nil {
+		return
+	}
+
+	multihopRegistryMu.Lock()
+	activeKey := entry.remotePublicKey
+	peers := entry.peers
+	multihopRegistryMu.Unlock()
+
+	stats := parseAllHopStats(output)[activeKey]
+	stalled := stats.LastHandshakeTime == nil || time.Since(time.Unix(*stats.LastHandshakeTime, 0)) > hopStalledAfter
+	if !stalled {
+		return
+	}
+
+	activeIdx := -1
+	for i, p := range peers {
+		if p.PublicKey == activeKey {
+			activeIdx = i
+			break
+		}
+	}
+	if activeIdx == -1 {
+		return
+	}
+	next := peers[(activeIdx+1)%len(peers)]
+	if next.PublicKey == activeKey {
+		return
+	}
+
+	if err := promoteMultihopPeer(entry, peers[activeIdx], next); err != nil && s.logger != nil {
+		s.logger.Errorf("multihop failover: %s: %v", entry.name, err)
+		return
+	}
+
+	multihopRegistryMu.Lock()
+	entry.remotePublicKey = next.PublicKey
+	multihopRegistryMu.Unlock()
+}
+
+// promoteMultihopPeer issues one IpcSet call that drops the failed peer
+// and gives next a real endpoint, re-asserting next's allowed_ip so it
+// claims the route from failed in the device's trie — the same "last
+// write wins" mechanism startMultihopDevice/updateMultihopDevice rely on,
+// just triggered by a health check instead of a config change. wireguard-go's
+// UAPI has no way to clear just a peer's endpoint (its "endpoint" key
+// always requires a parseable host:port — see conn.Bind.ParseEndpoint), so
+// "zero the failed peer" here means removing it outright rather than
+// leaving a half-configured peer behind; it comes back the next time
+// startMultihopDevice/updateMultihopDevice runs, since the candidate list
+// in bridge-db is untouched by a failover.
+func promoteMultihopPeer(entry *multihopEntry, failed, next db.MultihopPeer) error {
+	ipcConfig := fmt.Sprintf("public_key=%s\nremove=true\n", failed.PublicKey)
+	ipcConfig += fmt.Sprintf("public_key=%s\nallowed_ip=%s\npersistent_keepalive_interval=%d\nendpoint=%s\n",
+		next.PublicKey, next.AllowedIPs, next.Keepalive, next.Endpoint)
+	if next.PresharedKey != "" {
+		ipcConfig += fmt.Sprintf("preshared_key=%s\n", next.PresharedKey)
+	}
+	return entry.device.IpcSet(ipcConfig)
+}
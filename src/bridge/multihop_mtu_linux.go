@@ -0,0 +1,68 @@
+//go:build linux
+
+package bridge
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// discoverPathMTU measures the real transport-level path MTU to
+// remoteEndpoint (host:port) using the kernel's own per-destination PMTU
+// cache rather than parsing ICMP Fragmentation Needed messages in
+// userspace: IP_PMTUDISC_PROBE tells the kernel to track path MTU for
+// this socket without ever fragmenting or giving up on EMSGSIZE, a tiny
+// write nudges discovery if the cache is cold, and IP_MTU reads back
+// whatever the kernel has learned. ok is false if remoteEndpoint can't be
+// resolved/dialed or the kernel hasn't got an estimate yet.
+func discoverPathMTU(remoteEndpoint string) (mtu int, ok bool) {
+	conn, err := net.Dial("udp", remoteEndpoint)
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+
+	udpConn, isUDP := conn.(*net.UDPConn)
+	if !isUDP {
+		return 0, false
+	}
+	raw, err := udpConn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE); sockErr != nil {
+			return
+		}
+		if _, sockErr = unix.Write(int(fd), []byte{0}); sockErr != nil {
+			return
+		}
+		mtu, sockErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU)
+	})
+	if err != nil || sockErr != nil || mtu <= 0 {
+		return 0, false
+	}
+	return mtu, true
+}
+
+// setInterfaceMTU applies mtu to ifname via SIOCSIFMTU — wireguard-go's
+// tun.Device has no MTU setter of its own (UAPI has no MTU field either),
+// so this is the same raw ioctl bridge_l2.go uses for its TUN setup, just
+// against an already-existing interface instead of creating one.
+func setInterfaceMTU(ifname string, mtu int) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(ifname)
+	if err != nil {
+		return err
+	}
+	ifr.SetUint32(uint32(mtu))
+	return unix.IoctlIfreq(fd, unix.SIOCSIFMTU, ifr)
+}
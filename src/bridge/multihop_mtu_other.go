@@ -0,0 +1,17 @@
+//go:build !linux
+
+package bridge
+
+// discoverPathMTU/setInterfaceMTU are Linux-only (see
+// multihop_mtu_linux.go): both rely on IP_MTU/SIOCSIFMTU socket options
+// this repo's other platform targets don't expose the same way. Failing
+// discovery outright (rather than returning a guessed value) means
+// probeMultihopMTU just skips this hop instead of recording a number
+// nothing actually measured.
+func discoverPathMTU(remoteEndpoint string) (int, bool) {
+	return 0, false
+}
+
+func setInterfaceMTU(ifname string, mtu int) error {
+	return nil
+}
@@ -0,0 +1,471 @@
+package bridge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"golang.zx2c4.com/wireguard/conn"
+
+	"wireguard-go-bridge/db"
+)
+
+// multihop_relay_bind.go implements a conn.Bind that tunnels a multihop
+// hop's WireGuard traffic over a persistent WSS connection instead of raw
+// UDP, for the case netbird's relay integration targets: the outermost hop
+// (hop0) can't reach RemoteEndpoint directly over UDP (egress firewall,
+// carrier-grade NAT with no hole-punching), but outbound HTTPS/WSS to a
+// single relay host works. The relay is expected to forward whatever binary
+// frames it receives verbatim between this client and the one upstream
+// peer — it never needs to parse WireGuard's own framing, just relay bytes.
+//
+// Each WireGuard datagram is sent as one WSS binary message containing the
+// type byte relayFrameData, a 4-byte big-endian length prefix, and then the
+// raw datagram; the
+// websocket library already preserves message boundaries on its own, but
+// the explicit length keeps the wire format self-describing instead of
+// relying on that framing implicitly. The first message on every
+// connection (including after a reconnect) is a HELLO frame instead: magic
+// byte relayFrameHello followed by HMAC-SHA256(authSecret, relayHelloContext)
+// — the relay checks it against the secret it was configured with for this
+// client and closes the connection if it doesn't match.
+type relayBind struct {
+	url        string
+	authSecret string
+
+	// onStatus is called with nil after a (re)connect succeeds and with a
+	// non-nil error when the connection is lost and a reconnect begins —
+	// startMultihopDevice wires this to s.db.SetMultihopStatus so a relay
+	// disconnect is visible the same way a dead UDP handshake is.
+	onStatus func(err error)
+
+	mu     sync.Mutex
+	ws     *websocket.Conn
+	closed bool
+
+	recvCh chan []byte
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+const (
+	relayFrameHello byte = 0x01
+	relayFrameData  byte = 0x02
+)
+
+// relayHelloContext is the fixed message HMAC'd with the shared secret for
+// the HELLO frame — there's no per-connection nonce because the relay bind
+// trusts its transport (WSS/TLS) for replay protection, the same way this
+// hop's own WireGuard session trusts UDP for its outer transport.
+const relayHelloContext = "phantom-multihop-relay-hello"
+
+// relayRecvBacklog bounds how many not-yet-consumed datagrams the reader
+// goroutine queues before it starts blocking — generous enough to absorb a
+// burst without the relay connection's read loop stalling mid-frame.
+const relayRecvBacklog = 256
+
+const (
+	relayBaseBackoff = 2 * time.Second
+	relayMaxBackoff  = 2 * time.Minute
+)
+
+var _ conn.Bind = (*relayBind)(nil)
+
+// newRelayBind constructs a relayBind that isn't yet connected — the first
+// Open call starts the connect-and-reconnect loop.
+func newRelayBind(relayURL, authSecret string, onStatus func(err error)) *relayBind {
+	return &relayBind{
+		url:        relayURL,
+		authSecret: authSecret,
+		onStatus:   onStatus,
+	}
+}
+
+// relayEndpoint is the degenerate conn.Endpoint for a relayBind: a hop
+// using a relay transport only ever has the one upstream peer, reached
+// through the relay rather than at any IP this process can name, so there's
+// no real source/destination address to cache — every method beyond the
+// string accessors used for equality checks returns the zero value.
+type relayEndpoint struct {
+	addr string
+}
+
+func (e relayEndpoint) ClearSrc()           {}
+func (e relayEndpoint) SrcToString() string { return "" }
+func (e relayEndpoint) DstToString() string { return e.addr }
+func (e relayEndpoint) DstToBytes() []byte  { return []byte(e.addr) }
+func (e relayEndpoint) DstIP() netip.Addr   { return netip.Addr{} }
+func (e relayEndpoint) SrcIP() netip.Addr   { return netip.Addr{} }
+
+func (b *relayBind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	return relayEndpoint{addr: s}, nil
+}
+
+// Open starts the relay connection (and its reconnect loop) and returns a
+// single ReceiveFunc fed by it. port/actualPort are meaningless for a relay
+// transport — there's no local UDP port to bind — so actualPort just
+// echoes port back, the same as a Bind with nothing useful to report.
+func (b *relayBind) Open(port uint16) ([]conn.ReceiveFunc, uint16, error) {
+	b.mu.Lock()
+	if b.stop != nil {
+		b.mu.Unlock()
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+	b.closed = false
+	b.stop = make(chan struct{})
+	b.recvCh = make(chan []byte, relayRecvBacklog)
+	stop := b.stop
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go b.connectLoop(stop)
+
+	return []conn.ReceiveFunc{b.receive}, port, nil
+}
+
+func (b *relayBind) receive(packets [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+	frame, ok := <-b.recvCh
+	if !ok {
+		return 0, net.ErrClosed
+	}
+	n := copy(packets[0], frame)
+	sizes[0] = n
+	eps[0] = relayEndpoint{addr: b.url}
+	return 1, nil
+}
+
+// connectLoop (re)dials the relay, sends the HELLO frame, then reads
+// frames until the connection fails, reporting status via onStatus and
+// retrying with exponential backoff until stop is closed.
+func (b *relayBind) connectLoop(stop chan struct{}) {
+	defer b.wg.Done()
+
+	attempt := 0
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ws, err := b.dial()
+		if err != nil {
+			attempt++
+			if b.onStatus != nil {
+				b.onStatus(fmt.Errorf("dial %s: %w", b.url, err))
+			}
+			if !sleepOrStop(relayReconnectBackoff(attempt), stop) {
+				return
+			}
+			continue
+		}
+
+		attempt = 0
+		b.mu.Lock()
+		b.ws = ws
+		b.mu.Unlock()
+		if b.onStatus != nil {
+			b.onStatus(nil)
+		}
+
+		err = b.readLoop(ws, stop)
+
+		b.mu.Lock()
+		if b.ws == ws {
+			b.ws = nil
+		}
+		b.mu.Unlock()
+		_ = ws.Close()
+
+		if err == nil {
+			// readLoop only returns nil when stop fired.
+			return
+		}
+		attempt++
+		if b.onStatus != nil {
+			b.onStatus(fmt.Errorf("relay connection lost: %w", err))
+		}
+		if !sleepOrStop(relayReconnectBackoff(attempt), stop) {
+			return
+		}
+	}
+}
+
+// dial opens the WSS connection and sends the HELLO auth frame.
+func (b *relayBind) dial() (*websocket.Conn, error) {
+	origin, err := relayOrigin(b.url)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := websocket.NewConfig(b.url, origin)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ws.PayloadType = websocket.BinaryFrame
+
+	hello := append([]byte{relayFrameHello}, relayHelloToken(b.authSecret)...)
+	if _, err := ws.Write(hello); err != nil {
+		_ = ws.Close()
+		return nil, fmt.Errorf("hello: %w", err)
+	}
+	return ws, nil
+}
+
+// readLoop reads frames off ws and pushes data frames into b.recvCh until
+// ws errors or stop is closed (in which case it returns nil — not a real
+// failure, just shutdown).
+func (b *relayBind) readLoop(ws *websocket.Conn, stop chan struct{}) error {
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+		if len(msg) < 1 {
+			continue
+		}
+		switch msg[0] {
+		case relayFrameData:
+			payload, ok := decodeRelayDataFrame(msg[1:])
+			if !ok {
+				continue
+			}
+			select {
+			case b.recvCh <- payload:
+			case <-stop:
+				return nil
+			}
+		default:
+			// Unknown/unexpected frame type from the relay — ignore rather
+			// than tearing down the connection over it.
+		}
+	}
+}
+
+func (b *relayBind) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	stop := b.stop
+	b.stop = nil
+	ws := b.ws
+	b.ws = nil
+	recvCh := b.recvCh
+	b.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	if ws != nil {
+		_ = ws.Close()
+	}
+	b.wg.Wait()
+	if recvCh != nil {
+		close(recvCh)
+	}
+	return nil
+}
+
+// SetMark is a no-op: the relay connection is a regular TCP/TLS socket
+// dialed normally, not one this hop's policy routing needs to mark —
+// fwmark-based routing only matters for relay/exit hops (hopIndex > 1 in
+// startMultihopDevice), and only the outermost hop ever uses a relay
+// transport in the first place.
+func (b *relayBind) SetMark(mark uint32) error {
+	return nil
+}
+
+func (b *relayBind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	b.mu.Lock()
+	ws := b.ws
+	b.mu.Unlock()
+	if ws == nil {
+		return errors.New("relay bind: not connected")
+	}
+
+	for _, buf := range bufs {
+		frame := encodeRelayDataFrame(buf)
+		if _, err := ws.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *relayBind) BatchSize() int {
+	return 1
+}
+
+// encodeRelayDataFrame/decodeRelayDataFrame implement the length-prefixed
+// data frame format documented on relayBind: relayFrameData, then a 4-byte
+// big-endian length, then that many bytes of payload.
+func encodeRelayDataFrame(payload []byte) []byte {
+	frame := make([]byte, 1+4+len(payload))
+	frame[0] = relayFrameData
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	return frame
+}
+
+func decodeRelayDataFrame(body []byte) ([]byte, bool) {
+	if len(body) < 4 {
+		return nil, false
+	}
+	n := binary.BigEndian.Uint32(body[:4])
+	body = body[4:]
+	if uint32(len(body)) < n {
+		return nil, false
+	}
+	return body[:n], true
+}
+
+// relayHelloToken derives the HELLO frame's auth tag from authSecret.
+func relayHelloToken(authSecret string) []byte {
+	mac := hmac.New(sha256.New, []byte(authSecret))
+	mac.Write([]byte(relayHelloContext))
+	return mac.Sum(nil)
+}
+
+// relayOrigin derives a websocket Origin header from relayURL by swapping
+// its ws/wss scheme for http/https — DialConfig requires a well-formed
+// Origin even though this client has no browser document to derive one
+// from.
+func relayOrigin(relayURL string) (string, error) {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	u.Path = "/"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// relayReconnectBackoff returns the retry delay for the attempt-th
+// consecutive failure (1-indexed), doubling from relayBaseBackoff up to
+// relayMaxBackoff — same doubling shape as multihop_watchdog.go's
+// watchdogBackoff, just scoped to relay reconnects instead of hop restarts.
+func relayReconnectBackoff(attempt int) time.Duration {
+	d := relayBaseBackoff
+	for i := 1; i < attempt && d < relayMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > relayMaxBackoff {
+		d = relayMaxBackoff
+	}
+	return d
+}
+
+// sleepOrStop waits for d or until stop is closed, returning false if stop
+// fired first so callers can bail out of a retry loop immediately instead
+// of finishing the backoff sleep.
+func sleepOrStop(d time.Duration, stop chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// multihopBind picks t's conn.Bind: conn.NewDefaultBind() (plain UDP) unless
+// t.Transport is "wss" with a RelayURL configured, in which case it's a
+// relayBind wired to report connect/disconnect through SetMultihopStatus —
+// the same status field the watchdog and regular start/stop paths already
+// use, so a relay drop shows up the same way a dead UDP handshake would.
+func (s *State) multihopBind(t *db.MultihopTunnel) conn.Bind {
+	if t.Transport != "wss" || t.RelayURL == "" {
+		return conn.NewDefaultBind()
+	}
+	name := t.Name
+	return newRelayBind(t.RelayURL, t.RelayAuthSecret, func(err error) {
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Errorf("multihop relay %s: %v", name, err)
+			}
+			_ = s.db.SetMultihopStatus(name, "error", fmt.Sprintf("relay: %v", err), nil)
+			return
+		}
+		now := time.Now().Unix()
+		_ = s.db.SetMultihopStatus(name, "running", "", &now)
+	})
+}
+
+// SetMultihopRelay configures name's transport to tunnel over a WSS relay
+// (or clears it back to plain UDP when url is empty) and, if the tunnel is
+// currently running, rebuilds its device so the change takes effect right
+// away — swapping conn.Bind implementations isn't something wireguard-go
+// supports on a live device (device.Device.BindUpdate only re-opens the
+// Bind it already has), so this is the same full stop/start cycle
+// restartMultihopHop uses for other changes that can't be applied in place.
+func (s *State) SetMultihopRelay(name, relayURL, authSecret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return fmt.Errorf("not initialized")
+	}
+	if relayURL != "" {
+		u, err := url.Parse(relayURL)
+		if err != nil {
+			return fmt.Errorf("relay url: %w", err)
+		}
+		// The HELLO frame's auth tag is a static HMAC with no nonce (see
+		// relayHelloContext) — it trusts WSS/TLS for replay protection, so
+		// a relay URL that isn't actually wss:// would silently turn that
+		// static token into a replayable credential for anyone on-path.
+		if u.Scheme != "wss" {
+			return fmt.Errorf("relay url must use wss://, got %q", u.Scheme)
+		}
+	}
+	if err := s.db.SetMultihopRelay(name, relayURL, authSecret); err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	t, err := s.db.GetMultihopTunnel(name)
+	if err != nil {
+		return fmt.Errorf("get tunnel: %w", err)
+	}
+
+	multihopRegistryMu.Lock()
+	_, running := multihopRegistry[name]
+	multihopRegistryMu.Unlock()
+	if !running {
+		return nil
+	}
+
+	s.stopMultihopDevice(t)
+	if err := s.startMultihopDevice(t); err != nil {
+		_ = s.db.SetMultihopStatus(name, "error", err.Error(), nil)
+		return err
+	}
+	now := time.Now().Unix()
+	_ = s.db.SetMultihopStatus(name, "running", "", &now)
+	return nil
+}
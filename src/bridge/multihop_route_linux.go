@@ -0,0 +1,218 @@
+//go:build linux
+
+package bridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// multihop_route_linux.go installs and removes the per-hop policy routing
+// startMultihopDevice/stopMultihopDevice apply around a relay/exit hop's
+// WireGuard device: an `ip rule fwmark <fwmark> lookup <table> priority
+// <priority>` rule plus a default route into that table via the previous
+// hop's tunnel interface, so a hop's marked socket traffic gets forwarded
+// by the hop before it instead of leaking out the host's normal default
+// route. Built on a raw rtnetlink socket rather than a netlink-adjacent
+// dependency — see linkmon_linux.go's watchLinkChanges for why this repo
+// reaches for syscall here instead.
+
+// fibRuleActionToTable is FR_ACT_TO_TBL (linux/fib_rules.h): "look up the
+// routing table named by this rule" — the only action a policy route for
+// multihop needs.
+const fibRuleActionToTable = 1
+
+// FRA_* attribute types (linux/fib_rules.h) not exposed by the syscall
+// package, which only defines the route-side RTA_* enum.
+const (
+	fraPriority = 6
+	fraFwMark   = 10
+	fraTable    = 15
+)
+
+// fibRuleHdr mirrors linux/fib_rules.h's struct fib_rule_hdr.
+type fibRuleHdr struct {
+	Family byte
+	DstLen byte
+	SrcLen byte
+	TOS    byte
+	Table  byte
+	Res1   byte
+	Res2   byte
+	Action byte
+}
+
+// installMultihopPolicyRoute adds the ip-rule/route pair described above.
+// Safe to call again for a hop that already has one installed (NLM_F_CREATE
+// without NLM_F_EXCL — see netlinkRequest) since restoreMultihopTunnels
+// re-runs this on every daemon restart.
+func installMultihopPolicyRoute(fwmark, table, priority int, viaIface string) error {
+	if err := netlinkAddRule(fwmark, table, priority); err != nil {
+		return fmt.Errorf("ip rule add: %w", err)
+	}
+	if err := netlinkAddDefaultRoute(table, viaIface); err != nil {
+		return fmt.Errorf("ip route add: %w", err)
+	}
+	return nil
+}
+
+// removeMultihopPolicyRoute undoes installMultihopPolicyRoute. Errors are
+// swallowed: its caller is a teardown path (stopMultihopDevice) that must
+// still proceed if the rule or
+// route is already gone — a manual `ip rule del`, a reboot, or a hop that
+// never made it past startMultihopDevice's device.Up() all leave nothing
+// to remove.
+func removeMultihopPolicyRoute(fwmark, table, priority int, viaIface string) {
+	_ = netlinkDelRule(fwmark, table, priority)
+	_ = netlinkDelDefaultRoute(table, viaIface)
+}
+
+func netlinkAddRule(fwmark, table, priority int) error {
+	return netlinkRequest(syscall.RTM_NEWRULE, syscall.NLM_F_CREATE, fibRulePayload(fwmark, table, priority))
+}
+
+func netlinkDelRule(fwmark, table, priority int) error {
+	return netlinkRequest(syscall.RTM_DELRULE, 0, fibRulePayload(fwmark, table, priority))
+}
+
+func fibRulePayload(fwmark, table, priority int) []byte {
+	hdr := fibRuleHdr{
+		Family: syscall.AF_INET,
+		Action: fibRuleActionToTable,
+	}
+	payload := structBytes(unsafe.Pointer(&hdr), int(unsafe.Sizeof(hdr)))
+	payload = append(payload, rtAttr(fraFwMark, uint32Bytes(uint32(fwmark)))...)
+	payload = append(payload, rtAttr(fraTable, uint32Bytes(uint32(table)))...)
+	payload = append(payload, rtAttr(fraPriority, uint32Bytes(uint32(priority)))...)
+	return payload
+}
+
+func netlinkAddDefaultRoute(table int, viaIface string) error {
+	payload, err := routePayload(table, viaIface)
+	if err != nil {
+		return err
+	}
+	return netlinkRequest(syscall.RTM_NEWROUTE, syscall.NLM_F_CREATE, payload)
+}
+
+func netlinkDelDefaultRoute(table int, viaIface string) error {
+	payload, err := routePayload(table, viaIface)
+	if err != nil {
+		return err
+	}
+	return netlinkRequest(syscall.RTM_DELROUTE, 0, payload)
+}
+
+// routePayload builds an rtmsg for a 0.0.0.0/0 route into table via
+// viaIface's current ifindex. DstLen left at 0 (no RTA_DST attribute)
+// means "default route", the same as `ip route add default ...`.
+func routePayload(table int, viaIface string) ([]byte, error) {
+	iface, err := net.InterfaceByName(viaIface)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %w", viaIface, err)
+	}
+
+	rt := syscall.RtMsg{
+		Family:   syscall.AF_INET,
+		Table:    syscall.RT_TABLE_UNSPEC,
+		Protocol: syscall.RTPROT_BOOT,
+		Scope:    syscall.RT_SCOPE_UNIVERSE,
+		Type:     syscall.RTN_UNICAST,
+	}
+	payload := structBytes(unsafe.Pointer(&rt), int(unsafe.Sizeof(rt)))
+	payload = append(payload, rtAttr(syscall.RTA_OIF, uint32Bytes(uint32(iface.Index)))...)
+	payload = append(payload, rtAttr(syscall.RTA_TABLE, uint32Bytes(uint32(table)))...)
+	return payload, nil
+}
+
+// netlinkSeq is shared across every request this process sends; a process
+// that never reads unsolicited multicast traffic on this socket (we open a
+// fresh one per call, below) doesn't strictly need unique sequence numbers,
+// but it costs nothing and keeps responses easy to correlate if that ever
+// changes.
+var netlinkSeq uint32
+
+// netlinkRequest sends one rtnetlink request of type msgType carrying
+// payload, ORing NLM_F_REQUEST|NLM_F_ACK with the caller-supplied flags
+// (NLM_F_CREATE for adds; deletes pass 0), and waits for the kernel's ACK.
+// A non-zero ACK error is surfaced as a syscall.Errno so callers can match
+// against e.g. syscall.EEXIST/ENOENT if they ever need to.
+func netlinkRequest(msgType, flags int, payload []byte) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	hdr := syscall.NlMsghdr{
+		Len:   uint32(syscall.SizeofNlMsghdr + len(payload)),
+		Type:  uint16(msgType),
+		Flags: uint16(flags) | syscall.NLM_F_REQUEST | syscall.NLM_F_ACK,
+		Seq:   atomic.AddUint32(&netlinkSeq, 1),
+	}
+	req := structBytes(unsafe.Pointer(&hdr), syscall.SizeofNlMsghdr)
+	req = append(req, payload...)
+
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 8192)
+	n, _, err := syscall.Recvfrom(fd, resp, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(resp[:n])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.NLMSG_ERROR {
+			continue
+		}
+		if errno := int32(binary.LittleEndian.Uint32(m.Data[:4])); errno != 0 {
+			return syscall.Errno(-errno)
+		}
+		return nil
+	}
+	return fmt.Errorf("no netlink ack for request type %d", msgType)
+}
+
+// rtAttr encodes one rtattr (length-prefixed, NLA-aligned) of attrType
+// carrying value, the same TLV layout both fib_rule_hdr's and rtmsg's
+// attributes use.
+func rtAttr(attrType int, value []byte) []byte {
+	l := syscall.SizeofRtAttr + len(value)
+	buf := make([]byte, rtaAlign(l))
+	attr := syscall.RtAttr{Len: uint16(l), Type: uint16(attrType)}
+	copy(buf, structBytes(unsafe.Pointer(&attr), syscall.SizeofRtAttr))
+	copy(buf[syscall.SizeofRtAttr:], value)
+	return buf
+}
+
+func rtaAlign(l int) int {
+	return (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// structBytes copies size bytes starting at p into a fresh slice — used to
+// serialize the fixed-layout netlink structs (nlmsghdr, rtattr, rtmsg,
+// fibRuleHdr) this file builds requests out of.
+func structBytes(p unsafe.Pointer, size int) []byte {
+	b := make([]byte, size)
+	copy(b, unsafe.Slice((*byte)(p), size))
+	return b
+}
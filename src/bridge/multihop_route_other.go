@@ -0,0 +1,18 @@
+//go:build !linux
+
+package bridge
+
+import "fmt"
+
+// installMultihopPolicyRoute/removeMultihopPolicyRoute are Linux-only (see
+// multihop_route_linux.go): policy routing is rtnetlink's ip-rule/ip-route
+// concept, with no portable equivalent this repo targets. install fails
+// outright here rather than silently skipping the route — a hop that
+// looks "running" but isn't actually reachable through the chain is worse
+// than one that fails to start; remove is a no-op, since install never
+// succeeds here and so there is never a route to remove.
+func installMultihopPolicyRoute(fwmark, table, priority int, viaIface string) error {
+	return fmt.Errorf("multihop policy routing requires Linux (rtnetlink)")
+}
+
+func removeMultihopPolicyRoute(fwmark, table, priority int, viaIface string) {}
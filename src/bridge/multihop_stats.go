@@ -0,0 +1,265 @@
+package bridge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hopStalledAfter is how long since the last handshake before a hop is
+// reported as stalled — long enough to tolerate a missed keepalive cycle at
+// typical persistent_keepalive_interval values, short enough to surface a
+// dead upstream promptly.
+const hopStalledAfter = 180 * time.Second
+
+// hopStatsRingSize bounds memory per tunnel: at the default 10s poll
+// interval this holds ~20 minutes of history, enough for a UI throughput
+// graph without unbounded growth for long-lived tunnels.
+const hopStatsRingSize = 120
+
+// HopStatsSample is one poll of a multihop tunnel's upstream peer.
+type HopStatsSample struct {
+	Timestamp           int64  `json:"timestamp"`
+	RxBytes             int64  `json:"rx_bytes"`
+	TxBytes             int64  `json:"tx_bytes"`
+	LastHandshakeTime   *int64 `json:"last_handshake_time,omitempty"`
+	PersistentKeepalive int    `json:"persistent_keepalive_interval"`
+	Endpoint            string `json:"endpoint,omitempty"`
+}
+
+// HopStats is the result of State.MultihopStats: the latest sample plus
+// enough db.MultihopTunnel context to place it in the chain, its recent
+// history, whether it looks stalled, and the watchdog's restart history
+// (see multihop_watchdog.go) so an operator can see why a chain is
+// degraded instead of just observing "no traffic".
+type HopStats struct {
+	Name              string           `json:"name"`
+	HopIndex          int              `json:"hop_index,omitempty"`
+	RemotePublicKey   string           `json:"remote_public_key"`
+	Stalled           bool             `json:"stalled"`
+	Latest            HopStatsSample   `json:"latest"`
+	History           []HopStatsSample `json:"history"`
+	WatchdogAttempts  int              `json:"watchdog_attempts,omitempty"`
+	WatchdogLastError string           `json:"watchdog_last_error,omitempty"`
+	WatchdogNextRetry *int64           `json:"watchdog_next_retry,omitempty"`
+}
+
+// hopStatsRing is a fixed-size circular buffer of HopStatsSample, oldest
+// first once full.
+type hopStatsRing struct {
+	mu     sync.Mutex
+	buf    []HopStatsSample
+	next   int
+	filled bool
+}
+
+func newHopStatsRing() *hopStatsRing {
+	return &hopStatsRing{buf: make([]HopStatsSample, hopStatsRingSize)}
+}
+
+func (r *hopStatsRing) push(s HopStatsSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.filled = true
+	}
+}
+
+// snapshot returns the buffered samples oldest-first.
+func (r *hopStatsRing) snapshot() []HopStatsSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.filled {
+		out := make([]HopStatsSample, r.next)
+		copy(out, r.buf[:r.next])
+		return out
+	}
+	out := make([]HopStatsSample, len(r.buf))
+	copy(out, r.buf[r.next:])
+	copy(out[len(r.buf)-r.next:], r.buf[:r.next])
+	return out
+}
+
+var (
+	hopStatsRings   = make(map[string]*hopStatsRing)
+	hopStatsRingsMu sync.Mutex
+)
+
+func hopStatsRingFor(name string) *hopStatsRing {
+	hopStatsRingsMu.Lock()
+	defer hopStatsRingsMu.Unlock()
+	r, ok := hopStatsRings[name]
+	if !ok {
+		r = newHopStatsRing()
+		hopStatsRings[name] = r
+	}
+	return r
+}
+
+// StartMultihopHopStatsPoll starts a background poller that snapshots each
+// running multihop tunnel's upstream peer counters into a per-tunnel ring
+// buffer every intervalSec, so MultihopStats can serve throughput history
+// and stalled-hop detection without hitting the UAPI socket on every call.
+func (s *State) StartMultihopHopStatsPoll(intervalSec int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return fmt.Errorf("not initialized")
+	}
+	if s.hopStatsStop != nil {
+		return fmt.Errorf("multihop hop stats poller already running")
+	}
+
+	s.hopStatsStop = make(chan struct{})
+	stop := s.hopStatsStop
+	interval := time.Duration(intervalSec) * time.Second
+	s.hopStatsWG.Add(1)
+	go func() {
+		defer s.hopStatsWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pollHopStatsOnce()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopMultihopHopStatsPoll stops the background hop stats poller.
+func (s *State) StopMultihopHopStatsPoll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hopStatsStop == nil {
+		return nil
+	}
+	close(s.hopStatsStop)
+	s.hopStatsStop = nil
+	s.hopStatsWG.Wait()
+	return nil
+}
+
+// pollHopStatsOnce scrapes every registered multihop device once and pushes
+// a sample into its ring buffer.
+func pollHopStatsOnce() {
+	multihopRegistryMu.Lock()
+	entries := make([]*multihopEntry, 0, len(multihopRegistry))
+	for _, entry := range multihopRegistry {
+		entries = append(entries, entry)
+	}
+	multihopRegistryMu.Unlock()
+
+	for _, entry := range entries {
+		output, err := entry.device.IpcGet()
+		if err != nil {
+			continue
+		}
+		multihopRegistryMu.Lock()
+		activeKey := entry.remotePublicKey
+		multihopRegistryMu.Unlock()
+		hopStatsRingFor(entry.name).push(parseAllHopStats(output)[activeKey])
+	}
+}
+
+// MultihopStats returns name's latest upstream peer counters, recent
+// history, and whether the hop looks stalled (no handshake in
+// hopStalledAfter), joined with the registry's cached hop index and remote
+// public key. It scrapes IpcGet directly for the latest sample rather than
+// waiting on the next poller tick, so a caller gets fresh numbers even if
+// the poller hasn't been started.
+func (s *State) MultihopStats(name string) (*HopStats, error) {
+	multihopRegistryMu.Lock()
+	entry, ok := multihopRegistry[name]
+	var activeKey string
+	var wd multihopWatchdogState
+	if ok {
+		activeKey = entry.remotePublicKey
+		wd = entry.watchdog
+	}
+	multihopRegistryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("multihop tunnel %s is not running", name)
+	}
+
+	output, err := entry.device.IpcGet()
+	if err != nil {
+		return nil, fmt.Errorf("ipc get %s: %w", name, err)
+	}
+	latest := parseAllHopStats(output)[activeKey]
+	hopStatsRingFor(name).push(latest)
+
+	stats := &HopStats{
+		Name:              name,
+		HopIndex:          entry.hopIndex,
+		RemotePublicKey:   activeKey,
+		Latest:            latest,
+		History:           hopStatsRingFor(name).snapshot(),
+		WatchdogAttempts:  wd.attempts,
+		WatchdogLastError: wd.lastError,
+	}
+	if !wd.nextRetry.IsZero() {
+		next := wd.nextRetry.Unix()
+		stats.WatchdogNextRetry = &next
+	}
+	stats.Stalled = latest.LastHandshakeTime == nil ||
+		time.Since(time.Unix(*latest.LastHandshakeTime, 0)) > hopStalledAfter
+	return stats, nil
+}
+
+// parseAllHopStats splits a multihop device's IpcGet dump into one
+// HopStatsSample per peer section, keyed by that peer's public_key — a
+// multi-candidate tunnel (see multihop_failover.go) has more than one peer
+// configured at once, so unlike the single-peer assumption this replaced,
+// callers must pick the key they care about (usually the active candidate)
+// out of the returned map.
+func parseAllHopStats(output string) map[string]HopStatsSample {
+	result := make(map[string]HopStatsSample)
+	var curKey string
+	var cur HopStatsSample
+	flush := func() {
+		if curKey != "" {
+			result[curKey] = cur
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := parts[0], parts[1]
+		if key == "public_key" {
+			flush()
+			curKey = val
+			cur = HopStatsSample{}
+			continue
+		}
+		switch key {
+		case "last_handshake_time_sec":
+			if v, err := strconv.ParseInt(val, 10, 64); err == nil && v > 0 {
+				cur.LastHandshakeTime = &v
+			}
+		case "rx_bytes":
+			cur.RxBytes, _ = strconv.ParseInt(val, 10, 64)
+		case "tx_bytes":
+			cur.TxBytes, _ = strconv.ParseInt(val, 10, 64)
+		case "persistent_keepalive_interval":
+			v, _ := strconv.Atoi(val)
+			cur.PersistentKeepalive = v
+		case "endpoint":
+			cur.Endpoint = val
+		}
+	}
+	flush()
+	return result
+}
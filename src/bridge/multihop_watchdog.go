@@ -0,0 +1,208 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+
+	"golang.zx2c4.com/wireguard/device"
+)
+
+// multihopWatchdogInterval is how often the watchdog checks each running
+// multihop tunnel's active peer for a missing or stale handshake.
+const multihopWatchdogInterval = 10 * time.Second
+
+// multihopInitialHandshakeTimeout is how long a freshly (re)started hop gets
+// to complete its first handshake before the watchdog considers it dead.
+const multihopInitialHandshakeTimeout = 15 * time.Second
+
+// multihopHandshakeStaleAfter is how long an already-established hop can go
+// without a fresh handshake before the watchdog considers it dead —
+// RekeyAfterTime is when wireguard-go itself starts rekeying and
+// KeepaliveTimeout is how long it then waits for a response, so anything
+// past their sum means the peer has gone quiet even by wireguard-go's own
+// clock, not just ours.
+const multihopHandshakeStaleAfter = device.RekeyAfterTime + device.KeepaliveTimeout
+
+// multihopWatchdogBaseBackoff and multihopWatchdogMaxBackoff bound the
+// restart retry schedule: the delay doubles from base up to max on each
+// consecutive failed restart, so a hop whose upstream is genuinely gone
+// doesn't get hammered with restart attempts forever.
+const (
+	multihopWatchdogBaseBackoff = 5 * time.Second
+	multihopWatchdogMaxBackoff  = 5 * time.Minute
+)
+
+// multihopWatchdogState is one hop's handshake-restart history, surfaced
+// through HopStats so an operator can see why a chain is degraded instead
+// of just observing "no traffic".
+type multihopWatchdogState struct {
+	startedAt time.Time
+	attempts  int
+	lastError string
+	nextRetry time.Time
+}
+
+// StartMultihopWatchdog starts the background handshake watchdog: every
+// multihopWatchdogInterval it checks each running multihop tunnel's active
+// peer and, if its handshake looks dead, restarts that hop alone — its tun
+// device and wireguard-go device are rebuilt, but every other hop in the
+// chain is left running, since each hop is an independent device talking
+// to its neighbours over the OS network stack rather than in-process.
+func (s *State) StartMultihopWatchdog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return fmt.Errorf("not initialized")
+	}
+	if s.watchdogStop != nil {
+		return fmt.Errorf("multihop watchdog already running")
+	}
+
+	s.watchdogStop = make(chan struct{})
+	stop := s.watchdogStop
+	s.watchdogWG.Add(1)
+	go func() {
+		defer s.watchdogWG.Done()
+		ticker := time.NewTicker(multihopWatchdogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.checkMultihopWatchdogOnce()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopMultihopWatchdog stops the background handshake watchdog.
+func (s *State) StopMultihopWatchdog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watchdogStop == nil {
+		return nil
+	}
+	close(s.watchdogStop)
+	s.watchdogStop = nil
+	s.watchdogWG.Wait()
+	return nil
+}
+
+// checkMultihopWatchdogOnce scrapes every registered multihop device's
+// active peer and restarts whichever ones look dead and are due for a
+// retry under their backoff schedule.
+func (s *State) checkMultihopWatchdogOnce() {
+	multihopRegistryMu.Lock()
+	names := make([]string, 0, len(multihopRegistry))
+	for name := range multihopRegistry {
+		names = append(names, name)
+	}
+	multihopRegistryMu.Unlock()
+
+	for _, name := range names {
+		s.checkMultihopWatchdogEntry(name)
+	}
+}
+
+// checkMultihopWatchdogEntry checks name's active peer handshake and, if it
+// looks dead and isn't still within its backoff window from a previous
+// failed attempt, restarts the hop.
+func (s *State) checkMultihopWatchdogEntry(name string) {
+	multihopRegistryMu.Lock()
+	entry, ok := multihopRegistry[name]
+	multihopRegistryMu.Unlock()
+	if !ok {
+		return
+	}
+
+	output, err := entry.device.IpcGet()
+	if err != nil {
+		return
+	}
+
+	multihopRegistryMu.Lock()
+	activeKey := entry.remotePublicKey
+	wd := entry.watchdog
+	multihopRegistryMu.Unlock()
+
+	if !handshakeLooksDead(parseAllHopStats(output)[activeKey], wd.startedAt) {
+		return
+	}
+	if !wd.nextRetry.IsZero() && time.Now().Before(wd.nextRetry) {
+		return
+	}
+
+	if err := s.restartMultihopHop(name); err != nil {
+		multihopRegistryMu.Lock()
+		if e, ok := multihopRegistry[name]; ok {
+			e.watchdog.attempts++
+			e.watchdog.lastError = err.Error()
+			e.watchdog.nextRetry = time.Now().Add(watchdogBackoff(e.watchdog.attempts))
+		}
+		multihopRegistryMu.Unlock()
+		if s.logger != nil {
+			s.logger.Errorf("multihop watchdog restart %s: %v", name, err)
+		}
+	}
+}
+
+// handshakeLooksDead reports whether stats' handshake is missing past
+// multihopInitialHandshakeTimeout (never handshaken since startedAt) or
+// stale past multihopHandshakeStaleAfter (handshaken before, but not
+// recently enough).
+func handshakeLooksDead(stats HopStatsSample, startedAt time.Time) bool {
+	if stats.LastHandshakeTime == nil {
+		return time.Since(startedAt) > multihopInitialHandshakeTimeout
+	}
+	return time.Since(time.Unix(*stats.LastHandshakeTime, 0)) > multihopHandshakeStaleAfter
+}
+
+// watchdogBackoff returns the retry delay for the attempts-th consecutive
+// restart failure (1-indexed), doubling from multihopWatchdogBaseBackoff up
+// to multihopWatchdogMaxBackoff.
+func watchdogBackoff(attempts int) time.Duration {
+	d := multihopWatchdogBaseBackoff
+	for i := 1; i < attempts && d < multihopWatchdogMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > multihopWatchdogMaxBackoff {
+		d = multihopWatchdogMaxBackoff
+	}
+	return d
+}
+
+// restartMultihopHop rebuilds name's tun device and wireguard-go device in
+// place. On success its watchdog history is cleared (a clean restart earns
+// a clean slate); on failure checkMultihopWatchdogEntry records the
+// attempt against the still-registered old entry so the backoff keeps
+// growing across repeated failures instead of resetting every tick.
+func (s *State) restartMultihopHop(name string) error {
+	t, err := s.db.GetMultihopTunnel(name)
+	if err != nil {
+		return fmt.Errorf("lookup %s: %w", name, err)
+	}
+	if !t.Enabled {
+		return fmt.Errorf("%s is no longer enabled", name)
+	}
+
+	multihopRegistryMu.Lock()
+	old := multihopRegistry[name]
+	multihopRegistryMu.Unlock()
+
+	s.stopMultihopDevice(t)
+	if err := s.startMultihopDevice(t); err != nil {
+		// Put the closed old entry back so the watchdog keeps checking this
+		// hop and the caller can record the failed attempt on it.
+		multihopRegistryMu.Lock()
+		if _, ok := multihopRegistry[name]; !ok && old != nil {
+			multihopRegistry[name] = old
+		}
+		multihopRegistryMu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"wireguard-go-bridge/db"
+)
+
+// Netstack-backend Dial API and address derivation. State.InitNetstack
+// (and, after a restart, ServerConfig.Backend — see Start) select a
+// gVisor-backed tun.Device over a kernel one; DialTCP/DialUDP/ListenTCP let
+// a Python caller originate or accept connections inside the VPN through
+// that in-process stack without a host route, the same role
+// netstack.Net's own Dial/Listen methods play for bridge_netstack.go's
+// lower-level device handles.
+
+// DialTCP opens a TCP connection to addr (host:port) from inside the
+// netstack. Returns an error if the bridge isn't running in netstack mode.
+func (s *State) DialTCP(addr string) (net.Conn, error) {
+	s.mu.RLock()
+	tnet := s.netstackNet
+	s.mu.RUnlock()
+	if tnet == nil {
+		return nil, fmt.Errorf("netstack not active")
+	}
+	raddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", addr, err)
+	}
+	return tnet.DialTCP(raddr)
+}
+
+// DialUDP opens a UDP "connection" to addr (host:port) from inside the
+// netstack. Returns an error if the bridge isn't running in netstack mode.
+func (s *State) DialUDP(addr string) (net.Conn, error) {
+	s.mu.RLock()
+	tnet := s.netstackNet
+	s.mu.RUnlock()
+	if tnet == nil {
+		return nil, fmt.Errorf("netstack not active")
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", addr, err)
+	}
+	return tnet.DialUDP(nil, raddr)
+}
+
+// ListenTCP accepts inbound TCP connections on port from inside the
+// netstack. Returns an error if the bridge isn't running in netstack mode.
+func (s *State) ListenTCP(port int) (net.Listener, error) {
+	s.mu.RLock()
+	tnet := s.netstackNet
+	s.mu.RUnlock()
+	if tnet == nil {
+		return nil, fmt.Errorf("netstack not active")
+	}
+	return tnet.ListenTCP(&net.TCPAddr{Port: port})
+}
+
+// deriveNetstackAddrs reconstructs the netstack address list Start needs
+// when this process wasn't brought up via InitNetstack (e.g. a restart):
+// the same ".1" gateway address InitIPPool reserves out of Network, plus
+// its IPv6 counterpart if NetworkV6 is configured.
+func deriveNetstackAddrs(cfg *db.ServerConfig) ([]netip.Addr, error) {
+	addr, err := gatewayAddr(cfg.Network)
+	if err != nil {
+		return nil, fmt.Errorf("network: %w", err)
+	}
+	addrs := []netip.Addr{addr}
+
+	if cfg.NetworkV6 != "" {
+		addrV6, err := gatewayAddr(cfg.NetworkV6)
+		if err != nil {
+			return nil, fmt.Errorf("network_v6: %w", err)
+		}
+		addrs = append(addrs, addrV6)
+	}
+	return addrs, nil
+}
+
+// gatewayAddr returns the first host address in cidr (".1" for a v4 /24,
+// the analogous first address for v6) — the address this bridge's own
+// tunnel interface is conventionally given, matching expandSubnet's
+// reservation of it out of the client IP pool.
+func gatewayAddr(cidr string) (netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("parse %q: %w", cidr, err)
+	}
+	base := prefix.Masked().Addr()
+	next := base.Next()
+	if !prefix.Contains(next) {
+		return netip.Addr{}, fmt.Errorf("%q too small for a gateway address", cidr)
+	}
+	return next, nil
+}
+
+// multihopNetstackAddr derives a stable, unique local address for a
+// multihop tunnel's own netstack (used when the primary bridge is running
+// in netstack mode, so multihop tunnels don't need a kernel TUN either).
+// multihop_tunnels carries no routable address of its own — these tunnels
+// exist to reach a remote endpoint, not to accept inbound Dial calls — so
+// an address out of the CGNAT range (100.64.0.0/10, same block Tailscale
+// uses for its own unaddressed netstack links) is enough to satisfy
+// netstack.CreateNetTUN without claiming a real subnet.
+func multihopNetstackAddr(tunnelID int64) netip.Addr {
+	id := uint16(tunnelID)
+	return netip.AddrFrom4([4]byte{100, 64, byte(id >> 8), byte(id)})
+}
@@ -0,0 +1,392 @@
+package bridge
+
+import (
+	"crypto/mlkem"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"wireguard-go-bridge/core"
+)
+
+// PSK rotation kinds for EnablePSKRotation's kemAlgo parameter.
+const (
+	// PSKRotationStatic rotates to a fresh random preshared key each
+	// interval, via core.GeneratePresharedKey.
+	PSKRotationStatic = "static"
+	// PSKRotationMLKEM768 derives each interval's preshared key from an
+	// ML-KEM-768 key encapsulation against the peer's encapsulation key
+	// (set via SetPeerKEMKey), giving the rotation post-quantum forward
+	// secrecy instead of relying on this node's local RNG alone.
+	PSKRotationMLKEM768 = "ml-kem-768"
+)
+
+// pskRotation tracks one peer's PSK rotation schedule.
+type pskRotation struct {
+	pubKey   string
+	kemAlgo  string
+	interval time.Duration
+	epoch    uint64
+	stop     chan struct{}
+
+	// kemDK, ownEncapKeyB64 and peerEncapKeyB64 are only set for
+	// PSKRotationMLKEM768. ownEncapKeyB64 is this node's own encapsulation
+	// key, fetched via GetOwnKEMEncapKey and handed to the peer so it can
+	// encapsulate back. peerEncapKeyB64 must be supplied via SetPeerKEMKey
+	// before the first tick — a tick with no key set is skipped rather
+	// than erroring, since the caller may register the peer's key shortly
+	// after enabling rotation.
+	kemDK           *mlkem.DecapsulationKey768
+	ownEncapKeyB64  string
+	peerEncapKeyB64 string
+
+	// pendingCiphertextB64/pendingEpoch are the most recent ml-kem-768
+	// encapsulation's output, for GetPendingPSKCiphertext to hand the
+	// initiator — the epoch must travel with the ciphertext since it's
+	// folded into hkdfPSK's salt on both sides (see core.hkdfPSK); without
+	// it the responder has no way to reproduce the same salt the
+	// initiator used. hasPending is false until the first successful tick,
+	// so GetPendingPSKCiphertext can tell "not ticked yet" apart from a
+	// genuine epoch-0 ciphertext.
+	pendingCiphertextB64 string
+	pendingEpoch         uint64
+	hasPending           bool
+
+	// ticking is set once StartPSKRotationInitiator has started this
+	// rotation's goroutine, so a second call can't start a competing one.
+	ticking bool
+}
+
+// EnablePSKRotation registers pubKeyHex's preshared key rotation. kemAlgo is
+// PSKRotationStatic (rotate via a fresh random PSK) or PSKRotationMLKEM768
+// (derive the PSK from an ML-KEM-768 encapsulation against the peer's key,
+// set separately via SetPeerKEMKey).
+//
+// PSKRotationStatic starts ticking immediately — there's nothing to
+// negotiate, each tick just generates and installs a fresh random PSK.
+//
+// PSKRotationMLKEM768 does NOT start ticking here. Negotiation is: fetch
+// this node's own encapsulation key via GetOwnKEMEncapKey and hand it to
+// the peer, register the peer's encapsulation key here via SetPeerKEMKey,
+// and then exactly one side — the initiator — calls
+// StartPSKRotationInitiator to begin actually ticking; the other side (the
+// responder) only ever reacts to DecapsulatePeerPSK calls fed by whatever
+// the initiator sends over its own control channel via
+// GetPendingPSKCiphertext. See StartPSKRotationInitiator's doc comment for
+// why both sides ticking would break convergence. Carrying the
+// encapsulation keys and ciphertext/epoch pairs between nodes is the
+// caller's responsibility — this module only handles local key derivation
+// and device IPC, the same division SetBindOptions/GetBindStats draw
+// around conn.StdNetBind's actual capabilities.
+func (s *State) EnablePSKRotation(pubKeyHex string, intervalSec int, kemAlgo string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.requireRunning(); err != nil {
+		return err
+	}
+	if intervalSec <= 0 {
+		return fmt.Errorf("intervalSec must be positive")
+	}
+
+	var dk *mlkem.DecapsulationKey768
+	var ownEncapKeyB64 string
+	switch kemAlgo {
+	case PSKRotationStatic:
+	case PSKRotationMLKEM768:
+		var err error
+		dk, ownEncapKeyB64, err = core.NewMLKEM768DecapsulationKey()
+		if err != nil {
+			return fmt.Errorf("kem keygen: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown kemAlgo %q", kemAlgo)
+	}
+
+	s.pskRotationsMu.Lock()
+	if existing, ok := s.pskRotations[pubKeyHex]; ok {
+		close(existing.stop)
+	}
+	rot := &pskRotation{
+		pubKey:         pubKeyHex,
+		kemAlgo:        kemAlgo,
+		interval:       time.Duration(intervalSec) * time.Second,
+		stop:           make(chan struct{}),
+		kemDK:          dk,
+		ownEncapKeyB64: ownEncapKeyB64,
+	}
+	if s.pskRotations == nil {
+		s.pskRotations = make(map[string]*pskRotation)
+	}
+	s.pskRotations[pubKeyHex] = rot
+	s.pskRotationsMu.Unlock()
+
+	if kemAlgo == PSKRotationStatic {
+		go s.runPSKRotation(rot)
+	}
+	return nil
+}
+
+// StartPSKRotationInitiator begins actively ticking an already-registered
+// PSKRotationMLKEM768 rotation: each tick encapsulates a fresh PSK against
+// the peer's key (see SetPeerKEMKey), installs it locally, and stashes the
+// ciphertext/epoch pair for GetPendingPSKCiphertext so the caller can
+// deliver it to the peer's DecapsulatePeerPSK.
+//
+// Exactly one side of a pair should call this. If both sides did, each
+// would independently encapsulate and install its own PSK on its own
+// schedule — two different values, neither side the wiser, and the
+// handshake would simply stop completing. The responder instead stays
+// passive and only derives a PSK when it's fed a ciphertext via
+// DecapsulatePeerPSK, so only the initiator's schedule and randomness ever
+// produces a PSK for the pair.
+func (s *State) StartPSKRotationInitiator(pubKeyHex string) error {
+	s.pskRotationsMu.Lock()
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		s.pskRotationsMu.Unlock()
+		return fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	if rot.kemAlgo != PSKRotationMLKEM768 {
+		s.pskRotationsMu.Unlock()
+		return fmt.Errorf("PSK rotation for %s is not ml-kem-768", pubKeyHex)
+	}
+	if rot.ticking {
+		s.pskRotationsMu.Unlock()
+		return fmt.Errorf("PSK rotation for %s is already ticking", pubKeyHex)
+	}
+	rot.ticking = true
+	s.pskRotationsMu.Unlock()
+
+	go s.runPSKRotation(rot)
+	return nil
+}
+
+// DisablePSKRotation stops rotating pubKeyHex's preshared key, leaving
+// whatever PSK is currently installed in place.
+func (s *State) DisablePSKRotation(pubKeyHex string) error {
+	s.pskRotationsMu.Lock()
+	defer s.pskRotationsMu.Unlock()
+
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		return fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	close(rot.stop)
+	delete(s.pskRotations, pubKeyHex)
+	return nil
+}
+
+// SetPeerKEMKey registers pubKeyHex's peer's base64-encoded ML-KEM-768
+// encapsulation key, required before PSKRotationMLKEM768 rotation can
+// derive a PSK for that peer.
+func (s *State) SetPeerKEMKey(pubKeyHex, encapKeyB64 string) error {
+	s.pskRotationsMu.Lock()
+	defer s.pskRotationsMu.Unlock()
+
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		return fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	rot.peerEncapKeyB64 = encapKeyB64
+	return nil
+}
+
+// GetOwnKEMEncapKey returns this node's base64 ML-KEM-768 encapsulation
+// key for pubKeyHex's rotation, for the caller to deliver to the peer
+// (over the daemon's own control channel, same division EnablePSKRotation
+// documents) so the peer can encapsulate a PSK only this node's kemDK can
+// recover. Only meaningful for PSKRotationMLKEM768 rotations.
+func (s *State) GetOwnKEMEncapKey(pubKeyHex string) (string, error) {
+	s.pskRotationsMu.Lock()
+	defer s.pskRotationsMu.Unlock()
+
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		return "", fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	if rot.kemAlgo != PSKRotationMLKEM768 {
+		return "", fmt.Errorf("PSK rotation for %s is not ml-kem-768", pubKeyHex)
+	}
+	return rot.ownEncapKeyB64, nil
+}
+
+// pendingPSKCiphertext is GetPendingPSKCiphertext's JSON-marshaled result,
+// matching the bindStatsInfo/DeviceInfo convention of returning structured
+// FFI results as a JSON string rather than adding more getters per field.
+type pendingPSKCiphertext struct {
+	CiphertextB64 string `json:"ciphertext_b64"`
+	Epoch         uint64 `json:"epoch"`
+}
+
+// GetPendingPSKCiphertext returns the most recent tick's ML-KEM-768
+// ciphertext and the epoch it was encapsulated under, JSON-marshaled, for
+// the initiator side (see StartPSKRotationInitiator) to deliver to the
+// peer's DecapsulatePeerPSK over its own control channel — the same
+// division GetOwnKEMEncapKey draws for the encapsulation key itself. The
+// epoch must travel alongside the ciphertext: DecapsulatePeerPSK needs the
+// exact value the initiator salted hkdfPSK with to recover the same PSK.
+// Errors until the first tick has actually produced a ciphertext, rather
+// than returning a zero-value epoch-0 result indistinguishable from a real
+// one.
+func (s *State) GetPendingPSKCiphertext(pubKeyHex string) (string, error) {
+	s.pskRotationsMu.Lock()
+	defer s.pskRotationsMu.Unlock()
+
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		return "", fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	if rot.kemAlgo != PSKRotationMLKEM768 {
+		return "", fmt.Errorf("PSK rotation for %s is not ml-kem-768", pubKeyHex)
+	}
+	if !rot.hasPending {
+		return "", fmt.Errorf("PSK rotation for %s has not ticked yet", pubKeyHex)
+	}
+	b, err := json.Marshal(pendingPSKCiphertext{CiphertextB64: rot.pendingCiphertextB64, Epoch: rot.pendingEpoch})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// GetPSKEpoch returns how many times pubKeyHex's preshared key has been
+// rotated since EnablePSKRotation was called.
+func (s *State) GetPSKEpoch(pubKeyHex string) (uint64, error) {
+	s.pskRotationsMu.Lock()
+	defer s.pskRotationsMu.Unlock()
+
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		return 0, fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	return rot.epoch, nil
+}
+
+// runPSKRotation is the per-peer rotation goroutine started by
+// EnablePSKRotation. It runs until Disabled or its stop channel is closed.
+func (s *State) runPSKRotation(rot *pskRotation) {
+	ticker := time.NewTicker(rot.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rot.stop:
+			return
+		case <-ticker.C:
+			s.rotatePeerPSK(rot)
+		}
+	}
+}
+
+// rotatePeerPSK derives the next PSK for rot under its current epoch,
+// pushes it to the live device via IPC, persists it to bridge-db, and
+// advances rot.epoch. Only ever called for the initiator side — either
+// directly (PSKRotationStatic) or via StartPSKRotationInitiator
+// (PSKRotationMLKEM768).
+func (s *State) rotatePeerPSK(rot *pskRotation) {
+	s.pskRotationsMu.Lock()
+	epoch := rot.epoch
+	s.pskRotationsMu.Unlock()
+
+	var psk string
+	var err error
+
+	switch rot.kemAlgo {
+	case PSKRotationStatic:
+		psk, err = core.GeneratePresharedKey()
+	case PSKRotationMLKEM768:
+		s.pskRotationsMu.Lock()
+		encapKey := rot.peerEncapKeyB64
+		s.pskRotationsMu.Unlock()
+		if encapKey == "" {
+			return // peer key not registered yet — skip this tick
+		}
+		var ciphertextB64 string
+		psk, ciphertextB64, err = core.EncapsulateMLKEM768PSK(encapKey, epoch)
+		if err == nil {
+			s.pskRotationsMu.Lock()
+			rot.pendingCiphertextB64 = ciphertextB64
+			rot.pendingEpoch = epoch
+			rot.hasPending = true
+			s.pskRotationsMu.Unlock()
+		}
+	}
+	if err != nil {
+		return
+	}
+	s.installRotatedPSK(rot, psk, epoch)
+}
+
+// DecapsulatePeerPSK completes an "ml-kem-768" rotation on the responding
+// side: it decapsulates ciphertextB64 (encapsulated by the initiator
+// against the encapsulation key GetOwnKEMEncapKey returned) with rot.kemDK
+// under epoch — the exact value the initiator salted hkdfPSK with, carried
+// alongside the ciphertext by GetPendingPSKCiphertext, since the responder
+// has no ticker of its own to derive it from — recovering the same
+// preshared key the initiator derived via EncapsulateMLKEM768PSK, then
+// installs and persists it exactly like a normal rotation tick so both
+// sides converge on one PSK per epoch.
+//
+// epoch must not be older than the epoch this rotation is already on — the
+// initiator's ticks and this node's control channel aren't guaranteed to
+// deliver in order, and silently accepting a stale ciphertext would roll
+// the installed PSK backward to one the initiator has already moved past.
+func (s *State) DecapsulatePeerPSK(pubKeyHex, ciphertextB64 string, epoch uint64) error {
+	s.pskRotationsMu.Lock()
+	rot, ok := s.pskRotations[pubKeyHex]
+	if !ok {
+		s.pskRotationsMu.Unlock()
+		return fmt.Errorf("no PSK rotation registered for %s", pubKeyHex)
+	}
+	if rot.kemAlgo != PSKRotationMLKEM768 {
+		s.pskRotationsMu.Unlock()
+		return fmt.Errorf("PSK rotation for %s is not ml-kem-768", pubKeyHex)
+	}
+	if epoch < rot.epoch {
+		s.pskRotationsMu.Unlock()
+		return fmt.Errorf("stale epoch %d for %s: already at epoch %d", epoch, pubKeyHex, rot.epoch)
+	}
+	dk := rot.kemDK
+	s.pskRotationsMu.Unlock()
+
+	psk, err := core.DecapsulateMLKEM768PSK(dk, ciphertextB64, epoch)
+	if err != nil {
+		return fmt.Errorf("decapsulate: %w", err)
+	}
+	s.installRotatedPSK(rot, psk, epoch)
+	return nil
+}
+
+// installRotatedPSK pushes psk to the live device via IPC, persists it to
+// bridge-db, and sets rot.epoch to epoch+1 — the common tail shared by
+// both a normal rotation tick (rotatePeerPSK) and the ml-kem-768 responder
+// side (DecapsulatePeerPSK). epoch is the epoch psk was derived under
+// (rather than blindly incrementing whatever rot.epoch currently holds),
+// so the responder's counter tracks the initiator's instead of advancing
+// on its own — GetPSKEpoch stays meaningful on both sides.
+func (s *State) installRotatedPSK(rot *pskRotation, psk string, epoch uint64) {
+	s.mu.Lock()
+	if s.dev != nil {
+		ipcConfig := fmt.Sprintf("public_key=%s\npreshared_key=%s\n", rot.pubKey, psk)
+		_ = s.dev.IpcSet(ipcConfig)
+	}
+	s.mu.Unlock()
+
+	_ = s.db.SetPresharedKey(rot.pubKey, psk)
+
+	s.pskRotationsMu.Lock()
+	rot.epoch = epoch + 1
+	s.pskRotationsMu.Unlock()
+}
+
+// stopAllPSKRotations stops every registered PSK rotation goroutine.
+// Called from closeInternal/Stop so device teardown doesn't leak them.
+func (s *State) stopAllPSKRotations() {
+	s.pskRotationsMu.Lock()
+	defer s.pskRotationsMu.Unlock()
+	for pubKey, rot := range s.pskRotations {
+		close(rot.stop)
+		delete(s.pskRotations, pubKey)
+	}
+}
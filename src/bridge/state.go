@@ -3,15 +3,20 @@ package bridge
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.zx2c4.com/wireguard/conn"
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
 
 	"wireguard-go-bridge/core"
 	"wireguard-go-bridge/db"
+	"wireguard-go-bridge/events"
 )
 
 // Status represents the lifecycle state of the bridge.
@@ -20,33 +25,117 @@ type Status string
 const (
 	StatusUninitialized Status = "uninitialized" // BridgeInit not called
 	StatusNeedsSetup    Status = "needs_setup"   // DB exists but server_config empty
-	StatusReady         Status = "ready"          // Configured, not started
-	StatusRunning       Status = "running"        // Device up, peers active
-	StatusError         Status = "error"          // Something failed
+	StatusReady         Status = "ready"         // Configured, not started
+	StatusRunning       Status = "running"       // Device up, peers active
+	StatusError         Status = "error"         // Something failed
 )
 
 // State manages the bridge-db backed WireGuard device.
 // This is the high-level API — single source of truth for client state.
 type State struct {
-	mu          sync.RWMutex
-	db          *db.BridgeDB
-	dev         *device.Device
-	tunDev      tun.Device
-	logger      *device.Logger
-	statsSyncer *db.StatsSyncer
-	ifname      string
-	status      Status
-	lastError   string
+	mu                  sync.RWMutex
+	db                  *db.BridgeDB
+	dev                 *device.Device
+	tunDev              tun.Device
+	logger              *device.Logger
+	statsSyncer         *db.StatsSyncer
+	statsEventCh        chan db.PeerEvent
+	multihopStatsSyncer *db.MultihopStatsSyncer
+	ifname              string
+	status              Status
+	lastError           string
+
+	// netstackAddrs, when non-empty, makes Start() bring the device up on a
+	// gVisor netstack instead of a kernel TUN (no root/CAP_NET_ADMIN needed).
+	// netstackNet is the resulting in-process network stack, set by Start().
+	netstackAddrs []netip.Addr
+	netstackNet   *netstack.Net
+
+	// bindOptions records the caller's requested GSO/sticky-socket/buffer
+	// preferences for SetBindOptions/GetBindStats. See their doc comments —
+	// conn.StdNetBind does not expose a runtime switch for these, so they
+	// are recorded for diagnostics rather than actually enforced.
+	bindOptions bindOptions
+
+	// pskRotations tracks active per-peer PSK rotation schedules, keyed by
+	// peer public key hex. See psk_rotation.go.
+	pskRotationsMu sync.Mutex
+	pskRotations   map[string]*pskRotation
+
+	// Lazy-peer layer — see lazy_peers.go and SetLazyPeers.
+	lazyMu          sync.Mutex
+	lazyEnabled     bool
+	lazyIdleTimeout time.Duration
+	activePeers     map[string]time.Time
+	lazyStop        chan struct{}
+	lazyWG          sync.WaitGroup
+
+	// filter enforces per-peer stateful ACL rules on the primary and
+	// multihop tun.Devices — see filter.go and SetPeerACL.
+	filter *Filter
+
+	// Network change monitor — see linkmon.go. linkMonStop is non-nil
+	// while StartLinkMonitor's goroutines are running.
+	linkMonStop     chan struct{}
+	linkMonWG       sync.WaitGroup
+	linkChangeCount int64
+	eventsCh        chan events.Event
+
+	// Multihop per-hop stats poller — see multihop_stats.go. hopStatsStop
+	// is non-nil while StartMultihopHopStatsPoll's goroutine is running.
+	hopStatsStop chan struct{}
+	hopStatsWG   sync.WaitGroup
+
+	// Multihop failover selector — see multihop_failover.go. failoverStop
+	// is non-nil while StartMultihopFailover's goroutine is running.
+	failoverStop chan struct{}
+	failoverWG   sync.WaitGroup
+
+	// Multihop handshake watchdog — see multihop_watchdog.go. watchdogStop
+	// is non-nil while StartMultihopWatchdog's goroutine is running.
+	watchdogStop chan struct{}
+	watchdogWG   sync.WaitGroup
+
+	// Multihop PMTU prober — see multihop_mtu.go. mtuProbeStop is non-nil
+	// while StartMultihopMTUProbe's goroutine is running.
+	mtuProbeStop chan struct{}
+	mtuProbeWG   sync.WaitGroup
+
+	// Multihop pong health-check poller — see multihop_pong.go.
+	// pongPollStop is non-nil while StartMultihopPongPoll's goroutine is
+	// running.
+	pongPollStop chan struct{}
+	pongPollWG   sync.WaitGroup
 }
 
+// bindOptions is the caller-requested bind tuning recorded by
+// State.SetBindOptions and surfaced by State.GetBindStats.
+type bindOptions struct {
+	GSOEnabled    bool `json:"gso_enabled_requested"`
+	StickySockets bool `json:"sticky_sockets_requested"`
+	SndBuf        int  `json:"snd_buf_requested"`
+	RcvBuf        int  `json:"rcv_buf_requested"`
+}
+
+// Bind option flag bits for SetBindOptions' flags parameter.
+const (
+	BindFlagGSO           = 1 << 0
+	BindFlagStickySockets = 1 << 1
+)
+
 // StatusInfo holds the full bridge status for Python to read.
 type StatusInfo struct {
-	Status     Status `json:"status"`
-	Error      string       `json:"error,omitempty"`
-	HasDevice  bool         `json:"has_device"`
-	HasConfig  bool         `json:"has_config"`
-	PeerCount  int          `json:"peer_count"`
-	MultihopCount int       `json:"multihop_count"`
+	Status        Status        `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	HasDevice     bool          `json:"has_device"`
+	HasConfig     bool          `json:"has_config"`
+	PeerCount     int           `json:"peer_count"`
+	MultihopCount int           `json:"multihop_count"`
+	Captures      []CaptureStat `json:"captures,omitempty"`
+
+	// LinkChangeCount counts how many times the network change monitor
+	// (see linkmon.go) has triggered a rebind since this State was created.
+	LinkChangeCount int64 `json:"link_change_count,omitempty"`
 }
 
 // DeviceInfo holds device metadata returned by GetDeviceInfo.
@@ -60,24 +149,56 @@ type DeviceInfo struct {
 
 // New creates an uninitialized State.
 func New() *State {
-	return &State{status: StatusUninitialized}
+	return &State{status: StatusUninitialized, activePeers: make(map[string]time.Time)}
 }
 
 // Init opens bridge-db, determines state, and prepares the bridge.
 // If DB is fresh (no device record), status = needs_setup.
 // If DB has device + server_config, status = ready (can Start).
 // Device is NOT created here — Start() creates and configures the device.
-func (s *State) Init(dbPath, ifname string, listenPort, logLevel int) error {
+//
+// backend selects the bridge-db storage engine ("sqlite" or "postgres").
+// It is ignored if dbPath already carries a "scheme://" prefix; an empty
+// backend defaults to "sqlite", preserving plain-file-path behavior.
+func (s *State) Init(dbPath, ifname string, listenPort, logLevel int, backend string) error {
+	return s.initInternal(dbPath, ifname, listenPort, logLevel, backend, "")
+}
+
+// InitNetstack is the userspace-TUN counterpart of Init: it brings the
+// bridge up the same way, but Start() creates the device on an in-process
+// gVisor netstack bound to localAddrsCSV (comma-separated IPs, e.g.
+// "10.8.0.1,fd00::1") instead of a kernel TUN. Useful for embedders that
+// cannot obtain CAP_NET_ADMIN (mobile/sandboxed integrations).
+func (s *State) InitNetstack(dbPath, ifname string, listenPort, logLevel int, backend, localAddrsCSV string) error {
+	return s.initInternal(dbPath, ifname, listenPort, logLevel, backend, localAddrsCSV)
+}
+
+func (s *State) initInternal(dbPath, ifname string, listenPort, logLevel int, backend, netstackAddrsCSV string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	var netstackAddrs []netip.Addr
+	if netstackAddrsCSV != "" {
+		var err error
+		netstackAddrs, err = parseNetstackAddrs(netstackAddrsCSV)
+		if err != nil {
+			return fmt.Errorf("netstack addrs: %w", err)
+		}
+	}
+
 	// Auto-close previous state if re-initializing (singleton reset)
 	if s.status != StatusUninitialized {
 		s.closeInternal()
 	}
+	s.netstackAddrs = netstackAddrs
+	s.netstackNet = nil
+
+	dsn := dbPath
+	if backend != "" && !strings.Contains(dbPath, "://") {
+		dsn = backend + "://" + dbPath
+	}
 
-	// Open SQLite
-	database, err := db.Open(dbPath)
+	database, err := db.Open(dsn)
 	if err != nil {
 		s.status = StatusError
 		s.lastError = err.Error()
@@ -87,6 +208,7 @@ func (s *State) Init(dbPath, ifname string, listenPort, logLevel int) error {
 	s.db = database
 	s.ifname = ifname
 	s.logger = newCallbackLogger(logLevel, "("+ifname+") ")
+	s.filter = NewFilter(database, s.publishStatsEvent)
 
 	// Clear stale runtime state from previous crash
 	_ = database.ClearRuntimeState()
@@ -145,6 +267,11 @@ func (s *State) Setup(endpoint, network, dnsPrimary, dnsSecondary string, mtu, f
 		mtu = 1420
 	}
 
+	backend := db.BackendTUN
+	if len(s.netstackAddrs) > 0 {
+		backend = db.BackendNetstack
+	}
+
 	cfg := &db.ServerConfig{
 		DeviceID:     1,
 		Endpoint:     endpoint,
@@ -153,6 +280,7 @@ func (s *State) Setup(endpoint, network, dnsPrimary, dnsSecondary string, mtu, f
 		DNSSecondary: dnsSecondary,
 		MTU:          mtu,
 		FWMark:       fwmark,
+		Backend:      backend,
 	}
 	if err := s.db.UpsertServerConfig(cfg); err != nil {
 		return fmt.Errorf("save config: %w", err)
@@ -186,19 +314,63 @@ func (s *State) Close() error {
 
 // closeInternal performs cleanup without locking (caller must hold mu).
 func (s *State) closeInternal() {
-	if s.statsSyncer != nil {
-		s.statsSyncer.Stop()
-		s.statsSyncer = nil
+	s.stopStatsSyncLocked()
+	s.stopAllPSKRotations()
+	if s.linkMonStop != nil {
+		// Signal only, no Wait: the monitor goroutines call back into
+		// s.mu (see onLinkChange), which this caller already holds.
+		close(s.linkMonStop)
+		s.linkMonStop = nil
+	}
+	if s.multihopStatsSyncer != nil {
+		s.multihopStatsSyncer.Stop()
+		s.multihopStatsSyncer = nil
+	}
+	if s.hopStatsStop != nil {
+		close(s.hopStatsStop)
+		s.hopStatsStop = nil
+		s.hopStatsWG.Wait()
+	}
+	if s.failoverStop != nil {
+		close(s.failoverStop)
+		s.failoverStop = nil
+		s.failoverWG.Wait()
+	}
+	if s.watchdogStop != nil {
+		close(s.watchdogStop)
+		s.watchdogStop = nil
+		s.watchdogWG.Wait()
+	}
+	if s.mtuProbeStop != nil {
+		close(s.mtuProbeStop)
+		s.mtuProbeStop = nil
+		s.mtuProbeWG.Wait()
+	}
+	if s.pongPollStop != nil {
+		close(s.pongPollStop)
+		s.pongPollStop = nil
+		s.pongPollWG.Wait()
 	}
 
 	// Close all multihop devices
 	multihopRegistryMu.Lock()
 	for name, entry := range multihopRegistry {
 		entry.device.Close()
+		if entry.pongServer != nil {
+			_ = entry.pongServer.Close()
+		}
 		delete(multihopRegistry, name)
 	}
 	multihopRegistryMu.Unlock()
 
+	// Close all active chains
+	chainRegistryMu.Lock()
+	for handle, mgr := range chainRegistry {
+		mgr.Down()
+		delete(chainRegistry, handle)
+	}
+	chainRegistryMu.Unlock()
+
 	if s.db != nil {
 		_ = s.db.ClearRuntimeState()
 		_ = s.db.ClearMultihopRuntimeState()
@@ -209,10 +381,18 @@ func (s *State) closeInternal() {
 		s.dev.Close()
 		s.dev = nil
 	}
+	s.netstackNet = nil
+	if s.ifname != "" {
+		unregisterCaptureHub(s.ifname)
+	}
 	if s.db != nil {
 		_ = s.db.Close()
 		s.db = nil
 	}
+	if s.filter != nil {
+		s.filter.Close()
+		s.filter = nil
+	}
 
 	s.status = StatusUninitialized
 	s.lastError = ""
@@ -243,19 +423,55 @@ func (s *State) Start() error {
 		return fmt.Errorf("read server config: %w", err)
 	}
 
-	// Create TUN + WireGuard device
-	tunDev, err := tun.CreateTUN(s.ifname, serverCfg.MTU)
-	if err != nil {
-		s.setError("tun create: " + err.Error())
-		return fmt.Errorf("tun: %w", err)
+	// Create TUN + WireGuard device. netstackAddrs selects an in-process
+	// gVisor netstack over a kernel TUN. If this process wasn't brought up
+	// through InitNetstack (e.g. a restart by a caller that just calls
+	// Init/Start again), fall back to the backend persisted on ServerConfig
+	// by Setup, deriving the netstack's own address from Network/NetworkV6
+	// the same way the IP pool reserves the ".1" gateway address.
+	netstackAddrs := s.netstackAddrs
+	if len(netstackAddrs) == 0 && serverCfg.Backend == db.BackendNetstack {
+		netstackAddrs, err = deriveNetstackAddrs(serverCfg)
+		if err != nil {
+			s.setError("derive netstack addrs: " + err.Error())
+			return fmt.Errorf("derive netstack addrs: %w", err)
+		}
+	}
+
+	var tunDev tun.Device
+	var tnet *netstack.Net
+	if len(netstackAddrs) > 0 {
+		tunDev, tnet, err = netstack.CreateNetTUN(netstackAddrs, nil, serverCfg.MTU)
+		if err != nil {
+			s.setError("netstack create: " + err.Error())
+			return fmt.Errorf("netstack: %w", err)
+		}
+	} else {
+		tunDev, err = tun.CreateTUN(s.ifname, serverCfg.MTU)
+		if err != nil {
+			s.setError("tun create: " + err.Error())
+			return fmt.Errorf("tun: %w", err)
+		}
+	}
+
+	tunDev = &captureTap{Device: tunDev, hub: registerCaptureHub(s.ifname)}
+
+	s.lazyMu.Lock()
+	lazyEnabled := s.lazyEnabled
+	s.lazyMu.Unlock()
+	if lazyEnabled {
+		tunDev = &lazyTUN{Device: tunDev, state: s}
 	}
 
+	tunDev = &filterTap{Device: tunDev, filter: s.filter, db: s.db}
+
 	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), s.logger)
 	if dev == nil {
 		_ = tunDev.Close()
 		s.setError("device create failed")
 		return fmt.Errorf("device create failed")
 	}
+	s.netstackNet = tnet
 
 	// Configure device via IPC from DB state
 	ipcConfig := fmt.Sprintf("private_key=%s\nlisten_port=%d\n", devRec.PrivateKey, devRec.ListenPort)
@@ -281,16 +497,22 @@ func (s *State) Start() error {
 	now := time.Now().Unix()
 	_ = s.db.SetDeviceStartedAt(&now)
 
-	// Restore enabled peers from DB
+	// Restore enabled peers from DB. In lazy mode, only pinned peers are
+	// configured eagerly — the rest hydrate on first observed traffic (see
+	// lazyTUN.Read) or get added explicitly via EnableClient.
 	clients, err := s.db.EnabledClients()
 	if err == nil {
 		for _, c := range clients {
+			if lazyEnabled && !c.Pinned {
+				continue
+			}
 			s.addPeerToDevice(c)
 		}
 	}
 
 	// Restore enabled multihop tunnels (crash recovery)
 	s.restoreMultihopTunnels()
+	s.restoreActiveChain()
 
 	s.status = StatusRunning
 	s.lastError = ""
@@ -311,6 +533,12 @@ func (s *State) Stop() error {
 		s.dev.Close()
 		s.dev = nil
 	}
+	s.netstackNet = nil
+	unregisterCaptureHub(s.ifname)
+
+	s.lazyMu.Lock()
+	s.activePeers = make(map[string]time.Time)
+	s.lazyMu.Unlock()
 
 	_ = s.db.ClearRuntimeState()
 	_ = s.db.ClearMultihopRuntimeState()
@@ -350,9 +578,9 @@ func (s *State) AddClient(allowedIP string) (string, error) {
 	rec := &db.ClientRecord{
 		PublicKey:    pubKey,
 		PresharedKey: psk,
-		PrivateKey:  privKey,
-		AllowedIP:   allowedIP, // may be empty, will be set below
-		Keepalive:   25,
+		PrivateKey:   privKey,
+		AllowedIP:    allowedIP, // may be empty, will be set below
+		Keepalive:    25,
 	}
 
 	// Temporary insert to get ID (AllowedIP filled after allocation)
@@ -413,12 +641,16 @@ func (s *State) RemoveClient(pubKeyHex string) error {
 	// Remove from device
 	config := fmt.Sprintf("public_key=%s\nremove=true\n", pubKeyHex)
 	_ = s.dev.IpcSet(config)
+	s.clearPeerActive(pubKeyHex)
 
 	// Delete from DB
 	return s.db.DeleteClient(pubKeyHex)
 }
 
-// EnableClient re-adds peer to device and sets enabled=1 in bridge-db.
+// EnableClient re-adds peer to device and sets enabled=1 in bridge-db. This
+// is an explicit operator action, so the peer is always configured
+// immediately even in lazy mode — it's just as eligible for the idle
+// reaper afterward as a peer hydrated by traffic, unless it's pinned.
 func (s *State) EnableClient(pubKeyHex string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -433,6 +665,15 @@ func (s *State) EnableClient(pubKeyHex string) error {
 	}
 
 	s.addPeerToDevice(*client)
+	if !client.Pinned {
+		// The peer is already configured above, so it's recorded as active
+		// directly: markPeerActive could reach hydratePeer, which takes s.mu.
+		s.lazyMu.Lock()
+		if s.lazyEnabled {
+			s.activePeers[pubKeyHex] = time.Now()
+		}
+		s.lazyMu.Unlock()
+	}
 	return s.db.SetEnabled(pubKeyHex, true)
 }
 
@@ -447,6 +688,7 @@ func (s *State) DisableClient(pubKeyHex string) error {
 
 	config := fmt.Sprintf("public_key=%s\nremove=true\n", pubKeyHex)
 	_ = s.dev.IpcSet(config)
+	s.clearPeerActive(pubKeyHex)
 
 	return s.db.SetEnabled(pubKeyHex, false)
 }
@@ -467,6 +709,23 @@ func (s *State) GetClient(pubKeyHex string) (string, error) {
 	return client.ToJSON(), nil
 }
 
+// GetPeerHealth returns a peer's current connection-health snapshot plus its
+// rolling history as JSON, for the Python daemon's status UI.
+func (s *State) GetPeerHealth(pubKeyHex string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.status == StatusUninitialized {
+		return "", fmt.Errorf("not initialized")
+	}
+
+	report, err := s.db.GetPeerHealth(pubKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return report.ToJSON(), nil
+}
+
 // ListClients returns paginated client list as JSON.
 func (s *State) ListClients(page, limit int) (string, error) {
 	s.mu.RLock()
@@ -608,6 +867,138 @@ func (s *State) SetServerConfig(configJSON string) error {
 	return s.db.UpsertServerConfig(&cfg)
 }
 
+// SetBindOptions records GSO/sticky-socket/buffer-size preferences for the
+// bridge's device bind.
+//
+// NOTE: upstream wireguard-go's conn.StdNetBind (gso_linux.go,
+// sticky_linux.go) auto-detects UDP GSO/GRO and sticky-source support per
+// socket and silently falls back on error; it exposes neither a runtime
+// on/off switch nor the underlying fd needed to set SO_SNDBUF/SO_RCVBUF.
+// This call cannot change StdNetBind's actual behavior — it records what
+// was requested so GetBindStats can report it for debugging.
+func (s *State) SetBindOptions(flags, sndBuf, rcvBuf int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return fmt.Errorf("not initialized")
+	}
+	s.bindOptions = bindOptions{
+		GSOEnabled:    flags&BindFlagGSO != 0,
+		StickySockets: flags&BindFlagStickySockets != 0,
+		SndBuf:        sndBuf,
+		RcvBuf:        rcvBuf,
+	}
+	return nil
+}
+
+// bindStatsInfo is the JSON shape returned by GetBindStats.
+type bindStatsInfo struct {
+	bindOptions
+	BatchSize int `json:"batch_size"`
+}
+
+// GetBindStats returns the requested bind options plus the device's actual
+// current batch size (the one bind-tuning signal StdNetBind does expose).
+func (s *State) GetBindStats() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.status == StatusUninitialized {
+		return "", fmt.Errorf("not initialized")
+	}
+
+	info := bindStatsInfo{bindOptions: s.bindOptions}
+	if s.dev != nil {
+		info.BatchSize = s.dev.BatchSize()
+	}
+	b, _ := json.Marshal(info)
+	return string(b), nil
+}
+
+// publishStatsEvent forwards ev to the running StatsSyncer's subscribers,
+// if stats sync is currently on. Passed to NewFilter so its counter
+// flusher can publish EventACLDrop the same way a stats tick publishes
+// EventQuotaExceeded, without the filter package depending on State.
+func (s *State) publishStatsEvent(ev db.PeerEvent) {
+	s.mu.RLock()
+	syncer := s.statsSyncer
+	s.mu.RUnlock()
+	if syncer != nil {
+		syncer.Publish(ev)
+	}
+}
+
+// SetPeerACL replaces pubKey's stateful-filter rules with the ones
+// decoded from jsonRules (a JSON array of db.PeerACL). An empty array (or
+// "[]") clears the peer's rules, restoring the default allow-all policy.
+func (s *State) SetPeerACL(pubKey string, jsonRules string) error {
+	s.mu.RLock()
+	database := s.db
+	filter := s.filter
+	s.mu.RUnlock()
+	if database == nil {
+		return fmt.Errorf("not initialized")
+	}
+
+	var rules []db.PeerACL
+	if err := json.Unmarshal([]byte(jsonRules), &rules); err != nil {
+		return fmt.Errorf("decode acl rules: %w", err)
+	}
+
+	client, err := database.GetClient(pubKey)
+	if err != nil {
+		return fmt.Errorf("unknown peer %s: %w", pubKey, err)
+	}
+
+	if err := database.ReplacePeerACLs(client.ID, rules); err != nil {
+		return err
+	}
+	if filter != nil {
+		filter.Reload(pubKey, rules)
+	}
+	return nil
+}
+
+// GetPeerACL returns pubKey's stateful-filter rules as a JSON array.
+func (s *State) GetPeerACL(pubKey string) (string, error) {
+	s.mu.RLock()
+	database := s.db
+	s.mu.RUnlock()
+	if database == nil {
+		return "", fmt.Errorf("not initialized")
+	}
+
+	client, err := database.GetClient(pubKey)
+	if err != nil {
+		return "", fmt.Errorf("unknown peer %s: %w", pubKey, err)
+	}
+	rules, err := database.ListPeerACLs(client.ID)
+	if err != nil {
+		return "", err
+	}
+	b, _ := json.Marshal(rules)
+	return string(b), nil
+}
+
+// ListPeerACLs returns every peer's stateful-filter rules as a JSON
+// object keyed by public key.
+func (s *State) ListPeerACLs() (string, error) {
+	s.mu.RLock()
+	database := s.db
+	s.mu.RUnlock()
+	if database == nil {
+		return "", fmt.Errorf("not initialized")
+	}
+
+	rules, err := database.ListAllPeerACLs()
+	if err != nil {
+		return "", err
+	}
+	b, _ := json.Marshal(rules)
+	return string(b), nil
+}
+
 // StartStatsSync starts the background stats synchronization goroutine.
 func (s *State) StartStatsSync(intervalSec int) error {
 	s.mu.Lock()
@@ -624,6 +1015,22 @@ func (s *State) StartStatsSync(intervalSec int) error {
 		return s.dev.IpcGet()
 	}
 	s.statsSyncer = db.NewStatsSyncer(s.db, ipcGetFn, intervalSec)
+
+	s.statsEventCh = make(chan db.PeerEvent, 64)
+	s.statsSyncer.Subscribe(s.statsEventCh)
+	go func(ch <-chan db.PeerEvent) {
+		for ev := range ch {
+			emitStatsEvent(ev)
+			emitPeerEvent(ev)
+			// Any event implies IpcGet saw fresh activity for this peer —
+			// the lazy-peer reaper's lastActive signal (see lazy_peers.go).
+			s.markPeerActive(ev.PublicKey)
+			if ev.Kind == db.EventQuotaExceeded {
+				emitLog(1, fmt.Sprintf("peer %s exceeded quota (%s/%s bytes)", ev.PublicKey, ev.New, ev.Old))
+			}
+		}
+	}(s.statsEventCh)
+
 	s.statsSyncer.Start()
 	return nil
 }
@@ -633,14 +1040,79 @@ func (s *State) StopStatsSync() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.stopStatsSyncLocked()
+	return nil
+}
+
+// stopStatsSyncLocked stops the stats syncer and its event-forwarding
+// goroutine. Caller must hold s.mu.
+func (s *State) stopStatsSyncLocked() {
 	if s.statsSyncer == nil {
-		return nil
+		return
 	}
 	s.statsSyncer.Stop()
 	s.statsSyncer = nil
+	close(s.statsEventCh)
+	s.statsEventCh = nil
+}
+
+// NotifyStatsSync requests an immediate out-of-band stats sync pass, e.g.
+// after a peer add/remove that should be reflected without waiting for the
+// next tick.
+func (s *State) NotifyStatsSync() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.statsSyncer != nil {
+		s.statsSyncer.Notify()
+	}
+}
+
+// StartMultihopStatsSync starts background polling of each running
+// multihop tunnel's own device for upstream rx/tx/last_handshake.
+func (s *State) StartMultihopStatsSync(intervalSec int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return fmt.Errorf("not initialized")
+	}
+	if s.multihopStatsSyncer != nil {
+		return fmt.Errorf("multihop stats already running")
+	}
+
+	s.multihopStatsSyncer = db.NewMultihopStatsSyncer(s.db, listMultihopIpcGetFns, intervalSec)
+	s.multihopStatsSyncer.Start()
+	return nil
+}
+
+// StopMultihopStatsSync stops the background multihop stats polling.
+func (s *State) StopMultihopStatsSync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.multihopStatsSyncer == nil {
+		return nil
+	}
+	s.multihopStatsSyncer.Stop()
+	s.multihopStatsSyncer = nil
 	return nil
 }
 
+// listMultihopIpcGetFns snapshots the live multihop registry into a
+// name -> IpcGet map for MultihopStatsSyncer to poll.
+func listMultihopIpcGetFns() map[string]func() (string, error) {
+	multihopRegistryMu.Lock()
+	defer multihopRegistryMu.Unlock()
+
+	fns := make(map[string]func() (string, error), len(multihopRegistry))
+	for name, entry := range multihopRegistry {
+		dev := entry.device
+		fns[name] = func() (string, error) { return dev.IpcGet() }
+	}
+	return fns
+}
+
 // GetDeviceInfo returns device metadata as JSON.
 func (s *State) GetDeviceInfo() (string, error) {
 	s.mu.RLock()
@@ -681,8 +1153,9 @@ func (s *State) GetStatus() string {
 	defer s.mu.RUnlock()
 
 	info := StatusInfo{
-		Status: s.status,
-		Error:  s.lastError,
+		Status:          s.status,
+		Error:           s.lastError,
+		LinkChangeCount: s.linkChangeCount,
 	}
 
 	if s.db != nil {
@@ -699,6 +1172,7 @@ func (s *State) GetStatus() string {
 			info.MultihopCount = len(tunnels)
 		}
 	}
+	info.Captures = captureStats()
 
 	b, _ := json.Marshal(info)
 	return string(b)
@@ -716,6 +1190,23 @@ func (s *State) requireRunning() error {
 	return nil
 }
 
+// parseNetstackAddrs parses a comma-separated list of IPs for InitNetstack.
+func parseNetstackAddrs(csv string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, part := range strings.Split(csv, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", part, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
 // ============================================================================
 // Multihop Tunnel Lifecycle
 // ============================================================================
@@ -882,6 +1373,14 @@ func (s *State) GetMultihopTunnel(name string) (string, error) {
 
 // addPeerToDevice configures a peer on the WireGuard device via IPC.
 func (s *State) addPeerToDevice(c db.ClientRecord) {
+	configurePeerOnDevice(s.dev, c)
+}
+
+// configurePeerOnDevice is addPeerToDevice's underlying IPC call, split out
+// so lazy_peers.go's hydration path (which doesn't hold s.mu while it
+// resolves s.dev) can apply it against an explicitly-captured device
+// handle instead of through a State method.
+func configurePeerOnDevice(dev *device.Device, c db.ClientRecord) {
 	config := fmt.Sprintf(
 		"public_key=%s\npreshared_key=%s\nallowed_ip=%s\npersistent_keepalive_interval=%d\n",
 		c.PublicKey, c.PresharedKey, c.AllowedIP, c.Keepalive,
@@ -889,7 +1388,7 @@ func (s *State) addPeerToDevice(c db.ClientRecord) {
 	if c.AllowedIPv6 != "" {
 		config += fmt.Sprintf("allowed_ip=%s\n", c.AllowedIPv6)
 	}
-	_ = s.dev.IpcSet(config)
+	_ = dev.IpcSet(config)
 }
 
 // restoreMultihopTunnels restores all enabled multihop tunnels.
@@ -914,15 +1413,30 @@ func (s *State) restoreMultihopTunnels() {
 }
 
 // startMultihopDevice creates a TUN device, configures WireGuard,
-// and adds the remote peer for a multihop tunnel.
+// and adds the remote peer for a multihop tunnel. If the primary bridge is
+// running in netstack mode, the tunnel gets its own in-process netstack TUN
+// too (see multihopNetstackAddr) instead of a kernel one, so a deployment
+// that can't create kernel TUNs at all can still run multihop.
 func (s *State) startMultihopDevice(t *db.MultihopTunnel) error {
-	tunDev, err := tun.CreateTUN(t.InterfaceName, device.DefaultMTU)
-	if err != nil {
-		return fmt.Errorf("tun %s: %w", t.InterfaceName, err)
+	var tunDev tun.Device
+	var err error
+	if s.netstackNet != nil {
+		tunDev, _, err = netstack.CreateNetTUN([]netip.Addr{multihopNetstackAddr(t.ID)}, nil, device.DefaultMTU)
+		if err != nil {
+			return fmt.Errorf("netstack %s: %w", t.InterfaceName, err)
+		}
+	} else {
+		tunDev, err = tun.CreateTUN(t.InterfaceName, device.DefaultMTU)
+		if err != nil {
+			return fmt.Errorf("tun %s: %w", t.InterfaceName, err)
+		}
 	}
+	var capturedTun tun.Device = &captureTap{Device: tunDev, hub: registerCaptureHub(t.InterfaceName)}
+	capturedTun = &filterTap{Device: capturedTun, filter: s.filter, db: s.db}
 
 	logger := newCallbackLogger(device.LogLevelError, "("+t.InterfaceName+") ")
-	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+	bind := s.multihopBind(t)
+	dev := device.NewDevice(capturedTun, bind, logger)
 	if dev == nil {
 		_ = tunDev.Close()
 		return fmt.Errorf("device create %s", t.InterfaceName)
@@ -941,13 +1455,27 @@ func (s *State) startMultihopDevice(t *db.MultihopTunnel) error {
 		return fmt.Errorf("ipc set device %s: %w", t.InterfaceName, err)
 	}
 
-	// Add remote peer
-	peerConfig := fmt.Sprintf(
-		"public_key=%s\nendpoint=%s\nallowed_ip=%s\npersistent_keepalive_interval=%d\n",
-		t.RemotePublicKey, t.RemoteEndpoint, t.RemoteAllowedIPs, t.RemoteKeepalive,
-	)
-	if t.RemotePresharedKey != "" {
-		peerConfig += fmt.Sprintf("preshared_key=%s\n", t.RemotePresharedKey)
+	// Add remote peer(s). candidates is ascending by Priority (most
+	// preferred first — see multihopPeerCandidates); emitting their peer
+	// blocks in one IpcSet call least-preferred-first means the most
+	// preferred one is configured last and so wins any allowed-ip route
+	// it shares with a standby, the same "last write wins the trie"
+	// semantics wireguard-go applies across separate IpcSet calls. Only
+	// the most preferred candidate gets a real endpoint — standbys sit
+	// dormant (known to the device, but never dialed) until
+	// promoteMultihopPeer hands one an endpoint.
+	candidates := multihopPeerCandidates(t)
+	var peerConfig string
+	for i := len(candidates) - 1; i >= 0; i-- {
+		c := candidates[i]
+		peerConfig += fmt.Sprintf("public_key=%s\nallowed_ip=%s\npersistent_keepalive_interval=%d\n",
+			c.PublicKey, c.AllowedIPs, c.Keepalive)
+		if i == 0 {
+			peerConfig += fmt.Sprintf("endpoint=%s\n", c.Endpoint)
+		}
+		if c.PresharedKey != "" {
+			peerConfig += fmt.Sprintf("preshared_key=%s\n", c.PresharedKey)
+		}
 	}
 	if err := dev.IpcSet(peerConfig); err != nil {
 		dev.Close()
@@ -959,12 +1487,157 @@ func (s *State) startMultihopDevice(t *db.MultihopTunnel) error {
 		return fmt.Errorf("device up %s: %w", t.InterfaceName, err)
 	}
 
-	// Store in registry for cleanup
-	entry := &multihopEntry{device: dev, tun: tunDev, name: t.Name}
+	// Relay/exit hops (hopIndex > 1) route their marked socket traffic
+	// through the previous hop's tunnel interface; the entry hop has no
+	// previous hop and just uses the host's normal default route.
+	hopIndex := multihopHopIndex(s.db, t.Name)
+	var policyRoute *multihopPolicyRoute
+	if hopIndex > 1 && t.FWMark != 0 {
+		if viaIface, ok := previousHopInterface(s.db, hopIndex); ok {
+			if err := installMultihopPolicyRoute(t.FWMark, t.RoutingTableID, t.Priority, viaIface); err != nil {
+				dev.Close()
+				return fmt.Errorf("policy route %s: %w", t.InterfaceName, err)
+			}
+			policyRoute = &multihopPolicyRoute{
+				fwmark:   t.FWMark,
+				table:    t.RoutingTableID,
+				priority: t.Priority,
+				viaIface: viaIface,
+			}
+		}
+	}
+
+	// Store in registry for cleanup, stats, and failover
+	entry := &multihopEntry{
+		device:          dev,
+		tun:             tunDev,
+		name:            t.Name,
+		hopIndex:        hopIndex,
+		remotePublicKey: candidates[0].PublicKey,
+		peers:           candidates,
+		watchdog:        multihopWatchdogState{startedAt: time.Now()},
+		policyRoute:     policyRoute,
+	}
 	multihopRegistryMu.Lock()
 	multihopRegistry[t.Name] = entry
 	multihopRegistryMu.Unlock()
 
+	if t.PongPort > 0 {
+		s.startMultihopPongServer(t, entry)
+	}
+
+	return nil
+}
+
+// multihopPeerCandidates returns t's failover peer candidates, ascending by
+// Priority (most preferred first). Falls back to a single-entry list built
+// from t's own Remote* fields when t.Peers is empty, so a tunnel created
+// before per-hop failover existed (or one with only ever one upstream)
+// behaves exactly as before.
+func multihopPeerCandidates(t *db.MultihopTunnel) []db.MultihopPeer {
+	if len(t.Peers) > 0 {
+		return t.Peers
+	}
+	return []db.MultihopPeer{{
+		PublicKey:    t.RemotePublicKey,
+		Endpoint:     t.RemoteEndpoint,
+		AllowedIPs:   t.RemoteAllowedIPs,
+		PresharedKey: t.RemotePresharedKey,
+		Keepalive:    t.RemoteKeepalive,
+		Priority:     0,
+	}}
+}
+
+// multihopHopIndex returns name's 1-based rank among enabled multihop
+// tunnels ordered by priority, i.e. its position in the chain. Returns 0 if
+// the tunnel can't be found (e.g. it's been disabled between device start
+// and registry insertion).
+func multihopHopIndex(bdb *db.BridgeDB, name string) int {
+	tunnels, err := bdb.EnabledMultihopTunnels()
+	if err != nil {
+		return 0
+	}
+	for i, t := range tunnels {
+		if t.Name == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// previousHopInterface returns the interface name of the tunnel immediately
+// before hopIndex in EnabledMultihopTunnels' priority order, i.e. the hop
+// whose tunnel interface a relay/exit hop's policy route should egress
+// through. ok is false if hopIndex is out of range (the tunnel was
+// disabled between device start and this lookup — same race
+// multihopHopIndex already tolerates by returning 0).
+func previousHopInterface(bdb *db.BridgeDB, hopIndex int) (string, bool) {
+	if hopIndex <= 1 {
+		return "", false
+	}
+	tunnels, err := bdb.EnabledMultihopTunnels()
+	if err != nil || hopIndex-2 >= len(tunnels) {
+		return "", false
+	}
+	return tunnels[hopIndex-2].InterfaceName, true
+}
+
+// updateMultihopDevice reconfigures an already-running multihop tunnel's
+// peer candidates in place — endpoint roams, PSK rotations, keepalive
+// tweaks, fwmark changes, and additions/removals from the failover
+// candidate list all take effect via IpcSet without the dev.Close()/tun
+// recreation/re-handshake a stopMultihopDevice+startMultihopDevice cycle
+// would cost. A candidate dropped from t.Peers entirely is explicitly
+// removed; every surviving candidate is re-asserted least-preferred-first
+// (same order and endpoint-only-for-the-active-peer rule as
+// startMultihopDevice) so the active peer still ends up owning the
+// allowed-ip route and a standby already mid-promotion isn't silently
+// knocked back to dormant. Returns an error if the tunnel isn't currently
+// running — callers should startMultihopDevice instead in that case.
+func (s *State) updateMultihopDevice(t *db.MultihopTunnel) error {
+	multihopRegistryMu.Lock()
+	entry, ok := multihopRegistry[t.Name]
+	if !ok {
+		multihopRegistryMu.Unlock()
+		return fmt.Errorf("multihop tunnel %s is not running", t.Name)
+	}
+	oldPeers := entry.peers
+	multihopRegistryMu.Unlock()
+
+	newPeers := multihopPeerCandidates(t)
+	newByKey := make(map[string]struct{}, len(newPeers))
+	for _, p := range newPeers {
+		newByKey[p.PublicKey] = struct{}{}
+	}
+
+	var ipcConfig string
+	if t.FWMark != 0 {
+		ipcConfig += fmt.Sprintf("fwmark=%d\n", t.FWMark)
+	}
+	for _, old := range oldPeers {
+		if _, ok := newByKey[old.PublicKey]; !ok {
+			ipcConfig += fmt.Sprintf("public_key=%s\nremove=true\n", old.PublicKey)
+		}
+	}
+	for i := len(newPeers) - 1; i >= 0; i-- {
+		c := newPeers[i]
+		ipcConfig += fmt.Sprintf("public_key=%s\nallowed_ip=%s\npersistent_keepalive_interval=%d\n",
+			c.PublicKey, c.AllowedIPs, c.Keepalive)
+		if i == 0 {
+			ipcConfig += fmt.Sprintf("endpoint=%s\n", c.Endpoint)
+		}
+		if c.PresharedKey != "" {
+			ipcConfig += fmt.Sprintf("preshared_key=%s\n", c.PresharedKey)
+		}
+	}
+	if err := entry.device.IpcSet(ipcConfig); err != nil {
+		return fmt.Errorf("ipc set peer %s: %w", t.Name, err)
+	}
+
+	multihopRegistryMu.Lock()
+	entry.remotePublicKey = newPeers[0].PublicKey
+	entry.peers = newPeers
+	multihopRegistryMu.Unlock()
 	return nil
 }
 
@@ -979,14 +1652,76 @@ func (s *State) stopMultihopDevice(t *db.MultihopTunnel) {
 
 	if ok {
 		entry.device.Close()
+		unregisterCaptureHub(t.InterfaceName)
+		if entry.policyRoute != nil {
+			pr := entry.policyRoute
+			removeMultihopPolicyRoute(pr.fwmark, pr.table, pr.priority, pr.viaIface)
+		}
+		if entry.pongServer != nil {
+			_ = entry.pongServer.Close()
+		}
 	}
 }
 
-// multihopEntry tracks live multihop devices for cleanup.
+// multihopEntry tracks live multihop devices for cleanup and stats.
 type multihopEntry struct {
 	device *device.Device
 	tun    tun.Device
 	name   string
+
+	// hopIndex is this tunnel's 1-based rank among enabled multihop
+	// tunnels ordered by priority (the same order restoreMultihopTunnels
+	// brings them up in), i.e. its position in the chain. remotePublicKey
+	// is the active peer candidate's key (see peers below). Both are kept
+	// here so MultihopStats can join against db.MultihopTunnel without a
+	// query on every call.
+	hopIndex        int
+	remotePublicKey string
+
+	// peers is this hop's failover candidate list, ascending by Priority
+	// (most preferred first) — see multihopPeerCandidates. remotePublicKey
+	// always names whichever of these is currently active (dialed, owns
+	// the allowed-ip route); the rest sit dormant on the device until
+	// promoteMultihopPeer (multihop_failover.go) promotes one. Both
+	// fields are mutated under multihopRegistryMu, same as the map itself.
+	peers []db.MultihopPeer
+
+	// watchdog is this hop's handshake-restart history — see
+	// multihop_watchdog.go. Mutated under multihopRegistryMu, same as the
+	// rest of this struct.
+	watchdog multihopWatchdogState
+
+	// policyRoute is non-nil when startMultihopDevice installed an ip-rule/
+	// route pair for this hop (hopIndex > 1 — see installMultihopPolicyRoute),
+	// so stopMultihopDevice knows what to tear down.
+	policyRoute *multihopPolicyRoute
+
+	// mtuLastProbe is when probeMultihopMTU last ran for this hop (see
+	// multihop_mtu.go) — zero-value means never, so a freshly (re)started
+	// hop always gets probed on checkMultihopMTUProbeOnce's next tick.
+	mtuLastProbe time.Time
+
+	// Out-of-band pong health check — see multihop_pong.go. pongServer is
+	// non-nil while this hop's /phantom/pong HTTP server is running;
+	// pongSecret is the DH shared secret (core.DeriveSharedSecret) its
+	// handler signs responses with. pongLastPoll and pongFailures track
+	// checkMultihopPongOnce's polling schedule and consecutive-failure
+	// count for this hop, same role multihopWatchdogState plays for the
+	// handshake watchdog.
+	pongServer   *http.Server
+	pongSecret   string
+	pongLastPoll time.Time
+	pongFailures int
+}
+
+// multihopPolicyRoute records what installMultihopPolicyRoute installed for
+// one hop, so removeMultihopPolicyRoute can be called with the same
+// arguments at teardown.
+type multihopPolicyRoute struct {
+	fwmark   int
+	table    int
+	priority int
+	viaIface string
 }
 
 var (
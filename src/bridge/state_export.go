@@ -0,0 +1,273 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+	"unicode/utf16"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"wireguard-go-bridge/core"
+	"wireguard-go-bridge/db"
+)
+
+// Full-state HJSON import/export, modeled on yggdrasil-go's HJSON node
+// config: the whole bridge (device keypair, ServerConfig, every
+// ClientRecord, every MultihopTunnel) round-trips through one
+// human-editable document, for disaster-recovery backups and
+// config-as-code workflows. The heavy lifting — diffing against the live
+// database and applying the result — is db.BridgeDB.Snapshot/ApplyImport;
+// this file owns the HJSON encoding, input decoding, validation, and
+// re-syncing the running device.Device to match afterward.
+
+// ImportOpts controls ImportState's behavior.
+type ImportOpts struct {
+	// DryRun computes and returns the diff without writing anything.
+	DryRun bool
+	// Merge keeps clients/tunnels present in the database but absent from
+	// the import, instead of removing them.
+	Merge bool
+}
+
+// ExportState serializes the device keypair, server config, every client,
+// and every multihop tunnel into one HJSON document.
+func (s *State) ExportState() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.status == StatusUninitialized {
+		return "", fmt.Errorf("not initialized")
+	}
+
+	snapshot, err := s.db.Snapshot()
+	if err != nil {
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+
+	out, err := hjson.Marshal(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("encode hjson: %w", err)
+	}
+	return string(out), nil
+}
+
+// ImportState parses an HJSON document produced by ExportState (or hand
+// edited), validates it, and applies it against bridge-db — then re-syncs
+// the running device.Device so its live peer set matches. With
+// opts.DryRun, nothing is written; the returned string is a JSON-encoded
+// db.ImportDiff describing what would change. Without it, the returned
+// string is the same diff describing what did change.
+func (s *State) ImportState(hjsonDoc string, opts ImportOpts) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status == StatusUninitialized {
+		return "", fmt.Errorf("not initialized")
+	}
+
+	text, err := decodeImportText([]byte(hjsonDoc))
+	if err != nil {
+		return "", fmt.Errorf("decode input: %w", err)
+	}
+
+	var snapshot db.ExportSnapshot
+	if err := hjson.Unmarshal([]byte(text), &snapshot); err != nil {
+		return "", fmt.Errorf("parse hjson: %w", err)
+	}
+
+	if err := validateImportSnapshot(&snapshot); err != nil {
+		return "", fmt.Errorf("validate: %w", err)
+	}
+
+	diff, err := s.db.ApplyImport(&snapshot, opts.Merge, opts.DryRun)
+	if err != nil {
+		return "", fmt.Errorf("apply: %w", err)
+	}
+
+	if !opts.DryRun {
+		s.resyncDeviceLocked(diff.ClientsRemoved)
+	}
+
+	out, err := json.Marshal(diff)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// resyncDeviceLocked re-applies every enabled client's IPC config to the
+// live device.Device after an import, adding/updating peers the import
+// changed and removing the ones it deleted (removed, the diff's
+// ClientsRemoved, since those rows are gone from bridge-db), then
+// reconciles multihop tunnels the same way. The client loop is a no-op if the device isn't running —
+// an import against a stopped bridge just updates bridge-db, and the
+// usual Start() path picks it up next time — but multihop tunnels are
+// reconciled regardless, since they run independently of the primary
+// device. Caller must hold s.mu.
+func (s *State) resyncDeviceLocked(removed []string) {
+	if s.dev != nil {
+		for _, pubKey := range removed {
+			_ = s.dev.IpcSet(fmt.Sprintf("public_key=%s\nremove=true\n", pubKey))
+		}
+		if clients, err := s.db.AllClients(); err == nil {
+			for _, c := range clients {
+				if !c.Enabled {
+					config := fmt.Sprintf("public_key=%s\nremove=true\n", c.PublicKey)
+					_ = s.dev.IpcSet(config)
+					continue
+				}
+				configurePeerOnDevice(s.dev, c)
+			}
+		}
+	}
+	s.resyncMultihopTunnelsLocked()
+}
+
+// resyncMultihopTunnelsLocked reconciles every multihop tunnel in
+// bridge-db against the live registry after an import: a tunnel that's
+// already running and still enabled gets its peer config updated in place
+// via updateMultihopDevice (identity fields like InterfaceName never
+// change via import, so there's never a reason to tear it down here), a
+// newly enabled one is started, and a disabled one is stopped. Caller
+// must hold s.mu.
+func (s *State) resyncMultihopTunnelsLocked() {
+	tunnels, err := s.db.ListMultihopTunnels()
+	if err != nil {
+		return
+	}
+	for i := range tunnels {
+		t := &tunnels[i]
+		multihopRegistryMu.Lock()
+		_, running := multihopRegistry[t.Name]
+		multihopRegistryMu.Unlock()
+
+		switch {
+		case !t.Enabled:
+			if running {
+				s.stopMultihopDevice(t)
+				_ = s.db.SetMultihopStatus(t.Name, "stopped", "", nil)
+			}
+		case running:
+			if err := s.updateMultihopDevice(t); err != nil {
+				_ = s.db.SetMultihopStatus(t.Name, "error", err.Error(), nil)
+			}
+		default:
+			if err := s.startMultihopDevice(t); err != nil {
+				_ = s.db.SetMultihopStatus(t.Name, "error", err.Error(), nil)
+				continue
+			}
+			now := time.Now().Unix()
+			_ = s.db.SetMultihopStatus(t.Name, "running", "", &now)
+		}
+	}
+}
+
+// validateImportSnapshot rejects a parsed snapshot before it ever reaches
+// ApplyImport: malformed keys, keys that don't derive the public key
+// they're paired with, and unparseable CIDRs. IP-pool collisions are left
+// to ApplyImport/InsertClient's existing CheckAllowedIPConflict, which
+// also catches duplicates within the imported set itself as clients are
+// applied one by one.
+func validateImportSnapshot(snapshot *db.ExportSnapshot) error {
+	if snapshot.Device != nil {
+		if err := validateKeyPair(snapshot.Device.PrivateKey, snapshot.Device.PublicKey); err != nil {
+			return fmt.Errorf("device: %w", err)
+		}
+	}
+
+	if snapshot.ServerConfig != nil {
+		if err := validateCIDR("network", snapshot.ServerConfig.Network); err != nil {
+			return err
+		}
+		if snapshot.ServerConfig.NetworkV6 != "" {
+			if err := validateCIDR("network_v6", snapshot.ServerConfig.NetworkV6); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range snapshot.Clients {
+		if err := validateKeyPair(c.PrivateKey, c.PublicKey); err != nil {
+			return fmt.Errorf("client %s: %w", c.PublicKey, err)
+		}
+		if err := validateCIDR(fmt.Sprintf("client %s allowed_ip", c.PublicKey), c.AllowedIP); err != nil {
+			return err
+		}
+		if c.AllowedIPv6 != "" {
+			if err := validateCIDR(fmt.Sprintf("client %s allowed_ip_v6", c.PublicKey), c.AllowedIPv6); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, t := range snapshot.MultihopTunnels {
+		if err := validateKeyPair(t.PrivateKey, t.PublicKey); err != nil {
+			return fmt.Errorf("tunnel %s: %w", t.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateKeyPair checks privHex is a well-formed Curve25519 private key
+// (via core.DerivePublicKey) and that it actually derives pubHex, catching
+// a hand-edited HJSON file with a typo'd or mismatched key pair.
+func validateKeyPair(privHex, pubHex string) error {
+	derived, err := core.DerivePublicKey(privHex)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	if derived != pubHex {
+		return fmt.Errorf("public key does not match private key")
+	}
+	if _, err := hex.DecodeString(pubHex); err != nil || len(pubHex) != 64 {
+		return fmt.Errorf("malformed public key")
+	}
+	return nil
+}
+
+// validateCIDR checks cidr parses as a CIDR prefix, reporting field for
+// context in the returned error.
+func validateCIDR(field, cidr string) error {
+	if cidr == "" || cidr == "pending" {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		return fmt.Errorf("%s: invalid cidr %q: %w", field, cidr, err)
+	}
+	return nil
+}
+
+// decodeImportText strips a UTF-8 BOM or decodes UTF-16 (with its BOM) to
+// UTF-8, so an HJSON file saved by a Windows editor doesn't blow up the
+// parser. Text with no recognized BOM is returned unchanged.
+func decodeImportText(raw []byte) (string, error) {
+	switch {
+	case len(raw) >= 3 && raw[0] == 0xEF && raw[1] == 0xBB && raw[2] == 0xBF:
+		return string(raw[3:]), nil
+	case len(raw) >= 2 && raw[0] == 0xFF && raw[1] == 0xFE:
+		return decodeUTF16(raw[2:], binary.LittleEndian), nil
+	case len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF:
+		return decodeUTF16(raw[2:], binary.BigEndian), nil
+	default:
+		return string(raw), nil
+	}
+}
+
+// decodeUTF16 decodes b (without its BOM) as UTF-16 in the given byte
+// order into a UTF-8 string. A trailing odd byte (malformed input) is
+// dropped rather than erroring.
+func decodeUTF16(b []byte, order binary.ByteOrder) string {
+	if len(b)%2 != 0 {
+		b = b[:len(b)-1]
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+	"unsafe"
+
+	"wireguard-go-bridge/db"
+)
+
+// StatsEventCallback is a C-compatible function pointer for receiving
+// push-based peer stats-change events (handshake, endpoint_change,
+// rx_delta, tx_delta, quota_exceeded, acl_drop) instead of polling
+// bridge-db for them.
+// peer/kind/oldVal/newVal are null-terminated C strings (caller must NOT free).
+type StatsEventCallback func(peer, kind, oldVal, newVal *byte, context unsafe.Pointer)
+
+var (
+	statsEventFn  StatsEventCallback
+	statsEventCtx unsafe.Pointer
+	statsEventMu  sync.RWMutex
+)
+
+// SetStatsEventCallback registers a callback for peer stats-change events.
+// Pass nil to disable.
+func SetStatsEventCallback(fn StatsEventCallback, ctx unsafe.Pointer) {
+	statsEventMu.Lock()
+	defer statsEventMu.Unlock()
+	statsEventFn = fn
+	statsEventCtx = ctx
+}
+
+// emitStatsEvent sends a peer event through the registered callback, if any.
+func emitStatsEvent(ev db.PeerEvent) {
+	statsEventMu.RLock()
+	fn := statsEventFn
+	ctx := statsEventCtx
+	statsEventMu.RUnlock()
+
+	if fn == nil {
+		return
+	}
+	fn(cString(ev.PublicKey), cString(string(ev.Kind)), cString(ev.Old), cString(ev.New), ctx)
+}
+
+// cString returns s as a null-terminated byte slice's first byte, for
+// passing Go strings across the FFI boundary.
+func cString(s string) *byte {
+	buf := make([]byte, len(s)+1)
+	copy(buf, s)
+	return &buf[0]
+}
+
+// PeerEventCallback is a C-compatible function pointer for receiving a
+// single JSON-encoded peer event per call, for callers that would rather
+// parse one payload than juggle StatsEventCallback's four C strings.
+// payload is a null-terminated C string (caller must NOT free).
+type PeerEventCallback func(payload *byte, context unsafe.Pointer)
+
+var (
+	peerEventFn  PeerEventCallback
+	peerEventCtx unsafe.Pointer
+	peerEventMu  sync.RWMutex
+)
+
+// SetPeerEventCallback registers a callback that receives every PeerEvent
+// as a single JSON object: {event, pubkey, endpoint, rx_bytes, tx_bytes,
+// last_handshake_ns}. Pass nil to disable.
+func SetPeerEventCallback(fn PeerEventCallback, ctx unsafe.Pointer) {
+	peerEventMu.Lock()
+	defer peerEventMu.Unlock()
+	peerEventFn = fn
+	peerEventCtx = ctx
+}
+
+// peerEventJSON is the wire shape SetPeerEventCallback's subscribers see.
+type peerEventJSON struct {
+	Event           string `json:"event"`
+	PubKey          string `json:"pubkey"`
+	Endpoint        string `json:"endpoint"`
+	RxBytes         int64  `json:"rx_bytes"`
+	TxBytes         int64  `json:"tx_bytes"`
+	LastHandshakeNs int64  `json:"last_handshake_ns"`
+}
+
+// emitPeerEvent sends ev through the registered JSON callback, if any.
+func emitPeerEvent(ev db.PeerEvent) {
+	peerEventMu.RLock()
+	fn := peerEventFn
+	ctx := peerEventCtx
+	peerEventMu.RUnlock()
+
+	if fn == nil {
+		return
+	}
+
+	payload := peerEventJSON{
+		Event:    string(ev.Kind),
+		PubKey:   ev.PublicKey,
+		Endpoint: ev.Endpoint,
+		RxBytes:  ev.RxBytes,
+		TxBytes:  ev.TxBytes,
+	}
+	if ev.LastHandshake != nil {
+		payload.LastHandshakeNs = *ev.LastHandshake * int64(time.Second)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fn(cString(string(b)), ctx)
+}
@@ -0,0 +1,192 @@
+package bridge
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is a structured log record's severity, ordered least to most
+// severe so SetLogFilter's minLevel comparison is a plain >=.
+type LogLevel int32
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// LogRecord is one structured log event, as opposed to the legacy
+// LogCallback's flattened (level int32, msg string) pair. Subsystem comes
+// from the prepend string passed to newCallbackLogger (e.g. the
+// interface name), so a caller juggling several devices can tell their
+// log lines apart without parsing msg.
+type LogRecord struct {
+	Time      time.Time
+	Level     LogLevel
+	Subsystem string
+	Message   string
+	Fields    map[string]string
+}
+
+// StructuredLogCallback receives parsed LogRecords instead of the legacy
+// two-level (level, msg) C callback. ctx is opaque, passed back verbatim —
+// kept for symmetry with SetLogCallback/SetStatsEventCallback even though
+// a pure-Go callback could just close over its own context.
+type StructuredLogCallback func(rec *LogRecord, ctx any)
+
+var (
+	structuredLogFn  StructuredLogCallback
+	structuredLogCtx any
+	structuredLogMu  sync.RWMutex
+)
+
+// SetStructuredLogCallback registers fn to receive every LogRecord that
+// passes the configured filter (see SetLogFilter). Pass nil to disable.
+func SetStructuredLogCallback(fn StructuredLogCallback, ctx any) {
+	structuredLogMu.Lock()
+	defer structuredLogMu.Unlock()
+	structuredLogFn = fn
+	structuredLogCtx = ctx
+}
+
+// defaultLogBufferSize is DrainLogs' history depth before SetLogBufferSize
+// is ever called.
+const defaultLogBufferSize = 256
+
+// logRing is a fixed-size circular buffer of the most recent LogRecords
+// that passed the filter, so DrainLogs can recover history a caller missed
+// because it registered its callback after the fact (or never did, and
+// just polls instead). Writes take mu only long enough to copy one
+// pointer into the slice and bump an index — there's no allocation or log
+// formatting under the lock, so it doesn't meaningfully serialize the
+// logging hot path despite not being a true lock-free MPMC structure.
+type logRing struct {
+	mu   sync.Mutex
+	buf  []*LogRecord
+	next int  // index the next Write lands at
+	full bool // true once buf has wrapped at least once
+}
+
+var ring = &logRing{buf: make([]*LogRecord, defaultLogBufferSize)}
+
+// SetLogBufferSize resizes the ring buffer DrainLogs reads from. Any
+// resize, shrinking or growing, starts the buffer fresh: every record
+// buffered so far is discarded rather than rehomed at new offsets.
+func SetLogBufferSize(n int) {
+	if n <= 0 {
+		n = 1
+	}
+	ring.mu.Lock()
+	ring.buf = make([]*LogRecord, n)
+	ring.next = 0
+	ring.full = false
+	ring.mu.Unlock()
+}
+
+func (r *logRing) push(rec *LogRecord) {
+	r.mu.Lock()
+	r.buf[r.next] = rec
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// DrainLogs returns the buffered records in oldest-to-newest order and
+// clears the buffer. Safe to call whether or not a callback is registered.
+func DrainLogs() []LogRecord {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	var out []LogRecord
+	if r := ring; r.full {
+		out = make([]LogRecord, 0, len(r.buf))
+		for i := 0; i < len(r.buf); i++ {
+			idx := (r.next + i) % len(r.buf)
+			if r.buf[idx] != nil {
+				out = append(out, *r.buf[idx])
+			}
+		}
+	} else {
+		out = make([]LogRecord, 0, ring.next)
+		for i := 0; i < ring.next; i++ {
+			out = append(out, *ring.buf[i])
+		}
+	}
+
+	for i := range ring.buf {
+		ring.buf[i] = nil
+	}
+	ring.next = 0
+	ring.full = false
+	return out
+}
+
+// logFilters maps subsystem -> minimum LogLevel that subsystem may emit.
+// A subsystem with no entry falls back to the "" wildcard entry, or
+// LogLevelDebug (no filtering) if that's unset too.
+var (
+	logFilters   = make(map[string]LogLevel)
+	logFiltersMu sync.RWMutex
+)
+
+// SetLogFilter sets the minimum level a subsystem's records must meet to
+// be buffered or dispatched. subsystem == "" sets the fallback used by any
+// subsystem without its own entry.
+func SetLogFilter(subsystem string, minLevel int) {
+	logFiltersMu.Lock()
+	logFilters[subsystem] = LogLevel(minLevel)
+	logFiltersMu.Unlock()
+}
+
+func passesFilter(subsystem string, level LogLevel) bool {
+	logFiltersMu.RLock()
+	defer logFiltersMu.RUnlock()
+	if min, ok := logFilters[subsystem]; ok {
+		return level >= min
+	}
+	if min, ok := logFilters[""]; ok {
+		return level >= min
+	}
+	return true
+}
+
+// emitStructuredLog is newCallbackLogger's entry point for both the legacy
+// and structured log paths. It always buffers a passing record; it
+// dispatches to the structured callback if one is registered, and only
+// falls back to translating into the legacy two-level emitLog scheme when
+// no structured callback is registered — a caller that's opted into
+// structured logs doesn't also get the flattened version.
+func emitStructuredLog(level LogLevel, subsystem, msg string) {
+	if !passesFilter(subsystem, level) {
+		return
+	}
+
+	rec := &LogRecord{Time: time.Now(), Level: level, Subsystem: subsystem, Message: msg}
+	ring.push(rec)
+
+	structuredLogMu.RLock()
+	fn, ctx := structuredLogFn, structuredLogCtx
+	structuredLogMu.RUnlock()
+
+	if fn != nil {
+		fn(rec, ctx)
+		return
+	}
+
+	if level == LogLevelError {
+		emitLog(1, msg)
+	} else {
+		emitLog(2, msg)
+	}
+}
+
+// subsystemFromPrepend extracts a bare tag from newCallbackLogger's
+// "(ifname) " style prepend string, e.g. "(wg0) " -> "wg0".
+func subsystemFromPrepend(prepend string) string {
+	return strings.Trim(prepend, "() ")
+}
@@ -0,0 +1,100 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Bind option flag bits for DeviceBindSetOptions' flags parameter.
+const (
+	bindFlagGSO           = 1 << 0
+	bindFlagStickySockets = 1 << 1
+)
+
+// bindOptionsEntry is the caller-requested bind tuning for one low-level
+// device handle, recorded by DeviceBindSetOptions and surfaced by
+// DeviceBindGetStats.
+//
+// NOTE: upstream wireguard-go's conn.StdNetBind (gso_linux.go,
+// sticky_linux.go) auto-detects UDP GSO/GRO and sticky-source support per
+// socket and silently falls back on error; it exposes neither a runtime
+// on/off switch nor the underlying fd needed to set SO_SNDBUF/SO_RCVBUF.
+// These functions record what was requested for diagnostics — they do not
+// change StdNetBind's actual behavior.
+type bindOptionsEntry struct {
+	gsoEnabled    bool
+	stickySockets bool
+	sndBuf        int
+	rcvBuf        int
+}
+
+var (
+	bindOptionsByHandle   = make(map[int64]*bindOptionsEntry)
+	bindOptionsByHandleMu sync.Mutex
+)
+
+//export DeviceBindSetOptions
+func DeviceBindSetOptions(handle C.int64_t, flags C.int, sndBuf C.int, rcvBuf C.int) C.int32_t {
+	_, errC := getDevice(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+
+	bindOptionsByHandleMu.Lock()
+	bindOptionsByHandle[int64(handle)] = &bindOptionsEntry{
+		gsoEnabled:    int(flags)&bindFlagGSO != 0,
+		stickySockets: int(flags)&bindFlagStickySockets != 0,
+		sndBuf:        int(sndBuf),
+		rcvBuf:        int(rcvBuf),
+	}
+	bindOptionsByHandleMu.Unlock()
+	return C.WG_OK
+}
+
+// bindStatsJSON is the JSON shape returned by DeviceBindGetStats.
+type bindStatsJSON struct {
+	GSOEnabledRequested    bool `json:"gso_enabled_requested"`
+	StickySocketsRequested bool `json:"sticky_sockets_requested"`
+	SndBufRequested        int  `json:"snd_buf_requested"`
+	RcvBufRequested        int  `json:"rcv_buf_requested"`
+	BatchSize              int  `json:"batch_size"`
+}
+
+//export DeviceBindGetStats
+func DeviceBindGetStats(handle C.int64_t) *C.char {
+	dev, errC := getDevice(int64(handle))
+	if errC != C.WG_OK {
+		return nil
+	}
+
+	stats := bindStatsJSON{BatchSize: dev.BatchSize()}
+
+	bindOptionsByHandleMu.Lock()
+	opts, ok := bindOptionsByHandle[int64(handle)]
+	bindOptionsByHandleMu.Unlock()
+	if ok {
+		stats.GSOEnabledRequested = opts.gsoEnabled
+		stats.StickySocketsRequested = opts.stickySockets
+		stats.SndBufRequested = opts.sndBuf
+		stats.RcvBufRequested = opts.rcvBuf
+	}
+
+	b, _ := json.Marshal(stats)
+	return C.CString(string(b))
+}
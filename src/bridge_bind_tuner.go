@@ -0,0 +1,235 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// bindTuner wraps the conn.Bind NewDevice hands to device.NewDevice so the
+// FFI surface can tune it after the fact. Unlike bindOptionsByHandle
+// (bridge_bind_options.go), which only records what a caller asked for
+// next to a Bind it can't reach, bindTuner sits directly in the Send/
+// BatchSize path: BatchSize() can genuinely cap what device.Device
+// negotiates per syscall, and every Send is counted for DeviceBindStats.
+// GSO and sticky-socket selection still happen inside conn.StdNetBind
+// itself (gso_linux.go, sticky_linux.go) with no exported switch, so
+// those two remain requested-only, same honest caveat as
+// bindOptionsEntry.
+type bindTuner struct {
+	conn.Bind
+
+	mu                     sync.Mutex
+	gsoEnabledRequested    bool
+	stickySocketsRequested bool
+	batchSizeOverride      int // 0 means defer to the wrapped Bind
+
+	sendCalls   atomic.Int64
+	sendPackets atomic.Int64
+	sendBytes   atomic.Int64
+
+	endpointsMu sync.Mutex
+	endpoints   map[string]*endpointSendStats
+}
+
+type endpointSendStats struct {
+	calls   int64
+	packets int64
+	bytes   int64
+}
+
+func newBindTuner(inner conn.Bind) *bindTuner {
+	return &bindTuner{
+		Bind:      inner,
+		endpoints: make(map[string]*endpointSendStats),
+	}
+}
+
+// BatchSize reports the caller's override when it's smaller than what the
+// wrapped Bind supports, since device.Device sizes its read/write buffers
+// off this value — shrinking it genuinely shrinks the batches sent.
+// Growing past the wrapped Bind's real batch size isn't honored, since
+// device.Device never asks the Bind to batch more than BatchSize() lets it.
+func (b *bindTuner) BatchSize() int {
+	b.mu.Lock()
+	override := b.batchSizeOverride
+	b.mu.Unlock()
+
+	inner := b.Bind.BatchSize()
+	if override > 0 && override < inner {
+		return override
+	}
+	return inner
+}
+
+// Send records per-call and per-endpoint batch counters, then delegates.
+func (b *bindTuner) Send(bufs [][]byte, ep conn.Endpoint) error {
+	var packetBytes int64
+	for _, buf := range bufs {
+		packetBytes += int64(len(buf))
+	}
+
+	b.sendCalls.Add(1)
+	b.sendPackets.Add(int64(len(bufs)))
+	b.sendBytes.Add(packetBytes)
+
+	dst := ep.DstToString()
+	b.endpointsMu.Lock()
+	stats, ok := b.endpoints[dst]
+	if !ok {
+		stats = &endpointSendStats{}
+		b.endpoints[dst] = stats
+	}
+	stats.calls++
+	stats.packets += int64(len(bufs))
+	stats.bytes += packetBytes
+	b.endpointsMu.Unlock()
+
+	return b.Bind.Send(bufs, ep)
+}
+
+func (b *bindTuner) setGSOEnabled(enabled bool) {
+	b.mu.Lock()
+	b.gsoEnabledRequested = enabled
+	b.mu.Unlock()
+}
+
+func (b *bindTuner) setStickySockets(enabled bool) {
+	b.mu.Lock()
+	b.stickySocketsRequested = enabled
+	b.mu.Unlock()
+}
+
+func (b *bindTuner) setBatchSizeOverride(size int) {
+	b.mu.Lock()
+	b.batchSizeOverride = size
+	b.mu.Unlock()
+}
+
+// endpointStatsJSON is one entry of bindStatsJSONv2's per-endpoint list.
+type endpointStatsJSON struct {
+	Endpoint string `json:"endpoint"`
+	Calls    int64  `json:"calls"`
+	Packets  int64  `json:"packets"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// bindStatsJSONv2 is the JSON shape returned by DeviceBindStats. It's a
+// distinct type (and export) from bindStatsJSON/DeviceBindGetStats because
+// that one reports caller-requested preferences about a Bind it can't
+// reach; this one reports real traffic counters plus the same-process
+// effective batch size off a Bind it actually wraps.
+type bindStatsJSONv2 struct {
+	GSOEnabledRequested    bool                `json:"gso_enabled_requested"`
+	StickySocketsRequested bool                `json:"sticky_sockets_requested"`
+	EffectiveBatchSize     int                 `json:"effective_batch_size"`
+	SendCalls              int64               `json:"send_calls"`
+	SendPackets            int64               `json:"send_packets"`
+	SendBytes              int64               `json:"send_bytes"`
+	Endpoints              []endpointStatsJSON `json:"endpoints"`
+}
+
+func (b *bindTuner) statsJSON() bindStatsJSONv2 {
+	batchSize := b.BatchSize() // takes b.mu itself
+
+	b.mu.Lock()
+	stats := bindStatsJSONv2{
+		GSOEnabledRequested:    b.gsoEnabledRequested,
+		StickySocketsRequested: b.stickySocketsRequested,
+		EffectiveBatchSize:     batchSize,
+		SendCalls:              b.sendCalls.Load(),
+		SendPackets:            b.sendPackets.Load(),
+		SendBytes:              b.sendBytes.Load(),
+	}
+	b.mu.Unlock()
+
+	b.endpointsMu.Lock()
+	stats.Endpoints = make([]endpointStatsJSON, 0, len(b.endpoints))
+	for ep, s := range b.endpoints {
+		stats.Endpoints = append(stats.Endpoints, endpointStatsJSON{
+			Endpoint: ep,
+			Calls:    s.calls,
+			Packets:  s.packets,
+			Bytes:    s.bytes,
+		})
+	}
+	b.endpointsMu.Unlock()
+
+	return stats
+}
+
+//export DeviceBindSetGSOEnabled
+func DeviceBindSetGSOEnabled(handle C.int64_t, enabled C.bool) C.int32_t {
+	tuner, errC := getBindTuner(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	tuner.setGSOEnabled(bool(enabled))
+	return errOK
+}
+
+//export DeviceBindSetBatchSize
+func DeviceBindSetBatchSize(handle C.int64_t, size C.int) C.int32_t {
+	tuner, errC := getBindTuner(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	tuner.setBatchSizeOverride(int(size))
+	return errOK
+}
+
+//export DeviceBindSetStickySockets
+func DeviceBindSetStickySockets(handle C.int64_t, enabled C.bool) C.int32_t {
+	tuner, errC := getBindTuner(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	tuner.setStickySockets(bool(enabled))
+	return errOK
+}
+
+//export DeviceBindStats
+func DeviceBindStats(handle C.int64_t) *C.char {
+	tuner, errC := getBindTuner(int64(handle))
+	if errC != C.WG_OK {
+		return nil
+	}
+	b, _ := json.Marshal(tuner.statsJSON())
+	return C.CString(string(b))
+}
+
+// getBindTuner resolves the bindTuner for a low-level device handle. A
+// device created outside NewDevice's conn.NewDefaultBind() path (netstack,
+// l2) has no bindTuner, since there's no real per-packet Bind to wrap.
+func getBindTuner(handle int64) (*bindTuner, C.int32_t) {
+	if !Validate(handle, KindDevice) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	obj, ok := deviceRegistry.Get(handle)
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	entry := obj.(*deviceEntry)
+	if entry.bind == nil {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return entry.bind, C.WG_OK
+}
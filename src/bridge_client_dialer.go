@@ -0,0 +1,96 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+//
+// bridge_client_dialer.go — FFI for clientdialer.Dialer, a headless
+// userspace WireGuard client. Unlike NewDeviceNetstack (bridge_netstack.go),
+// which hands back a low-level device handle the caller still has to
+// IpcSet/NewPeer itself, ClientDialerCreate takes a single JSON config and
+// returns a ready-to-dial handle in one call — the FFI counterpart of
+// clientdialer.New. Dialed connections are handed off to the existing
+// netstackConnRegistry, so NetstackRead/NetstackWrite/NetstackConnClose
+// work on them exactly like a connection from NetstackDialTCP.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"encoding/json"
+
+	"wireguard-go-bridge/clientdialer"
+)
+
+//export ClientDialerCreate
+func ClientDialerCreate(configJSON *C.char) C.int64_t {
+	var cfg clientdialer.Config
+	if err := json.Unmarshal([]byte(C.GoString(configJSON)), &cfg); err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+
+	dialer, err := clientdialer.New(cfg)
+	if err != nil {
+		return C.int64_t(C.WG_ERR_DEVICE_CREATE)
+	}
+
+	return C.int64_t(clientDialerRegistry.Add(dialer))
+}
+
+//export ClientDialerDialTCP
+func ClientDialerDialTCP(handle C.int64_t, addr *C.char) C.int64_t {
+	dialer, errC := getClientDialer(int64(handle))
+	if errC != C.WG_OK {
+		return C.int64_t(errC)
+	}
+	conn, err := dialer.DialTCP(C.GoString(addr))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackConnRegistry.Add(conn))
+}
+
+//export ClientDialerDialUDP
+func ClientDialerDialUDP(handle C.int64_t, addr *C.char) C.int64_t {
+	dialer, errC := getClientDialer(int64(handle))
+	if errC != C.WG_OK {
+		return C.int64_t(errC)
+	}
+	conn, err := dialer.DialUDP(C.GoString(addr))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackConnRegistry.Add(conn))
+}
+
+//export ClientDialerClose
+func ClientDialerClose(handle C.int64_t) C.int32_t {
+	dialer, errC := getClientDialer(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	dialer.Close()
+	clientDialerRegistry.Remove(int64(handle))
+	return errOK
+}
+
+// getClientDialer resolves a ClientDialerCreate handle into its *clientdialer.Dialer.
+func getClientDialer(handle int64) (*clientdialer.Dialer, C.int32_t) {
+	if !Validate(handle, KindClientDialer) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	obj, ok := clientDialerRegistry.Get(handle)
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return obj.(*clientdialer.Dialer), C.WG_OK
+}
@@ -32,11 +32,10 @@ func CookieCheckerCreate() C.int64_t {
 
 //export CookieCheckerInit
 func CookieCheckerInit(handle C.int64_t, pubKeyHex *C.char) C.int32_t {
-	obj, ok := cookieCheckerRegistry.Get(int64(handle))
-	if !ok {
-		return C.WG_ERR_NOT_FOUND
+	checker, errC := getCookieChecker(int64(handle))
+	if errC != C.WG_OK {
+		return errC
 	}
-	checker := obj.(*device.CookieChecker)
 
 	var pk device.NoisePublicKey
 	if err := pk.FromHex(C.GoString(pubKeyHex)); err != nil {
@@ -49,25 +48,35 @@ func CookieCheckerInit(handle C.int64_t, pubKeyHex *C.char) C.int32_t {
 
 //export CookieCheckerCheckMAC1
 func CookieCheckerCheckMAC1(handle C.int64_t, msg unsafe.Pointer, msgLen C.int) C.bool {
-	obj, ok := cookieCheckerRegistry.Get(int64(handle))
-	if !ok {
+	checker, errC := getCookieChecker(int64(handle))
+	if errC != C.WG_OK {
 		return C.bool(false)
 	}
-	checker := obj.(*device.CookieChecker)
 	msgSlice := C.GoBytes(msg, msgLen)
-	return C.bool(checker.CheckMAC1(msgSlice))
+	ok2 := checker.CheckMAC1(msgSlice)
+	if !ok2 {
+		for _, c := range allMetricsCollectors() {
+			c.IncCookieMAC1Failure()
+		}
+	}
+	return C.bool(ok2)
 }
 
 //export CookieCheckerCheckMAC2
 func CookieCheckerCheckMAC2(handle C.int64_t, msg unsafe.Pointer, msgLen C.int, src unsafe.Pointer, srcLen C.int) C.bool {
-	obj, ok := cookieCheckerRegistry.Get(int64(handle))
-	if !ok {
+	checker, errC := getCookieChecker(int64(handle))
+	if errC != C.WG_OK {
 		return C.bool(false)
 	}
-	checker := obj.(*device.CookieChecker)
 	msgSlice := C.GoBytes(msg, msgLen)
 	srcSlice := C.GoBytes(src, srcLen)
-	return C.bool(checker.CheckMAC2(msgSlice, srcSlice))
+	ok2 := checker.CheckMAC2(msgSlice, srcSlice)
+	if !ok2 {
+		for _, c := range allMetricsCollectors() {
+			c.IncCookieMAC2Failure()
+		}
+	}
+	return C.bool(ok2)
 }
 
 //export CookieCheckerCreateReply
@@ -78,11 +87,10 @@ func CookieCheckerCreateReply(
 	src unsafe.Pointer, srcLen C.int,
 	out unsafe.Pointer, outLen *C.int,
 ) C.int32_t {
-	obj, ok := cookieCheckerRegistry.Get(int64(handle))
-	if !ok {
-		return C.WG_ERR_NOT_FOUND
+	checker, errC := getCookieChecker(int64(handle))
+	if errC != C.WG_OK {
+		return errC
 	}
-	checker := obj.(*device.CookieChecker)
 	msgSlice := C.GoBytes(msg, msgLen)
 	srcSlice := C.GoBytes(src, srcLen)
 
@@ -90,6 +98,7 @@ func CookieCheckerCreateReply(
 	if err != nil {
 		return C.WG_ERR_COOKIE
 	}
+	publishCookieReplySent()
 
 	// Serialize reply to bytes
 	replySize := unsafe.Sizeof(*reply)
@@ -115,11 +124,10 @@ func CookieGeneratorCreate() C.int64_t {
 
 //export CookieGeneratorInit
 func CookieGeneratorInit(handle C.int64_t, pubKeyHex *C.char) C.int32_t {
-	obj, ok := cookieGenRegistry.Get(int64(handle))
-	if !ok {
-		return C.WG_ERR_NOT_FOUND
+	gen, errC := getCookieGen(int64(handle))
+	if errC != C.WG_OK {
+		return errC
 	}
-	gen := obj.(*device.CookieGenerator)
 
 	var pk device.NoisePublicKey
 	if err := pk.FromHex(C.GoString(pubKeyHex)); err != nil {
@@ -132,11 +140,10 @@ func CookieGeneratorInit(handle C.int64_t, pubKeyHex *C.char) C.int32_t {
 
 //export CookieGeneratorAddMacs
 func CookieGeneratorAddMacs(handle C.int64_t, msg unsafe.Pointer, msgLen C.int) C.int32_t {
-	obj, ok := cookieGenRegistry.Get(int64(handle))
-	if !ok {
-		return C.WG_ERR_NOT_FOUND
+	gen, errC := getCookieGen(int64(handle))
+	if errC != C.WG_OK {
+		return errC
 	}
-	gen := obj.(*device.CookieGenerator)
 	msgSlice := C.GoBytes(msg, msgLen)
 	gen.AddMacs(msgSlice)
 
@@ -147,11 +154,10 @@ func CookieGeneratorAddMacs(handle C.int64_t, msg unsafe.Pointer, msgLen C.int)
 
 //export CookieGeneratorConsumeReply
 func CookieGeneratorConsumeReply(handle C.int64_t, msg unsafe.Pointer, msgLen C.int) C.bool {
-	obj, ok := cookieGenRegistry.Get(int64(handle))
-	if !ok {
+	gen, errC := getCookieGen(int64(handle))
+	if errC != C.WG_OK {
 		return C.bool(false)
 	}
-	gen := obj.(*device.CookieGenerator)
 
 	// Parse as MessageCookieReply
 	if int(msgLen) < int(unsafe.Sizeof(device.MessageCookieReply{})) {
@@ -164,4 +170,28 @@ func CookieGeneratorConsumeReply(handle C.int64_t, msg unsafe.Pointer, msgLen C.
 //export CookieGeneratorFree
 func CookieGeneratorFree(handle C.int64_t) {
 	cookieGenRegistry.Remove(int64(handle))
-}
\ No newline at end of file
+}
+
+// ---------- Helpers ----------
+
+func getCookieChecker(handle int64) (*device.CookieChecker, C.int32_t) {
+	if !Validate(handle, KindCookieChecker) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	obj, ok := cookieCheckerRegistry.Get(handle)
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return obj.(*device.CookieChecker), C.WG_OK
+}
+
+func getCookieGen(handle int64) (*device.CookieGenerator, C.int32_t) {
+	if !Validate(handle, KindCookieGen) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	obj, ok := cookieGenRegistry.Get(handle)
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return obj.(*device.CookieGenerator), C.WG_OK
+}
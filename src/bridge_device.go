@@ -25,10 +25,14 @@ import (
 	"golang.zx2c4.com/wireguard/tun"
 )
 
-// deviceEntry stores a device along with its associated TUN for cleanup
+// deviceEntry stores a device along with its associated TUN for cleanup.
+// bind is non-nil only for devices created through NewDevice, the one path
+// that wraps conn.NewDefaultBind() in a bindTuner (bridge_bind_tuner.go);
+// netstack and l2 devices build their own Bind and leave it nil.
 type deviceEntry struct {
 	device *device.Device
 	tun    tun.Device
+	bind   *bindTuner
 }
 
 // ---------- Device Lifecycle ----------
@@ -44,16 +48,23 @@ func NewDevice(ifname *C.char, mtu C.int, loggerHandle C.int64_t) C.int64_t {
 	}
 
 	logger := getLogger(int64(loggerHandle))
-	bind := conn.NewDefaultBind()
+	bind := newBindTuner(conn.NewDefaultBind())
 
-	dev := device.NewDevice(tunDev, bind, logger)
+	redirect := &deviceLoggerRedirect{inner: logger}
+	proxyLogger := &device.Logger{Verbosef: redirect.verbosef, Errorf: redirect.errorf}
+	wrappedLogger, setEventOwner := wrapLoggerForEvents(proxyLogger)
+
+	dev := device.NewDevice(tunDev, bind, wrappedLogger)
 	if dev == nil {
 		_ = tunDev.Close()
 		return C.int64_t(C.WG_ERR_DEVICE_CREATE)
 	}
 
-	entry := &deviceEntry{device: dev, tun: tunDev}
-	return C.int64_t(deviceRegistry.Add(entry))
+	entry := &deviceEntry{device: dev, tun: tunDev, bind: bind}
+	deviceHandle := deviceRegistry.Add(entry)
+	setEventOwner(deviceHandle)
+	registerDeviceLoggerRedirect(deviceHandle, redirect)
+	return C.int64_t(deviceHandle)
 }
 
 //export DeviceClose
@@ -251,7 +262,9 @@ func DeviceNewPeer(handle C.int64_t, pubKeyHex *C.char) C.int64_t {
 	if e != nil {
 		return C.int64_t(C.WG_ERR_PEER_CREATE)
 	}
-	return C.int64_t(peerRegistry.Add(peer))
+	peerHandle := peerRegistry.Add(peer)
+	recordPeerOwner(peerHandle, int64(handle), C.GoString(pubKeyHex))
+	return C.int64_t(peerHandle)
 }
 
 //export DeviceLookupPeer
@@ -268,7 +281,9 @@ func DeviceLookupPeer(handle C.int64_t, pubKeyHex *C.char) C.int64_t {
 	if peer == nil {
 		return 0
 	}
-	return C.int64_t(peerRegistry.Add(peer))
+	peerHandle := peerRegistry.Add(peer)
+	recordPeerOwner(peerHandle, int64(handle), C.GoString(pubKeyHex))
+	return C.int64_t(peerHandle)
 }
 
 //export DeviceRemovePeer
@@ -349,6 +364,9 @@ func DeviceSendKeepalivesToPeers(handle C.int64_t) C.int32_t {
 // ---------- Helpers ----------
 
 func getDevice(handle int64) (*device.Device, C.int32_t) {
+	if !Validate(handle, KindDevice) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
 	obj, ok := deviceRegistry.Get(handle)
 	if !ok {
 		return nil, C.WG_ERR_NOT_FOUND
@@ -359,4 +377,4 @@ func getDevice(handle int64) (*device.Device, C.int32_t) {
 //export FreeString
 func FreeString(s *C.char) {
 	C.free(unsafe.Pointer(s))
-}
\ No newline at end of file
+}
@@ -0,0 +1,230 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.zx2c4.com/wireguard/device"
+
+	"wireguard-go-bridge/events"
+)
+
+// eventBus fans device.Logger lines and direct instrumentation points
+// (cookie replies, the under-load poller below) out to subscribers
+// registered through DeviceSubscribeEvents.
+var eventBus = events.NewBus()
+
+// eventSubEntry is what eventSubRegistry stores for a subscription
+// handle: the Subscription itself plus the device handle it was opened
+// against, since Bus.Unsubscribe needs both.
+type eventSubEntry struct {
+	deviceHandle int64
+	sub          *events.Subscription
+}
+
+var eventSubRegistry = NewHandleRegistry()
+
+//export DeviceSubscribeEvents
+func DeviceSubscribeEvents(handle C.int64_t, eventMask C.uint32_t) C.int64_t {
+	if _, errC := getDevice(int64(handle)); errC != C.WG_OK {
+		return 0
+	}
+	sub := eventBus.Subscribe(int64(handle), uint32(eventMask))
+	startUnderLoadMonitor(int64(handle))
+	return C.int64_t(eventSubRegistry.Add(&eventSubEntry{deviceHandle: int64(handle), sub: sub}))
+}
+
+//export DeviceNextEvent
+func DeviceNextEvent(subHandle C.int64_t, timeoutMs C.int, out unsafe.Pointer, outLen *C.int) C.int32_t {
+	obj, ok := eventSubRegistry.Get(int64(subHandle))
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	entry := obj.(*eventSubEntry)
+
+	ev, ok := entry.sub.Next(time.Duration(int(timeoutMs)) * time.Millisecond)
+	if !ok {
+		return C.WG_ERR_TIMEOUT
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return errInternal
+	}
+	if int(*outLen) < len(b) {
+		*outLen = C.int(len(b))
+		return C.WG_ERR_BUFFER_TOO_SMALL
+	}
+	C.memcpy(out, unsafe.Pointer(&b[0]), C.size_t(len(b)))
+	*outLen = C.int(len(b))
+	return errOK
+}
+
+//export EventSubscriptionFree
+func EventSubscriptionFree(subHandle C.int64_t) {
+	obj, ok := eventSubRegistry.Get(int64(subHandle))
+	if !ok {
+		return
+	}
+	entry := obj.(*eventSubEntry)
+	eventBus.Unsubscribe(entry.deviceHandle, entry.sub)
+	entry.sub.Close()
+	eventSubRegistry.Remove(int64(subHandle))
+	stopUnderLoadMonitorIfIdle(entry.deviceHandle)
+}
+
+// ---------- device.Logger instrumentation ----------
+//
+// wireguard-go has no hook points for handshake/bind/MTU transitions
+// beyond its Logger — device.Logger.Verbosef/Errorf are plain func
+// fields, so wrapLoggerForEvents intercepts them and classifies known log
+// lines (see the vendored device package's send.go, receive.go, timers.go,
+// device.go, tun.go, uapi.go) into events, then calls through to the
+// original function so console/file logging is unaffected.
+
+// wrapLoggerForEvents returns a Logger that behaves like inner but also
+// publishes events on eventBus. The device handle isn't known until after
+// deviceRegistry.Add, so the returned setOwner func lets NewDevice fill it
+// in once the handle exists.
+func wrapLoggerForEvents(inner *device.Logger) (wrapped *device.Logger, setOwner func(int64)) {
+	var handle atomic.Int64
+	handle.Store(-1)
+
+	hook := func(orig func(string, ...any)) func(string, ...any) {
+		return func(format string, args ...any) {
+			if orig != nil {
+				orig(format, args...)
+			}
+			if h := handle.Load(); h >= 0 {
+				classifyLogLine(h, format)
+			}
+		}
+	}
+
+	wrapped = &device.Logger{Verbosef: hook(inner.Verbosef), Errorf: hook(inner.Errorf)}
+	return wrapped, func(h int64) { handle.Store(h) }
+}
+
+// classifyLogLine matches the fixed substrings a given call site always
+// logs (format strings, not the formatted line, so they're stable across
+// peer/error interpolation) and publishes the matching event.
+func classifyLogLine(deviceHandle int64, format string) {
+	switch {
+	case strings.Contains(format, "Sending handshake response"),
+		strings.Contains(format, "Received handshake response"):
+		eventBus.Publish(deviceHandle, events.NewEvent(events.KindHandshakeCompleted, nil))
+	case strings.Contains(format, "did not complete after %d attempts, giving up"):
+		eventBus.Publish(deviceHandle, events.NewEvent(events.KindHandshakeFailed, nil))
+	case strings.Contains(format, "UAPI: Updating endpoint"):
+		eventBus.Publish(deviceHandle, events.NewEvent(events.KindPeerEndpointChanged, nil))
+	case strings.Contains(format, "UDP bind has been updated"):
+		eventBus.Publish(deviceHandle, events.NewEvent(events.KindBindUpdated, nil))
+	case strings.Contains(format, "MTU updated"):
+		eventBus.Publish(deviceHandle, events.NewEvent(events.KindTunMTUChanged, nil))
+	}
+}
+
+// publishCookieReplySent is called from CookieCheckerCreateReply
+// (bridge_cookie.go). A CookieChecker handle has no link back to a
+// specific device handle (the same architectural gap
+// allMetricsCollectors works around for MAC1/MAC2 counters), so it fans
+// out to every device's subscribers.
+func publishCookieReplySent() {
+	eventBus.PublishAll(events.NewEvent(events.KindCookieReplySent, nil))
+}
+
+// ---------- under_load polling ----------
+//
+// IsUnderLoad() has no corresponding log line or callback in
+// wireguard-go; it's a plain getter. A short-lived poller per
+// subscribed device diffs it the same way metrics.Collector derives
+// handshake events from IpcGet diffing.
+
+const underLoadPollInterval = 2 * time.Second
+
+var (
+	underLoadMonitorsMu sync.Mutex
+	underLoadMonitors   = make(map[int64]chan struct{})
+)
+
+func startUnderLoadMonitor(deviceHandle int64) {
+	underLoadMonitorsMu.Lock()
+	if _, running := underLoadMonitors[deviceHandle]; running {
+		underLoadMonitorsMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	underLoadMonitors[deviceHandle] = stop
+	underLoadMonitorsMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(underLoadPollInterval)
+		defer ticker.Stop()
+		lastKnown := false
+		for {
+			select {
+			case <-ticker.C:
+				dev, errC := getDevice(deviceHandle)
+				if errC != C.WG_OK {
+					stopUnderLoadMonitor(deviceHandle)
+					return
+				}
+				if current := dev.IsUnderLoad(); current != lastKnown {
+					lastKnown = current
+					eventBus.Publish(deviceHandle, events.NewEvent(events.KindUnderLoadChanged, map[string]string{
+						"under_load": boolString(current),
+					}))
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopUnderLoadMonitorIfIdle stops deviceHandle's poller once it has no
+// remaining subscribers left to notify.
+func stopUnderLoadMonitorIfIdle(deviceHandle int64) {
+	if !eventBus.HasSubscribers(deviceHandle) {
+		stopUnderLoadMonitor(deviceHandle)
+	}
+}
+
+func stopUnderLoadMonitor(deviceHandle int64) {
+	underLoadMonitorsMu.Lock()
+	stop, ok := underLoadMonitors[deviceHandle]
+	if ok {
+		delete(underLoadMonitors, deviceHandle)
+	}
+	underLoadMonitorsMu.Unlock()
+	if ok {
+		close(stop)
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,390 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+
+	"wireguard-go-bridge/l2"
+)
+
+// Layer-2 (Ethernet/TAP) tunnel mode.
+//
+// wireguard-go's device.Device forwards outbound packets purely by an
+// allowed-ips trie lookup; it never inspects payload bytes. A peer whose
+// allowed-ips is the default route (0.0.0.0/0 and ::/0) therefore matches
+// any payload, IP or not — the same trick the multihop tunnels in this
+// file's package already rely on (see CreateMultihopTunnel's use of
+// RemoteAllowedIPs "0.0.0.0/0"). That means raw Ethernet frames can be
+// carried over an ordinary *device.Device without touching the vendored
+// library, as long as each L2 peer gets its own point-to-point device
+// fed by an l2.Pipe instead of a kernel TUN.
+//
+// An l2Tunnel owns one real Linux TAP interface plus one l2.Pipe-backed
+// *device.Device per attached peer. A dispatcher goroutine reads frames
+// off the TAP, learns the source MAC into an l2.FDB, and either forwards
+// a unicast frame to the single peer the FDB says owns the destination
+// MAC, or floods it to every peer (dropping frames this node has already
+// flooded, per l2.SeqCounter). Frames a peer's device decrypts flow the
+// other way: learn, then write to the TAP (or re-flood, for traffic this
+// node must relay on to the others).
+//
+// The data model (FDB, header, Pipe) lives in package l2; this file only
+// holds TAP device lifecycle and the dispatcher, matching the split
+// between multihop's config package and bridge.State's device lifecycle.
+
+const l2FloodSentinel = "*flood*"
+
+// l2PeerEntry is one peer attached to an l2Tunnel.
+type l2PeerEntry struct {
+	pubKeyHex string
+	device    *device.Device
+	pipe      *l2.Pipe
+}
+
+// l2TunnelEntry tracks one live L2 tunnel for cleanup and dispatch.
+type l2TunnelEntry struct {
+	name    string
+	ifname  string
+	mac     string
+	mtu     int
+	tap     *linuxTAP
+	fdb     *l2.FDB
+	seq     *l2.SeqCounter
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	peersMu sync.Mutex
+	peers   map[string]*l2PeerEntry // keyed by peer pubkey hex
+}
+
+var (
+	l2Registry   = make(map[string]*l2TunnelEntry)
+	l2RegistryMu sync.Mutex
+)
+
+// ---------- Tunnel Lifecycle ----------
+
+//export BridgeCreateL2Tunnel
+func BridgeCreateL2Tunnel(name *C.char, ifname *C.char, mac *C.char, mtu C.int, loggerHandle C.int64_t) C.int32_t {
+	goName := C.GoString(name)
+
+	l2RegistryMu.Lock()
+	_, exists := l2Registry[goName]
+	l2RegistryMu.Unlock()
+	if exists {
+		return errInternal
+	}
+
+	tap, err := newLinuxTAP(C.GoString(ifname), int(mtu))
+	if err != nil {
+		return C.WG_ERR_TUN_CREATE
+	}
+
+	entry := &l2TunnelEntry{
+		name:   goName,
+		ifname: tap.name,
+		mac:    C.GoString(mac),
+		mtu:    int(mtu),
+		tap:    tap,
+		fdb:    l2.NewFDB(0),
+		seq:    l2.NewSeqCounter(),
+		stopCh: make(chan struct{}),
+		peers:  make(map[string]*l2PeerEntry),
+	}
+
+	l2RegistryMu.Lock()
+	l2Registry[goName] = entry
+	l2RegistryMu.Unlock()
+
+	entry.wg.Add(1)
+	go entry.dispatchFromTAP()
+
+	return errOK
+}
+
+//export BridgeCloseL2Tunnel
+func BridgeCloseL2Tunnel(name *C.char) C.int32_t {
+	entry, errC := getL2Tunnel(C.GoString(name))
+	if errC != errOK {
+		return errC
+	}
+
+	l2RegistryMu.Lock()
+	delete(l2Registry, entry.name)
+	l2RegistryMu.Unlock()
+
+	close(entry.stopCh)
+	_ = entry.tap.Close()
+	entry.peersMu.Lock()
+	for _, p := range entry.peers {
+		p.device.Close()
+	}
+	entry.peersMu.Unlock()
+	entry.wg.Wait()
+
+	return errOK
+}
+
+// ---------- Peer Attachment ----------
+
+//export BridgeAttachL2Peer
+func BridgeAttachL2Peer(name *C.char, pubKeyHex *C.char, loggerHandle C.int64_t) C.int64_t {
+	entry, errC := getL2Tunnel(C.GoString(name))
+	if errC != errOK {
+		return C.int64_t(errC)
+	}
+
+	goPubKey := C.GoString(pubKeyHex)
+
+	var pk device.NoisePublicKey
+	if e := pk.FromHex(goPubKey); e != nil {
+		return C.int64_t(C.WG_ERR_KEY_PARSE)
+	}
+
+	pipe := l2.NewPipe(entry.ifname+"/"+goPubKey, entry.mtu, 256)
+	bind := conn.NewDefaultBind()
+	logger := getLogger(int64(loggerHandle))
+
+	dev := device.NewDevice(pipe, bind, logger)
+	if dev == nil {
+		_ = pipe.Close()
+		return C.int64_t(C.WG_ERR_DEVICE_CREATE)
+	}
+
+	// Default-route allowed-ips: the frames this device carries are raw
+	// Ethernet, not IP, but the trie matches on bytes alone, so a
+	// default route matches everything regardless of content.
+	ipcConfig := fmt.Sprintf("public_key=%s\nallowed_ip=0.0.0.0/0\nallowed_ip=::/0\n", goPubKey)
+	if e := dev.IpcSet(ipcConfig); e != nil {
+		dev.Close()
+		return C.int64_t(C.WG_ERR_IPC_SET)
+	}
+	if e := dev.Up(); e != nil {
+		dev.Close()
+		return C.int64_t(C.WG_ERR_DEVICE_UP)
+	}
+
+	peerEntry := &l2PeerEntry{pubKeyHex: goPubKey, device: dev, pipe: pipe}
+
+	entry.peersMu.Lock()
+	entry.peers[goPubKey] = peerEntry
+	entry.peersMu.Unlock()
+
+	entry.wg.Add(1)
+	go entry.dispatchFromPeer(peerEntry)
+
+	handle := deviceRegistry.Add(&deviceEntry{device: dev, tun: pipe})
+	return C.int64_t(handle)
+}
+
+//export BridgeDetachL2Peer
+func BridgeDetachL2Peer(name *C.char, pubKeyHex *C.char) C.int32_t {
+	entry, errC := getL2Tunnel(C.GoString(name))
+	if errC != errOK {
+		return errC
+	}
+	goPubKey := C.GoString(pubKeyHex)
+
+	entry.peersMu.Lock()
+	peerEntry, ok := entry.peers[goPubKey]
+	if ok {
+		delete(entry.peers, goPubKey)
+	}
+	entry.peersMu.Unlock()
+
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	peerEntry.device.Close()
+	return errOK
+}
+
+// ---------- FDB Accessors ----------
+
+//export BridgeDumpL2FDB
+func BridgeDumpL2FDB(name *C.char) *C.char {
+	entry, errC := getL2Tunnel(C.GoString(name))
+	if errC != errOK {
+		return nil
+	}
+	b, err := json.Marshal(entry.fdb.Dump())
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(b))
+}
+
+//export BridgeFlushL2FDB
+func BridgeFlushL2FDB(name *C.char) C.int32_t {
+	entry, errC := getL2Tunnel(C.GoString(name))
+	if errC != errOK {
+		return errC
+	}
+	entry.fdb.Flush()
+	return errOK
+}
+
+// ---------- Dispatch ----------
+
+// dispatchFromTAP reads frames off the real TAP device, learns the source
+// MAC, and forwards each frame to the single owning peer (unicast) or
+// every attached peer (flood: broadcast, multicast, or an unlearned
+// destination).
+func (e *l2TunnelEntry) dispatchFromTAP() {
+	defer e.wg.Done()
+	buf := make([]byte, e.mtu+14) // +Ethernet header
+
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		default:
+		}
+
+		n, err := e.tap.file.Read(buf)
+		if err != nil {
+			continue
+		}
+		frame := append([]byte(nil), buf[:n]...)
+		if len(frame) < 12 {
+			continue
+		}
+		srcMAC := macString(frame[6:12])
+		dstMAC := macString(frame[0:6])
+		e.fdb.Learn(srcMAC, l2FloodSentinel)
+
+		seq := e.seq.Next(srcMAC)
+		encoded := l2.EncodeHeader(seq, frame)
+
+		if peerKey, ok := e.fdb.Lookup(dstMAC); ok && peerKey != l2FloodSentinel {
+			e.injectTo(peerKey, encoded)
+			continue
+		}
+		e.floodToPeers(encoded, "")
+	}
+}
+
+// dispatchFromPeer drains frames a peer's WireGuard device has decrypted,
+// learns the peer as the owner of the frame's source MAC, writes the
+// frame to the real TAP, and re-floods it to every other peer if it
+// hasn't been seen before (so a multi-peer L2 segment behaves like a
+// bridge rather than a star of point-to-point links).
+func (e *l2TunnelEntry) dispatchFromPeer(p *l2PeerEntry) {
+	defer e.wg.Done()
+
+	for {
+		raw, err := p.pipe.Drain()
+		if err != nil {
+			return
+		}
+		seq, frame, ok := l2.DecodeHeader(raw)
+		if !ok || len(frame) < 12 {
+			continue
+		}
+		srcMAC := macString(frame[6:12])
+		if e.seq.Seen(srcMAC, seq) {
+			continue
+		}
+		e.fdb.Learn(srcMAC, p.pubKeyHex)
+
+		_, _ = e.tap.file.Write(frame)
+		e.floodToPeers(l2.EncodeHeader(seq, frame), p.pubKeyHex)
+	}
+}
+
+// injectTo hands frame to the single peer identified by peerKey, if still
+// attached.
+func (e *l2TunnelEntry) injectTo(peerKey string, frame []byte) {
+	e.peersMu.Lock()
+	p, ok := e.peers[peerKey]
+	e.peersMu.Unlock()
+	if !ok {
+		return
+	}
+	_ = p.pipe.Inject(frame)
+}
+
+// floodToPeers hands frame to every attached peer except exclude (empty
+// excludes nobody).
+func (e *l2TunnelEntry) floodToPeers(frame []byte, exclude string) {
+	e.peersMu.Lock()
+	defer e.peersMu.Unlock()
+	for key, p := range e.peers {
+		if key == exclude {
+			continue
+		}
+		_ = p.pipe.Inject(frame)
+	}
+}
+
+func macString(b []byte) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", b[0], b[1], b[2], b[3], b[4], b[5])
+}
+
+func getL2Tunnel(name string) (*l2TunnelEntry, C.int32_t) {
+	l2RegistryMu.Lock()
+	entry, ok := l2Registry[name]
+	l2RegistryMu.Unlock()
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return entry, errOK
+}
+
+// ---------- Linux TAP Device ----------
+//
+// wireguard-go's tun.CreateTUN only ever opens /dev/net/tun with IFF_TUN;
+// there is no IFF_TAP equivalent in the vendored library (confirmed: no
+// CreateTAP anywhere in golang.zx2c4.com/wireguard/tun). linuxTAP is a
+// small, purpose-built opener for the IFF_TAP case, modeled on the ioctl
+// sequence tun_linux.go uses for IFF_TUN.
+
+type linuxTAP struct {
+	file *os.File
+	name string
+}
+
+func newLinuxTAP(ifname string, mtu int) (*linuxTAP, error) {
+	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open /dev/net/tun: %w", err)
+	}
+
+	ifr, err := unix.NewIfreq(ifname)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	ifr.SetUint16(unix.IFF_TAP | unix.IFF_NO_PI)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("TUNSETIFF: %w", err)
+	}
+
+	return &linuxTAP{file: os.NewFile(uintptr(fd), "/dev/net/tun"), name: ifr.Name()}, nil
+}
+
+func (t *linuxTAP) Close() error {
+	return t.file.Close()
+}
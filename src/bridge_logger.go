@@ -17,9 +17,12 @@ package main
 */
 import "C"
 import (
+	"sync"
 	"unsafe"
 
 	"golang.zx2c4.com/wireguard/device"
+
+	"wireguard-go-bridge/logsink"
 )
 
 //export SetLogCallback
@@ -30,28 +33,132 @@ func SetLogCallback(callback C.WgLogCallback, context unsafe.Pointer) { //nolint
 	_ = context
 }
 
+// loggerSinksByHandle holds the logsink.Sink backing each logger handle
+// created through NewLogger, so LoggerSetLevel/LoggerSetFormat can
+// reconfigure it after the fact even though loggerRegistry only stores
+// the *device.Logger view of it.
+var (
+	loggerSinksByHandle   = make(map[int64]*logsink.Sink)
+	loggerSinksByHandleMu sync.Mutex
+)
+
 //export NewLogger
 func NewLogger(level C.int, prepend *C.char) C.int64_t {
-	goLevel := int(level)
-	goPrepend := C.GoString(prepend)
-	logger := device.NewLogger(goLevel, goPrepend)
-	return C.int64_t(loggerRegistry.Add(logger))
+	sink := logsink.NewSink(logsink.Level(level), C.GoString(prepend))
+	logger := &device.Logger{Verbosef: sink.Verbosef, Errorf: sink.Errorf}
+
+	handle := loggerRegistry.Add(logger)
+	loggerSinksByHandleMu.Lock()
+	loggerSinksByHandle[handle] = sink
+	loggerSinksByHandleMu.Unlock()
+	return C.int64_t(handle)
+}
+
+//export LoggerSetLevel
+func LoggerSetLevel(handle C.int64_t, level C.int) C.int32_t {
+	sink, ok := getLoggerSink(int64(handle))
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	sink.SetLevel(logsink.Level(level))
+	return errOK
+}
+
+//export LoggerSetFormat
+func LoggerSetFormat(handle C.int64_t, format C.int) C.int32_t {
+	sink, ok := getLoggerSink(int64(handle))
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	sink.SetFormat(logsink.Format(format))
+	return errOK
 }
 
 //export LoggerFree
 func LoggerFree(handle C.int64_t) {
+	loggerSinksByHandleMu.Lock()
+	delete(loggerSinksByHandle, int64(handle))
+	loggerSinksByHandleMu.Unlock()
 	loggerRegistry.Remove(int64(handle))
 }
 
+func getLoggerSink(handle int64) (*logsink.Sink, bool) {
+	loggerSinksByHandleMu.Lock()
+	defer loggerSinksByHandleMu.Unlock()
+	sink, ok := loggerSinksByHandle[handle]
+	return sink, ok
+}
+
 //export DiscardLogf
 func DiscardLogf() {
 	// No-op: device.DiscardLogf discards all log output.
 }
 
 func getLogger(handle int64) *device.Logger {
+	if !Validate(handle, KindLogger) {
+		return device.NewLogger(device.LogLevelSilent, "")
+	}
 	obj, ok := loggerRegistry.Get(handle)
 	if !ok {
 		return device.NewLogger(device.LogLevelSilent, "")
 	}
 	return obj.(*device.Logger)
-}
\ No newline at end of file
+}
+
+// deviceLoggerRedirect is what a device's fixed *device.Logger (set once,
+// unexported, at device.NewDevice) actually calls into. device.log can't
+// be reassigned after construction, but the Logger object NewDevice hands
+// it can hold a level of indirection of our own: DeviceSetLogger swaps
+// which *device.Logger this redirect forwards to, so a single process can
+// move a device to a different logger handle without recreating it.
+type deviceLoggerRedirect struct {
+	mu    sync.RWMutex
+	inner *device.Logger
+}
+
+func (r *deviceLoggerRedirect) setInner(l *device.Logger) {
+	r.mu.Lock()
+	r.inner = l
+	r.mu.Unlock()
+}
+
+func (r *deviceLoggerRedirect) verbosef(format string, args ...any) {
+	r.mu.RLock()
+	inner := r.inner
+	r.mu.RUnlock()
+	if inner != nil && inner.Verbosef != nil {
+		inner.Verbosef(format, args...)
+	}
+}
+
+func (r *deviceLoggerRedirect) errorf(format string, args ...any) {
+	r.mu.RLock()
+	inner := r.inner
+	r.mu.RUnlock()
+	if inner != nil && inner.Errorf != nil {
+		inner.Errorf(format, args...)
+	}
+}
+
+var (
+	deviceLoggerRedirectsByHandle   = make(map[int64]*deviceLoggerRedirect)
+	deviceLoggerRedirectsByHandleMu sync.Mutex
+)
+
+func registerDeviceLoggerRedirect(deviceHandle int64, redirect *deviceLoggerRedirect) {
+	deviceLoggerRedirectsByHandleMu.Lock()
+	deviceLoggerRedirectsByHandle[deviceHandle] = redirect
+	deviceLoggerRedirectsByHandleMu.Unlock()
+}
+
+//export DeviceSetLogger
+func DeviceSetLogger(handle C.int64_t, loggerHandle C.int64_t) C.int32_t {
+	deviceLoggerRedirectsByHandleMu.Lock()
+	redirect, ok := deviceLoggerRedirectsByHandle[int64(handle)]
+	deviceLoggerRedirectsByHandleMu.Unlock()
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	redirect.setInner(getLogger(int64(loggerHandle)))
+	return errOK
+}
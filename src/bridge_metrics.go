@@ -0,0 +1,117 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"sync"
+
+	"wireguard-go-bridge/metrics"
+)
+
+// metricsByHandle holds the running Collector for each low-level device
+// handle that has had MetricsStart called on it, keyed the same way
+// bindOptionsByHandle and netstackNets side-map auxiliary state onto an
+// existing deviceRegistry handle.
+var (
+	metricsByHandle   = make(map[int64]*metrics.Collector)
+	metricsByHandleMu sync.Mutex
+)
+
+//export MetricsStart
+func MetricsStart(handle C.int64_t, listenAddr *C.char, intervalSec C.int) C.int32_t {
+	dev, errC := getDevice(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+
+	metricsByHandleMu.Lock()
+	if _, exists := metricsByHandle[int64(handle)]; exists {
+		metricsByHandleMu.Unlock()
+		return errInternal
+	}
+
+	collector := metrics.NewCollector(func() (metrics.Snapshot, error) {
+		ipcOutput, err := dev.IpcGet()
+		if err != nil {
+			return metrics.Snapshot{}, err
+		}
+		return metrics.Snapshot{
+			IpcOutput:   ipcOutput,
+			IsUnderLoad: dev.IsUnderLoad(),
+			BatchSize:   dev.BatchSize(),
+		}, nil
+	}, int(intervalSec))
+
+	if err := collector.Start(C.GoString(listenAddr)); err != nil {
+		metricsByHandleMu.Unlock()
+		return errInternal
+	}
+	metricsByHandle[int64(handle)] = collector
+	metricsByHandleMu.Unlock()
+
+	return errOK
+}
+
+//export MetricsStop
+func MetricsStop(handle C.int64_t) C.int32_t {
+	metricsByHandleMu.Lock()
+	collector, ok := metricsByHandle[int64(handle)]
+	if ok {
+		delete(metricsByHandle, int64(handle))
+	}
+	metricsByHandleMu.Unlock()
+
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	collector.Stop()
+	return errOK
+}
+
+//export MetricsSnapshot
+func MetricsSnapshot(handle C.int64_t) *C.char {
+	metricsByHandleMu.Lock()
+	collector, ok := metricsByHandle[int64(handle)]
+	metricsByHandleMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return C.CString(collector.Render())
+}
+
+// metricsCollectorForHandle returns the Collector for handle, if any, so
+// other low-level FFI paths (e.g. CookieCheckerCheckMAC1/MAC2) can push
+// counter updates into it.
+func metricsCollectorForHandle(handle int64) (*metrics.Collector, bool) {
+	metricsByHandleMu.Lock()
+	defer metricsByHandleMu.Unlock()
+	c, ok := metricsByHandle[handle]
+	return c, ok
+}
+
+// allMetricsCollectors returns every currently-running Collector, for
+// events (like a cookie check) that aren't naturally scoped to one
+// device handle.
+func allMetricsCollectors() []*metrics.Collector {
+	metricsByHandleMu.Lock()
+	defer metricsByHandleMu.Unlock()
+	out := make([]*metrics.Collector, 0, len(metricsByHandle))
+	for _, c := range metricsByHandle {
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+//
+// bridge_multihop_chain.go — FFI for bridge.State's multihop.Manager-backed
+// chains (MultihopChainUp/Down/Status), as opposed to MultihopStart/Stop/
+// Status which drive bridge.State's own DB-modeled multihop tunnels.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+
+//export MultihopChainUp
+func MultihopChainUp(chainJSON *C.char) C.int64_t {
+	handle, err := bridgeState.ChainUp(C.GoString(chainJSON))
+	if err != nil {
+		return 0
+	}
+	return C.int64_t(handle)
+}
+
+//export MultihopChainDown
+func MultihopChainDown(handle C.int64_t) C.int32_t {
+	if err := bridgeState.ChainDown(int64(handle)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+//export MultihopChainStatus
+func MultihopChainStatus(handle C.int64_t) *C.char {
+	result, err := bridgeState.ChainStatus(int64(handle))
+	if err != nil {
+		return nil
+	}
+	return C.CString(result)
+}
@@ -0,0 +1,55 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+//
+// bridge_multihop_pong.go — FFI for the multihop out-of-band pong health
+// check (bridge.State.SetMultihopPongConfig/StartMultihopPongPoll/
+// MultihopChainHealth, see bridge/multihop_pong.go). Named like
+// BridgeSetMultihopRelay in bridge_multihop_relay.go: keyed by tunnel
+// name, not a handle.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+
+//export BridgeSetMultihopPongConfig
+func BridgeSetMultihopPongConfig(name *C.char, port C.int, intervalSec C.int) C.int32_t {
+	if err := bridgeState.SetMultihopPongConfig(C.GoString(name), int(port), int(intervalSec)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+//export BridgeStartMultihopPongPoll
+func BridgeStartMultihopPongPoll() C.int32_t {
+	if err := bridgeState.StartMultihopPongPoll(); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+//export BridgeStopMultihopPongPoll
+func BridgeStopMultihopPongPoll() C.int32_t {
+	_ = bridgeState.StopMultihopPongPoll()
+	return errOK
+}
+
+//export MultihopChainHealth
+func MultihopChainHealth() *C.char {
+	result, err := bridgeState.MultihopChainHealth()
+	if err != nil {
+		return nil
+	}
+	return C.CString(result)
+}
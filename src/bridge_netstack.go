@@ -0,0 +1,318 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// netstackNets maps a deviceRegistry handle (as returned by NewDeviceNetstack)
+// to the in-process network stack backing it, so socket/ping operations can
+// find their way back to the right tunnel without a separate handle space.
+var (
+	netstackNets   = make(map[int64]*netstack.Net)
+	netstackNetsMu sync.Mutex
+)
+
+// ---------- Netstack Device Lifecycle ----------
+
+// NewDeviceNetstack is the userspace-TUN counterpart of NewDevice: instead of
+// opening a kernel TUN it creates a gVisor netstack bound to localAddrsCSV
+// (comma-separated IPs, e.g. "10.0.0.2,fd00::2") and returns a handle usable
+// with the existing Device* FFI (IpcSet, Up, NewPeer, ...) exactly like a
+// kernel-backed device. Use the same handle with the Netstack* socket and
+// BridgeNetstackPing functions below to reach the tunnel without root.
+//
+//export NewDeviceNetstack
+func NewDeviceNetstack(localAddrsCSV *C.char, mtu C.int, loggerHandle C.int64_t) C.int64_t {
+	addrs, err := parseNetstackAddrs(C.GoString(localAddrsCSV))
+	if err != nil || len(addrs) == 0 {
+		return C.int64_t(C.WG_ERR_TUN_CREATE)
+	}
+
+	tunDev, tnet, err := netstack.CreateNetTUN(addrs, nil, int(mtu))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_TUN_CREATE)
+	}
+
+	logger := getLogger(int64(loggerHandle))
+	bind := conn.NewDefaultBind()
+	dev := device.NewDevice(tunDev, bind, logger)
+	if dev == nil {
+		_ = tunDev.Close()
+		return C.int64_t(C.WG_ERR_DEVICE_CREATE)
+	}
+
+	entry := &deviceEntry{device: dev, tun: tunDev}
+	handle := deviceRegistry.Add(entry)
+
+	netstackNetsMu.Lock()
+	netstackNets[handle] = tnet
+	netstackNetsMu.Unlock()
+
+	return C.int64_t(handle)
+}
+
+// NetstackDeviceClose closes a device created by NewDeviceNetstack and
+// forgets its netstack mapping. DeviceClose alone would leave the mapping
+// behind since it knows nothing about netstack-backed devices.
+//
+//export NetstackDeviceClose
+func NetstackDeviceClose(handle C.int64_t) C.int32_t {
+	obj, ok := deviceRegistry.Get(int64(handle))
+	if ok {
+		entry := obj.(*deviceEntry)
+		entry.device.Close()
+		deviceRegistry.Remove(int64(handle))
+	}
+
+	netstackNetsMu.Lock()
+	delete(netstackNets, int64(handle))
+	netstackNetsMu.Unlock()
+
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	return C.WG_OK
+}
+
+// ---------- In-Process Sockets ----------
+
+//export NetstackDialTCP
+func NetstackDialTCP(handle C.int64_t, addr *C.char) C.int64_t {
+	tnet, errC := getNetstackNet(int64(handle))
+	if errC != C.WG_OK {
+		return C.int64_t(errC)
+	}
+	raddr, err := net.ResolveTCPAddr("tcp", C.GoString(addr))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	conn, err := tnet.DialTCP(raddr)
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackConnRegistry.Add(conn))
+}
+
+//export NetstackListenTCP
+func NetstackListenTCP(handle C.int64_t, addr *C.char) C.int64_t {
+	tnet, errC := getNetstackNet(int64(handle))
+	if errC != C.WG_OK {
+		return C.int64_t(errC)
+	}
+	laddr, err := net.ResolveTCPAddr("tcp", C.GoString(addr))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	ln, err := tnet.ListenTCP(laddr)
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackListenerRegistry.Add(ln))
+}
+
+//export NetstackAccept
+func NetstackAccept(listenerHandle C.int64_t) C.int64_t {
+	obj, ok := netstackListenerRegistry.Get(int64(listenerHandle))
+	if !ok {
+		return C.int64_t(C.WG_ERR_NOT_FOUND)
+	}
+	ln := obj.(net.Listener)
+	c, err := ln.Accept()
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackConnRegistry.Add(c))
+}
+
+//export NetstackListenerClose
+func NetstackListenerClose(listenerHandle C.int64_t) C.int32_t {
+	obj, ok := netstackListenerRegistry.Get(int64(listenerHandle))
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	_ = obj.(net.Listener).Close()
+	netstackListenerRegistry.Remove(int64(listenerHandle))
+	return C.WG_OK
+}
+
+//export NetstackDialUDP
+func NetstackDialUDP(handle C.int64_t, addr *C.char) C.int64_t {
+	tnet, errC := getNetstackNet(int64(handle))
+	if errC != C.WG_OK {
+		return C.int64_t(errC)
+	}
+	raddr, err := net.ResolveUDPAddr("udp", C.GoString(addr))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	conn, err := tnet.DialUDP(nil, raddr)
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackConnRegistry.Add(conn))
+}
+
+//export NetstackListenUDP
+func NetstackListenUDP(handle C.int64_t, addr *C.char) C.int64_t {
+	tnet, errC := getNetstackNet(int64(handle))
+	if errC != C.WG_OK {
+		return C.int64_t(errC)
+	}
+	laddr, err := net.ResolveUDPAddr("udp", C.GoString(addr))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	conn, err := tnet.ListenUDP(laddr)
+	if err != nil {
+		return C.int64_t(C.WG_ERR_INTERNAL)
+	}
+	return C.int64_t(netstackConnRegistry.Add(conn))
+}
+
+//export NetstackRead
+func NetstackRead(connHandle C.int64_t, buf *C.char, bufLen C.int) C.int {
+	obj, ok := netstackConnRegistry.Get(int64(connHandle))
+	if !ok {
+		return -1
+	}
+	n, err := obj.(net.Conn).Read(cBufToSlice(buf, int(bufLen)))
+	if err != nil {
+		return -1
+	}
+	return C.int(n)
+}
+
+//export NetstackWrite
+func NetstackWrite(connHandle C.int64_t, buf *C.char, bufLen C.int) C.int {
+	obj, ok := netstackConnRegistry.Get(int64(connHandle))
+	if !ok {
+		return -1
+	}
+	n, err := obj.(net.Conn).Write(cBufToSlice(buf, int(bufLen)))
+	if err != nil {
+		return -1
+	}
+	return C.int(n)
+}
+
+//export NetstackConnClose
+func NetstackConnClose(connHandle C.int64_t) C.int32_t {
+	obj, ok := netstackConnRegistry.Get(int64(connHandle))
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+	_ = obj.(net.Conn).Close()
+	netstackConnRegistry.Remove(int64(connHandle))
+	return C.WG_OK
+}
+
+// ---------- ICMP Ping ----------
+
+// BridgeNetstackPing sends a single ICMP echo request for ipStr through the
+// netstack device identified by handle, carrying payload as the echo body,
+// and returns the measured round-trip time in milliseconds. The identifier
+// and sequence correlation are handled by netstack's ping endpoint itself
+// (one echo request per call, matched against the first reply received).
+// Negative return values signal failure: -1 unknown/non-netstack handle,
+// -2 invalid ipStr, -3 dial or write error, -4 timeout or read error.
+//
+//export BridgeNetstackPing
+func BridgeNetstackPing(handle C.int64_t, ipStr *C.char, timeoutMs C.int, payload *C.char, payloadLen C.int) C.int64_t {
+	tnet, errC := getNetstackNet(int64(handle))
+	if errC != C.WG_OK {
+		return -1
+	}
+
+	target, err := netip.ParseAddr(C.GoString(ipStr))
+	if err != nil {
+		return -2
+	}
+	local := netip.IPv4Unspecified()
+	if target.Is6() {
+		local = netip.IPv6Unspecified()
+	}
+
+	pc, err := tnet.DialPingAddr(local, target)
+	if err != nil {
+		return -3
+	}
+	defer pc.Close()
+
+	body := cBufToSlice(payload, int(payloadLen))
+	start := time.Now()
+	if _, err := pc.Write(body); err != nil {
+		return -3
+	}
+	if err := pc.SetReadDeadline(start.Add(time.Duration(timeoutMs) * time.Millisecond)); err != nil {
+		return -3
+	}
+
+	reply := make([]byte, len(body)+64)
+	if _, err := pc.Read(reply); err != nil {
+		return -4
+	}
+	return C.int64_t(time.Since(start).Milliseconds())
+}
+
+// ---------- Helpers ----------
+
+func getNetstackNet(handle int64) (*netstack.Net, C.int32_t) {
+	netstackNetsMu.Lock()
+	tnet, ok := netstackNets[handle]
+	netstackNetsMu.Unlock()
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return tnet, C.WG_OK
+}
+
+func parseNetstackAddrs(csv string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, part := range strings.Split(csv, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// cBufToSlice views a C buffer as a Go []byte without copying. The caller
+// (deviceRegistry/netstackConnRegistry FFI wrappers) owns the buffer for the
+// duration of the call only.
+func cBufToSlice(buf *C.char, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(buf)), n)
+}
@@ -53,6 +53,8 @@ func PeerString(handle C.int64_t) *C.char {
 
 //export PeerFree
 func PeerFree(handle C.int64_t) {
+	stopPeerEndpointScheduler(int64(handle))
+	forgetPeerOwner(int64(handle))
 	peerRegistry.Remove(int64(handle))
 }
 
@@ -160,9 +162,12 @@ func PeerZeroAndFlushAll(handle C.int64_t) C.int32_t {
 // ---------- Helper ----------
 
 func getPeer(handle int64) (*device.Peer, C.int32_t) {
+	if !Validate(handle, KindPeer) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
 	obj, ok := peerRegistry.Get(handle)
 	if !ok {
 		return nil, C.WG_ERR_NOT_FOUND
 	}
 	return obj.(*device.Peer), C.WG_OK
-}
\ No newline at end of file
+}
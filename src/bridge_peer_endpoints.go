@@ -0,0 +1,348 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint selection modes for PeerSetEndpointList's mode parameter.
+const (
+	PeerEndpointPrimaryFailover C.int = 0
+	PeerEndpointRoundRobin      C.int = 1
+	PeerEndpointLatencyWeighted C.int = 2
+)
+
+const (
+	peerEndpointTickInterval = 2 * time.Second
+	peerEndpointRetryLimit   = 3
+)
+
+// peerOwnerInfo is what PeerSetEndpointList needs that a *device.Peer
+// doesn't expose: which device handle created it, and its public key hex.
+// Recorded by DeviceNewPeer/DeviceLookupPeer, the only two places both are
+// known together; forgotten on PeerFree.
+type peerOwnerInfo struct {
+	deviceHandle int64
+	pubKeyHex    string
+}
+
+var (
+	peerOwnersMu sync.Mutex
+	peerOwners   = make(map[int64]peerOwnerInfo)
+)
+
+func recordPeerOwner(peerHandle, deviceHandle int64, pubKeyHex string) {
+	peerOwnersMu.Lock()
+	peerOwners[peerHandle] = peerOwnerInfo{deviceHandle: deviceHandle, pubKeyHex: strings.ToLower(pubKeyHex)}
+	peerOwnersMu.Unlock()
+}
+
+func forgetPeerOwner(peerHandle int64) {
+	peerOwnersMu.Lock()
+	delete(peerOwners, peerHandle)
+	peerOwnersMu.Unlock()
+}
+
+func getPeerOwner(peerHandle int64) (peerOwnerInfo, bool) {
+	peerOwnersMu.Lock()
+	defer peerOwnersMu.Unlock()
+	owner, ok := peerOwners[peerHandle]
+	return owner, ok
+}
+
+// endpointStat is the observed success/failure record for one endpoint in
+// a peer's list, as judged by whether the device's last_handshake_time_sec
+// for this peer advances between scheduler ticks.
+type endpointStat struct {
+	Successes int64 `json:"successes"`
+	Failures  int64 `json:"failures"`
+}
+
+// peerEndpointScheduler swaps a peer's active UAPI endpoint when the
+// current one stops completing handshakes. There's no UAPI field exposing
+// per-packet RTT, so "latency" for PeerEndpointLatencyWeighted is
+// approximated from handshake staleness the same way metrics.Collector
+// and db.StatsSyncer already derive handshake events: by diffing
+// last_handshake_time_sec across ticks.
+type peerEndpointScheduler struct {
+	peerHandle   int64
+	deviceHandle int64
+	pubKeyHex    string
+
+	mu            sync.Mutex
+	endpoints     []string
+	mode          C.int
+	activeIdx     int
+	failStreak    int
+	lastHandshake int64
+	stats         map[string]*endpointStat
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+var (
+	peerSchedulersMu sync.Mutex
+	peerSchedulers   = make(map[int64]*peerEndpointScheduler)
+)
+
+func newPeerEndpointScheduler(peerHandle, deviceHandle int64, pubKeyHex string, endpoints []string, mode C.int) *peerEndpointScheduler {
+	stats := make(map[string]*endpointStat, len(endpoints))
+	for _, ep := range endpoints {
+		stats[ep] = &endpointStat{}
+	}
+	return &peerEndpointScheduler{
+		peerHandle:   peerHandle,
+		deviceHandle: deviceHandle,
+		pubKeyHex:    pubKeyHex,
+		endpoints:    endpoints,
+		mode:         mode,
+		stats:        stats,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (s *peerEndpointScheduler) start() {
+	s.applyEndpoint(s.endpoints[s.activeIdx])
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(peerEndpointTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.tick()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *peerEndpointScheduler) close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *peerEndpointScheduler) tick() {
+	dev, errC := getDevice(s.deviceHandle)
+	if errC != C.WG_OK {
+		return
+	}
+	ipc, err := dev.IpcGet()
+	if err != nil {
+		return
+	}
+	handshake, ok := peerLastHandshake(ipc, s.pubKeyHex)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	cur := s.endpoints[s.activeIdx]
+	st := s.stats[cur]
+	if handshake > s.lastHandshake {
+		s.lastHandshake = handshake
+		s.failStreak = 0
+		st.Successes++
+	} else {
+		s.failStreak++
+		st.Failures++
+	}
+
+	var next string
+	swap := len(s.endpoints) > 1 && s.failStreak >= peerEndpointRetryLimit
+	if swap {
+		s.activeIdx = s.pickNext()
+		next = s.endpoints[s.activeIdx]
+		s.failStreak = 0
+	}
+	s.mu.Unlock()
+
+	if swap && next != cur {
+		s.applyEndpoint(next)
+	}
+}
+
+// pickNext chooses the next endpoint index after the active one has
+// failed enough retries. Caller holds s.mu.
+func (s *peerEndpointScheduler) pickNext() int {
+	switch s.mode {
+	case PeerEndpointPrimaryFailover:
+		// Fall back off the primary; always retry the primary next.
+		if s.activeIdx == 0 {
+			return 1 % len(s.endpoints)
+		}
+		return 0
+	case PeerEndpointLatencyWeighted:
+		best := (s.activeIdx + 1) % len(s.endpoints)
+		bestScore := s.successRatio(s.endpoints[best])
+		for i, ep := range s.endpoints {
+			if i == s.activeIdx {
+				continue
+			}
+			if score := s.successRatio(ep); score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		return best
+	default: // PeerEndpointRoundRobin
+		return (s.activeIdx + 1) % len(s.endpoints)
+	}
+}
+
+func (s *peerEndpointScheduler) successRatio(ep string) float64 {
+	st := s.stats[ep]
+	total := st.Successes + st.Failures
+	if total == 0 {
+		return 0.5 // unknown endpoints get a neutral score, ahead of ones with observed failures
+	}
+	return float64(st.Successes) / float64(total)
+}
+
+func (s *peerEndpointScheduler) applyEndpoint(ep string) {
+	dev, errC := getDevice(s.deviceHandle)
+	if errC != C.WG_OK {
+		return
+	}
+	_ = dev.IpcSet(fmt.Sprintf("public_key=%s\nendpoint=%s\n", s.pubKeyHex, ep))
+}
+
+func (s *peerEndpointScheduler) activeEndpoint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endpoints[s.activeIdx]
+}
+
+func (s *peerEndpointScheduler) statsJSON() map[string]endpointStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]endpointStat, len(s.stats))
+	for ep, st := range s.stats {
+		out[ep] = *st
+	}
+	return out
+}
+
+//export PeerSetEndpointList
+func PeerSetEndpointList(peerHandle C.int64_t, endpoints *C.char, mode C.int) C.int32_t {
+	owner, ok := getPeerOwner(int64(peerHandle))
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+
+	var list []string
+	for _, part := range strings.Split(C.GoString(endpoints), ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			list = append(list, part)
+		}
+	}
+	if len(list) == 0 {
+		return C.WG_ERR_INTERNAL
+	}
+
+	sched := newPeerEndpointScheduler(int64(peerHandle), owner.deviceHandle, owner.pubKeyHex, list, mode)
+
+	peerSchedulersMu.Lock()
+	if old, exists := peerSchedulers[int64(peerHandle)]; exists {
+		delete(peerSchedulers, int64(peerHandle))
+		peerSchedulersMu.Unlock()
+		old.close()
+		peerSchedulersMu.Lock()
+	}
+	peerSchedulers[int64(peerHandle)] = sched
+	peerSchedulersMu.Unlock()
+
+	sched.start()
+	return errOK
+}
+
+//export PeerGetActiveEndpoint
+func PeerGetActiveEndpoint(peerHandle C.int64_t) *C.char {
+	sched, ok := getPeerEndpointScheduler(int64(peerHandle))
+	if !ok {
+		return nil
+	}
+	return C.CString(sched.activeEndpoint())
+}
+
+//export PeerEndpointStats
+func PeerEndpointStats(peerHandle C.int64_t) *C.char {
+	sched, ok := getPeerEndpointScheduler(int64(peerHandle))
+	if !ok {
+		return nil
+	}
+	b, _ := json.Marshal(sched.statsJSON())
+	return C.CString(string(b))
+}
+
+func getPeerEndpointScheduler(peerHandle int64) (*peerEndpointScheduler, bool) {
+	peerSchedulersMu.Lock()
+	defer peerSchedulersMu.Unlock()
+	sched, ok := peerSchedulers[peerHandle]
+	return sched, ok
+}
+
+// stopPeerEndpointScheduler stops and forgets peerHandle's scheduler, if
+// any. Called from PeerFree so a freed peer doesn't leave a goroutine
+// writing endpoint= UAPI updates for a handle that no longer exists.
+func stopPeerEndpointScheduler(peerHandle int64) {
+	peerSchedulersMu.Lock()
+	sched, ok := peerSchedulers[peerHandle]
+	if ok {
+		delete(peerSchedulers, peerHandle)
+	}
+	peerSchedulersMu.Unlock()
+	if ok {
+		sched.close()
+	}
+}
+
+// peerLastHandshake parses device.IpcGet() output and returns the
+// last_handshake_time_sec reported for the peer identified by pubKeyHex.
+func peerLastHandshake(ipc, pubKeyHex string) (int64, bool) {
+	var currentKey string
+	for _, line := range strings.Split(ipc, "\n") {
+		line = strings.TrimSpace(line)
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := parts[0], parts[1]
+		switch key {
+		case "public_key":
+			currentKey = val
+		case "last_handshake_time_sec":
+			if currentKey == pubKeyHex {
+				hs, err := strconv.ParseInt(val, 10, 64)
+				if err != nil {
+					return 0, false
+				}
+				return hs, true
+			}
+		}
+	}
+	return 0, false
+}
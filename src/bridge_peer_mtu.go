@@ -0,0 +1,93 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+//
+// bridge_peer_mtu.go — FFI for ad-hoc per-peer PMTU discovery. PeerProbeMTU is
+// the generic, single-peer counterpart of bridge/multihop_mtu.go's background
+// per-hop prober: given any peerRegistry handle (not just a registered
+// multihop tunnel), it measures the real path MTU to that peer's current
+// endpoint via bridge.DiscoverPathMTU and clamps it into [minSize, maxSize].
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"strings"
+
+	"wireguard-go-bridge/bridge"
+)
+
+// wgOverheadForProbe mirrors bridge's own multihopWGOverhead: how much
+// smaller the overlay MTU must be than the measured transport path MTU to
+// leave room for WireGuard's framing.
+const wgOverheadForProbe = 1500 - 1420
+
+//export PeerProbeMTU
+func PeerProbeMTU(handle C.int64_t, minSize, maxSize C.int) C.int {
+	owner, ok := getPeerOwner(int64(handle))
+	if !ok {
+		return C.int(C.WG_ERR_NOT_FOUND)
+	}
+	dev, errC := getDevice(owner.deviceHandle)
+	if errC != C.WG_OK {
+		return C.int(errC)
+	}
+
+	ipc, err := dev.IpcGet()
+	if err != nil {
+		return C.int(C.WG_ERR_INTERNAL)
+	}
+	endpoint, ok := peerEndpoint(ipc, owner.pubKeyHex)
+	if !ok {
+		return C.int(C.WG_ERR_NOT_FOUND)
+	}
+
+	pathMTU, ok := bridge.DiscoverPathMTU(endpoint)
+	if !ok {
+		return C.int(C.WG_ERR_INTERNAL)
+	}
+
+	mtu := bridge.SnapMTUCandidate(pathMTU - wgOverheadForProbe)
+	if int(minSize) > 0 && mtu < int(minSize) {
+		mtu = int(minSize)
+	}
+	if int(maxSize) > 0 && mtu > int(maxSize) {
+		mtu = int(maxSize)
+	}
+	return C.int(mtu)
+}
+
+// peerEndpoint returns the endpoint= UAPI value for pubKeyHex out of an
+// IpcGet dump — the endpoint-side counterpart of peerLastHandshake
+// (bridge_peer_endpoints.go).
+func peerEndpoint(ipc, pubKeyHex string) (string, bool) {
+	var currentKey string
+	for _, line := range strings.Split(ipc, "\n") {
+		line = strings.TrimSpace(line)
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := parts[0], parts[1]
+		switch key {
+		case "public_key":
+			currentKey = val
+		case "endpoint":
+			if currentKey == pubKeyHex {
+				return val, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,184 @@
+// ██████╗ ██╗  ██╗ █████╗ ███╗   ██╗████████╗ ██████╗ ███╗   ███╗
+// ██╔══██╗██║  ██║██╔══██╗████╗  ██║╚══██╔══╝██╔═══██╗████╗ ████║
+// ██████╔╝███████║███████║██╔██╗ ██║   ██║   ██║   ██║██╔████╔██║
+// ██╔═══╝ ██╔══██║██╔══██║██║╚██╗██║   ██║   ██║   ██║██║╚██╔╝██║
+// ██║     ██║  ██║██║  ██║██║ ╚████║   ██║   ╚██████╔╝██║ ╚═╝ ██║
+// ╚═╝     ╚═╝  ╚═╝╚═╝  ╚═╝╚═╝  ╚═══╝   ╚═╝    ╚═════╝ ╚═╝     ╚═╝
+//
+// Copyright (c) 2025 Rıza Emre ARAS <r.emrearas@proton.me>
+// Licensed under AGPL-3.0 - see LICENSE file for details
+// Third-party licenses - see THIRD_PARTY_LICENSES file for details
+// WireGuard® is a registered trademark of Jason A. Donenfeld.
+//
+// bridge_persistent_device.go — FFI for persistent_device.go. PersistentDeviceCreate/
+// PersistentDeviceCreateNetstack/PersistentDeviceClose are the lifecycle exports a
+// caller needs to obtain a persistentDeviceRegistry handle in the first place; the
+// Device* exports then manage peers on it via minimal IpcSet fragments (see
+// persistentDevice.addPeer/removePeer/updatePeerEndpoint) so every mutation
+// automatically persists. PersistentDeviceListPeers/PersistentDeviceGetPeerStats
+// are the odd ones out: they open the state DB file directly, so a dashboard
+// process can read persisted peer counters without a running device or UAPI socket.
+
+package main
+
+/*
+#include "wireguard_go_bridge.h"
+*/
+import "C"
+import (
+	"database/sql"
+	"encoding/json"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//export PersistentDeviceCreate
+func PersistentDeviceCreate(ifname *C.char, mtu C.int, dbPath *C.char) C.int64_t {
+	pd, err := newPersistentDevice(C.GoString(ifname), int(mtu), C.GoString(dbPath))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_DEVICE_CREATE)
+	}
+	return C.int64_t(persistentDeviceRegistry.Add(pd))
+}
+
+//export PersistentDeviceCreateNetstack
+func PersistentDeviceCreateNetstack(ifname, localAddrsCSV *C.char, mtu C.int, dbPath *C.char) C.int64_t {
+	pd, err := newPersistentDeviceNetstack(C.GoString(ifname), C.GoString(localAddrsCSV), int(mtu), C.GoString(dbPath))
+	if err != nil {
+		return C.int64_t(C.WG_ERR_DEVICE_CREATE)
+	}
+	return C.int64_t(persistentDeviceRegistry.Add(pd))
+}
+
+//export PersistentDeviceClose
+func PersistentDeviceClose(handle C.int64_t) C.int32_t {
+	pd, errC := getPersistentDevice(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	pd.close()
+	persistentDeviceRegistry.Remove(int64(handle))
+	return errOK
+}
+
+//export DeviceAddPeer
+func DeviceAddPeer(handle C.int64_t, pubkeyHex, pskHex, endpoint *C.char, keepalive C.int, allowedIPsCSV *C.char) C.int32_t {
+	pd, errC := getPersistentDevice(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	if err := pd.addPeer(C.GoString(pubkeyHex), C.GoString(pskHex), C.GoString(endpoint),
+		int(keepalive), C.GoString(allowedIPsCSV)); err != nil {
+		return C.WG_ERR_INTERNAL
+	}
+	return errOK
+}
+
+//export DeviceRemovePeer
+func DeviceRemovePeer(handle C.int64_t, pubkeyHex *C.char) C.int32_t {
+	pd, errC := getPersistentDevice(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	if err := pd.removePeer(C.GoString(pubkeyHex)); err != nil {
+		return C.WG_ERR_INTERNAL
+	}
+	return errOK
+}
+
+//export DeviceUpdatePeerEndpoint
+func DeviceUpdatePeerEndpoint(handle C.int64_t, pubkeyHex, endpoint *C.char) C.int32_t {
+	pd, errC := getPersistentDevice(int64(handle))
+	if errC != C.WG_OK {
+		return errC
+	}
+	if err := pd.updatePeerEndpoint(C.GoString(pubkeyHex), C.GoString(endpoint)); err != nil {
+		return C.WG_ERR_INTERNAL
+	}
+	return errOK
+}
+
+//export DeviceListPeers
+func DeviceListPeers(handle C.int64_t) *C.char {
+	pd, errC := getPersistentDevice(int64(handle))
+	if errC != C.WG_OK {
+		return nil
+	}
+	peers, err := pd.listPeers()
+	if err != nil {
+		return nil
+	}
+	out, err := json.Marshal(peers)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(out))
+}
+
+//export DevicePeerStats
+func DevicePeerStats(handle C.int64_t, pubkeyHex *C.char) *C.char {
+	pd, errC := getPersistentDevice(int64(handle))
+	if errC != C.WG_OK {
+		return nil
+	}
+	peer, err := pd.peerStats(C.GoString(pubkeyHex))
+	if err != nil || peer == nil {
+		return nil
+	}
+	out, err := json.Marshal(peer)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(out))
+}
+
+// getPersistentDevice resolves a PersistentDeviceCreate/PersistentDeviceCreateNetstack
+// handle into its *persistentDevice.
+func getPersistentDevice(handle int64) (*persistentDevice, C.int32_t) {
+	if !Validate(handle, KindPersistentDevice) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	obj, ok := persistentDeviceRegistry.Get(handle)
+	if !ok {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
+	return obj.(*persistentDevice), C.WG_OK
+}
+
+//export PersistentDeviceListPeers
+func PersistentDeviceListPeers(dbPath *C.char, deviceID C.int64_t) *C.char {
+	db, err := sql.Open("sqlite3", C.GoString(dbPath)+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+
+	peers, err := ListPeers(db, int64(deviceID))
+	if err != nil {
+		return nil
+	}
+	out, err := json.Marshal(peers)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(out))
+}
+
+//export PersistentDeviceGetPeerStats
+func PersistentDeviceGetPeerStats(dbPath *C.char, deviceID C.int64_t, pubkeyHex *C.char) *C.char {
+	db, err := sql.Open("sqlite3", C.GoString(dbPath)+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+
+	peer, err := GetPeerStats(db, int64(deviceID), C.GoString(pubkeyHex))
+	if err != nil || peer == nil {
+		return nil
+	}
+	out, err := json.Marshal(peer)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(out))
+}
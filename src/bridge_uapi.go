@@ -29,6 +29,7 @@ import (
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/ipc"
 	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
 )
 
 const defaultSocketDir = "/var/run/wireguard"
@@ -100,6 +101,88 @@ func Run(ifname *C.char, logLevel C.int) C.int32_t {
 	return C.WG_OK
 }
 
+// RunNetstack is Run's userspace-TUN counterpart: instead of a kernel TUN it
+// binds a gVisor netstack to localAddrsCSV (comma-separated IPs, e.g.
+// "10.0.0.2,fd00::2" — see parseNetstackAddrs) and, if listenPort is
+// nonzero, fixes the device's listen port before opening the UAPI socket,
+// so the whole daemon — inner addresses included — can run without
+// /dev/net/tun, e.g. inside a sandbox or a test harness. Otherwise it
+// mirrors Run exactly: UAPIOpen → UAPIListen → accept loop → wait for
+// signal.
+//
+//export RunNetstack
+func RunNetstack(ifname *C.char, logLevel C.int, localAddrsCSV *C.char, listenPort C.int) C.int32_t {
+	interfaceName := C.GoString(ifname)
+
+	logger := device.NewLogger(int(logLevel), fmt.Sprintf("(%s) ", interfaceName))
+
+	addrs, err := parseNetstackAddrs(C.GoString(localAddrsCSV))
+	if err != nil || len(addrs) == 0 {
+		logger.Errorf("Failed to parse netstack addresses: %v", err)
+		return C.WG_ERR_TUN_CREATE
+	}
+
+	tunDev, _, err := netstack.CreateNetTUN(addrs, nil, device.DefaultMTU)
+	if err != nil {
+		logger.Errorf("Failed to create netstack TUN device: %v", err)
+		return C.WG_ERR_TUN_CREATE
+	}
+
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+	logger.Verbosef("Device started")
+
+	if listenPort != 0 {
+		if err := dev.IpcSet(fmt.Sprintf("listen_port=%d\n", int(listenPort))); err != nil {
+			logger.Errorf("Failed to set listen port: %v", err)
+			dev.Close()
+			return C.WG_ERR_INTERNAL
+		}
+	}
+
+	fileUAPI, err := ipc.UAPIOpen(interfaceName)
+	if err != nil {
+		logger.Errorf("UAPI listen error: %v", err)
+		dev.Close()
+		return C.WG_ERR_INTERNAL
+	}
+
+	uapi, err := ipc.UAPIListen(interfaceName, fileUAPI)
+	if err != nil {
+		logger.Errorf("Failed to listen on UAPI socket: %v", err)
+		dev.Close()
+		return C.WG_ERR_INTERNAL
+	}
+
+	errs := make(chan error)
+	go func() {
+		for {
+			c, acceptErr := uapi.Accept()
+			if acceptErr != nil {
+				errs <- acceptErr
+				return
+			}
+			go dev.IpcHandle(c)
+		}
+	}()
+
+	logger.Verbosef("UAPI listener started")
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case <-term:
+	case <-errs:
+	case <-dev.Wait():
+	}
+
+	_ = uapi.Close()
+	dev.Close()
+
+	logger.Verbosef("Shutting down")
+	return C.WG_OK
+}
+
 // --- Individual UAPI functions (for programmatic non-daemon usage) ---
 
 type uapiListener struct {
@@ -191,4 +274,98 @@ func DeviceUAPIClose(deviceHandle C.int64_t, ifname *C.char) C.int32_t {
 func DeviceUAPISocketPath(ifname *C.char) *C.char {
 	socketName := C.GoString(ifname)
 	return C.CString(filepath.Join(defaultSocketDir, socketName+".sock"))
-}
\ No newline at end of file
+}
+
+// --- UAPI server at a caller-supplied path (for embedding in a process that
+// doesn't want wireguard-go's /var/run/wireguard/<name>.sock convention,
+// e.g. a test harness or a Python process with its own run directory) ---
+
+var (
+	uapiServers   = make(map[int64]*uapiListener)
+	uapiServersMu sync.Mutex
+)
+
+// DeviceServeUAPI is DeviceUAPIListen with a literal socket path instead of
+// an interface name, so a caller that already manages its own run directory
+// (a CI harness, a sandboxed Python daemon) doesn't need wg's well-known
+// socket convention to point wg(8)/wg-quick at this device.
+//
+//export DeviceServeUAPI
+func DeviceServeUAPI(deviceHandle C.int64_t, socketPath *C.char) C.int32_t {
+	dev, err := getDevice(int64(deviceHandle))
+	if err != C.WG_OK {
+		return err
+	}
+
+	uapiServersMu.Lock()
+	if _, exists := uapiServers[int64(deviceHandle)]; exists {
+		uapiServersMu.Unlock()
+		return C.WG_ERR_INTERNAL
+	}
+	uapiServersMu.Unlock()
+
+	path := C.GoString(socketPath)
+	if e := os.MkdirAll(filepath.Dir(path), 0711); e != nil {
+		return C.WG_ERR_INTERNAL
+	}
+	_ = os.Remove(path)
+
+	listener, e := net.Listen("unix", path)
+	if e != nil {
+		return C.WG_ERR_INTERNAL
+	}
+	_ = os.Chmod(path, 0600)
+
+	srv := &uapiListener{
+		listener: listener,
+		stop:     make(chan struct{}),
+	}
+
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		for {
+			c, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				select {
+				case <-srv.stop:
+					return
+				default:
+					continue
+				}
+			}
+			go dev.IpcHandle(c)
+		}
+	}()
+
+	uapiServersMu.Lock()
+	uapiServers[int64(deviceHandle)] = srv
+	uapiServersMu.Unlock()
+
+	return C.WG_OK
+}
+
+// DeviceStopUAPI stops a listener started by DeviceServeUAPI and removes its
+// socket file, mirroring DeviceUAPIClose's shutdown sequence.
+//
+//export DeviceStopUAPI
+func DeviceStopUAPI(deviceHandle C.int64_t, socketPath *C.char) C.int32_t {
+	uapiServersMu.Lock()
+	srv, ok := uapiServers[int64(deviceHandle)]
+	if ok {
+		delete(uapiServers, int64(deviceHandle))
+	}
+	uapiServersMu.Unlock()
+
+	if !ok {
+		return C.WG_ERR_NOT_FOUND
+	}
+
+	close(srv.stop)
+	_ = srv.listener.Close()
+	srv.wg.Wait()
+
+	_ = os.Remove(C.GoString(socketPath))
+
+	return C.WG_OK
+}
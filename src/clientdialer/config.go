@@ -0,0 +1,24 @@
+// Package clientdialer is a headless, userspace WireGuard client: from a
+// private key and a list of upstream peers it brings up a device.Device
+// bound to an in-process gVisor netstack (no kernel TUN, no UAPI socket)
+// and hands back a Dialer embedders can DialTCP/DialUDP through, the
+// client-side counterpart of multihop.Manager's server-side chain of
+// kernel-TUN hops.
+package clientdialer
+
+// Peer is one upstream WireGuard peer a Dialer routes traffic through.
+type Peer struct {
+	PublicKey    string   `json:"public_key"`
+	Endpoint     string   `json:"endpoint"`
+	AllowedIPs   []string `json:"allowed_ips"`
+	PresharedKey string   `json:"preshared_key,omitempty"`
+}
+
+// Config is everything New needs to stand up a headless client device.
+type Config struct {
+	PrivateKey string   `json:"private_key"`
+	Peers      []Peer   `json:"peers"`
+	LocalAddrs []string `json:"local_addrs"`        // inner tunnel IPs, e.g. "10.0.0.2"
+	MTU        int      `json:"mtu,omitempty"`      // 0 defaults to device.DefaultMTU
+	Reserved   []byte   `json:"reserved,omitempty"` // overwrites the 3 reserved header bytes on every outgoing packet; some providers (e.g. Cloudflare Warp) key routing off these instead of the handshake
+}
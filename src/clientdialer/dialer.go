@@ -0,0 +1,136 @@
+package clientdialer
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// Dialer is a running headless client device plus the netstack.Net it's
+// bound to, ready for DialTCP/DialUDP.
+type Dialer struct {
+	device *device.Device
+	tun    tun.Device
+	tnet   *netstack.Net
+}
+
+// New brings up a headless client device from cfg and returns a Dialer.
+// Every peer in cfg.Peers is configured on the same device, so multiple
+// peers sharing overlapping allowed-ips behave exactly as they would on a
+// kernel-backed device: the wireguard-go trie resolves them last-write-wins,
+// in the order IpcSet applies them here.
+func New(cfg Config) (*Dialer, error) {
+	if cfg.PrivateKey == "" {
+		return nil, fmt.Errorf("private key required")
+	}
+
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = device.DefaultMTU
+	}
+
+	localAddrs, err := parseAddrs(cfg.LocalAddrs)
+	if err != nil {
+		return nil, fmt.Errorf("local addrs: %w", err)
+	}
+
+	tunDev, tnet, err := netstack.CreateNetTUN(localAddrs, nil, mtu)
+	if err != nil {
+		return nil, fmt.Errorf("netstack: %w", err)
+	}
+
+	var bind conn.Bind = conn.NewDefaultBind()
+	if len(cfg.Reserved) > 0 {
+		bind = newReservedBind(bind, cfg.Reserved)
+	}
+
+	logger := device.NewLogger(device.LogLevelError, "(client-dialer) ")
+	dev := device.NewDevice(tunDev, bind, logger)
+	if dev == nil {
+		_ = tunDev.Close()
+		return nil, fmt.Errorf("device create")
+	}
+
+	ipcConfig, err := buildIPC(cfg)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	if err := dev.IpcSet(ipcConfig); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("ipc set: %w", err)
+	}
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("up: %w", err)
+	}
+
+	return &Dialer{device: dev, tun: tunDev, tnet: tnet}, nil
+}
+
+// buildIPC renders cfg as a wireguard-go IpcSet config string.
+func buildIPC(cfg Config) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "private_key=%s\n", cfg.PrivateKey)
+	for _, p := range cfg.Peers {
+		if p.PublicKey == "" {
+			return "", fmt.Errorf("peer missing public key")
+		}
+		fmt.Fprintf(&b, "public_key=%s\n", p.PublicKey)
+		if p.PresharedKey != "" {
+			fmt.Fprintf(&b, "preshared_key=%s\n", p.PresharedKey)
+		}
+		if p.Endpoint != "" {
+			fmt.Fprintf(&b, "endpoint=%s\n", p.Endpoint)
+		}
+		for _, ip := range p.AllowedIPs {
+			fmt.Fprintf(&b, "allowed_ip=%s\n", ip)
+		}
+	}
+	return b.String(), nil
+}
+
+// parseAddrs parses cfg.LocalAddrs into the form netstack.CreateNetTUN wants.
+func parseAddrs(raw []string) ([]netip.Addr, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("at least one local address required")
+	}
+	addrs := make([]netip.Addr, 0, len(raw))
+	for _, s := range raw {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", s, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// DialTCP opens a TCP connection to addr (host:port) through the tunnel.
+func (d *Dialer) DialTCP(addr string) (net.Conn, error) {
+	raddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", addr, err)
+	}
+	return d.tnet.DialTCP(raddr)
+}
+
+// DialUDP opens a UDP "connection" to addr (host:port) through the tunnel.
+func (d *Dialer) DialUDP(addr string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", addr, err)
+	}
+	return d.tnet.DialUDP(nil, raddr)
+}
+
+// Close tears down the device and its netstack TUN.
+func (d *Dialer) Close() {
+	d.device.Close()
+}
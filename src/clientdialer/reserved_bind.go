@@ -0,0 +1,30 @@
+package clientdialer
+
+import "golang.zx2c4.com/wireguard/conn"
+
+// reservedBind wraps a conn.Bind to overwrite each outgoing WireGuard
+// message's 3 reserved header bytes (offset 1..3, defined as always-zero by
+// the spec and left untouched by wireguard-go itself) with a fixed value
+// before the packet leaves the Bind. Some providers identify clients by
+// these bytes instead of the handshake, so a Dialer configured with
+// Config.Reserved needs to stamp every packet — handshake and transport
+// alike — not just messages it constructs itself.
+type reservedBind struct {
+	conn.Bind
+	reserved [3]byte
+}
+
+func newReservedBind(inner conn.Bind, reserved []byte) *reservedBind {
+	var r [3]byte
+	copy(r[:], reserved)
+	return &reservedBind{Bind: inner, reserved: r}
+}
+
+func (b *reservedBind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	for _, buf := range bufs {
+		if len(buf) >= 4 {
+			buf[1], buf[2], buf[3] = b.reserved[0], b.reserved[1], b.reserved[2]
+		}
+	}
+	return b.Bind.Send(bufs, ep)
+}
@@ -36,6 +36,29 @@ func DerivePublicKey(privHex string) (string, error) {
 	return hex.EncodeToString(pubBytes), nil
 }
 
+// DeriveSharedSecret computes the Curve25519 (X25519) shared secret between
+// a local hex-encoded private key and a peer's hex-encoded public key —
+// the same DH operation DerivePublicKey does against the basepoint, just
+// against the peer's point instead. WireGuard keys are DH keys, not
+// signing keys, so this is what stands in for "sign with the peer's
+// public key" wherever that phrase shows up against this key material
+// (see multihop_pong.go's pong payload HMAC).
+func DeriveSharedSecret(privHex, peerPubHex string) (string, error) {
+	privBytes, err := hex.DecodeString(privHex)
+	if err != nil || len(privBytes) != 32 {
+		return "", fmt.Errorf("invalid private key hex")
+	}
+	peerPubBytes, err := hex.DecodeString(peerPubHex)
+	if err != nil || len(peerPubBytes) != 32 {
+		return "", fmt.Errorf("invalid peer public key hex")
+	}
+	secret, err := curve25519.X25519(privBytes, peerPubBytes)
+	if err != nil {
+		return "", fmt.Errorf("x25519: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
 // GeneratePresharedKey creates a random 32-byte preshared key.
 // Returns hex-encoded 64-char string.
 func GeneratePresharedKey() (string, error) {
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"crypto/mlkem"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// NewMLKEM768DecapsulationKey generates a fresh ML-KEM-768 key pair for the
+// local side of a PSK rotation. Its encapsulation key (base64) is what the
+// remote peer needs in order to encapsulate a shared secret this node can
+// decapsulate; the returned *mlkem.DecapsulationKey768 must be kept to
+// decapsulate the response.
+func NewMLKEM768DecapsulationKey() (*mlkem.DecapsulationKey768, string, error) {
+	dk, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, "", fmt.Errorf("generate ML-KEM-768 key: %w", err)
+	}
+	return dk, base64.StdEncoding.EncodeToString(dk.EncapsulationKey().Bytes()), nil
+}
+
+// EncapsulateMLKEM768PSK encapsulates against a peer's base64-encoded
+// ML-KEM-768 encapsulation key, returning a WireGuard-ready 32-byte
+// preshared key (hex) and the base64 ciphertext the peer needs to recover
+// the same shared secret via its own DecapsulationKey768.Decapsulate.
+func EncapsulateMLKEM768PSK(peerEncapKeyB64 string, epoch uint64) (pskHex string, ciphertextB64 string, err error) {
+	raw, err := base64.StdEncoding.DecodeString(peerEncapKeyB64)
+	if err != nil {
+		return "", "", fmt.Errorf("decode encapsulation key: %w", err)
+	}
+	ek, err := mlkem.NewEncapsulationKey768(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("parse encapsulation key: %w", err)
+	}
+
+	sharedKey, ciphertext := ek.Encapsulate()
+	psk := hkdfPSK(sharedKey, epoch)
+	return hex.EncodeToString(psk[:]), base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecapsulateMLKEM768PSK recovers the same WireGuard preshared key derived
+// by EncapsulateMLKEM768PSK, given this node's decapsulation key and the
+// base64 ciphertext the peer sent back.
+func DecapsulateMLKEM768PSK(dk *mlkem.DecapsulationKey768, ciphertextB64 string, epoch uint64) (pskHex string, err error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return "", fmt.Errorf("decode ciphertext: %w", err)
+	}
+	sharedKey, err := dk.Decapsulate(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decapsulate: %w", err)
+	}
+	psk := hkdfPSK(sharedKey, epoch)
+	return hex.EncodeToString(psk[:]), nil
+}
+
+// hkdfPSK derives a 32-byte WireGuard preshared key from a raw ML-KEM
+// shared secret via HKDF-Extract, salted with the rotation epoch so two
+// rotations of the same peer never collide even if Encapsulate somehow
+// repeated a shared secret.
+func hkdfPSK(sharedKey []byte, epoch uint64) (psk [32]byte) {
+	salt := make([]byte, 8)
+	for i := range salt {
+		salt[i] = byte(epoch >> (8 * (7 - i)))
+	}
+	prk := hkdf.Extract(sha256.New, sharedKey, salt)
+	copy(psk[:], prk)
+	return psk
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ACLDirection is which leg of a peer's traffic a PeerACL rule matches:
+// ACLIn for packets arriving from the peer, ACLOut for packets addressed
+// to it. See bridge.Filter for how Read/Write map onto these.
+type ACLDirection string
+
+const (
+	ACLIn  ACLDirection = "in"
+	ACLOut ACLDirection = "out"
+)
+
+// ACLProto restricts a rule to one transport, or ACLProtoAny for all three
+// bridge.Filter's header parser understands.
+type ACLProto string
+
+const (
+	ACLProtoAny  ACLProto = "any"
+	ACLProtoTCP  ACLProto = "tcp"
+	ACLProtoUDP  ACLProto = "udp"
+	ACLProtoICMP ACLProto = "icmp"
+)
+
+// ACLAction is what a matching rule does to the packet.
+type ACLAction string
+
+const (
+	ACLAllow ACLAction = "allow"
+	ACLDrop  ACLAction = "drop"
+)
+
+// PeerACL is one stateful-filter rule for a peer, evaluated in ascending
+// id order by bridge.Filter — the first rule that matches a packet wins.
+// SrcCIDR/DstCIDR empty means "any address"; PortLow/PortHigh both 0 means
+// "any port" (and both are ignored for ACLProtoICMP).
+type PeerACL struct {
+	ID        int64        `json:"id,omitempty"`
+	PeerID    int64        `json:"peer_id,omitempty"`
+	Direction ACLDirection `json:"direction"`
+	Proto     ACLProto     `json:"proto"`
+	SrcCIDR   string       `json:"src_cidr,omitempty"`
+	DstCIDR   string       `json:"dst_cidr,omitempty"`
+	PortLow   int          `json:"port_low,omitempty"`
+	PortHigh  int          `json:"port_high,omitempty"`
+	Action    ACLAction    `json:"action"`
+}
+
+// ReplacePeerACLs atomically replaces every rule belonging to peerID with
+// rules, in one transaction that deletes the peer's existing rows and
+// then inserts rules. An empty rules deletes all of a peer's rules,
+// restoring the default allow-all policy.
+func (b *BridgeDB) ReplacePeerACLs(peerID int64, rules []PeerACL) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(b.rebind("DELETE FROM peer_acl_rules WHERE peer_id = ?"), peerID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(b.rebind(`
+		INSERT INTO peer_acl_rules (peer_id, direction, proto, src_cidr, dst_cidr, port_low, port_high, action)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, rule := range rules {
+		if rule.Direction != ACLIn && rule.Direction != ACLOut {
+			return fmt.Errorf("invalid acl direction %q", rule.Direction)
+		}
+		if rule.Action != ACLAllow && rule.Action != ACLDrop {
+			return fmt.Errorf("invalid acl action %q", rule.Action)
+		}
+		if _, err := stmt.Exec(peerID, string(rule.Direction), string(rule.Proto),
+			nullStr(rule.SrcCIDR), nullStr(rule.DstCIDR), rule.PortLow, rule.PortHigh, string(rule.Action)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListPeerACLs returns peerID's rules in evaluation order.
+func (b *BridgeDB) ListPeerACLs(peerID int64) ([]PeerACL, error) {
+	rows, err := b.db.Query(b.rebind(`
+		SELECT id, peer_id, direction, proto, src_cidr, dst_cidr, port_low, port_high, action
+		FROM peer_acl_rules WHERE peer_id = ? ORDER BY id`), peerID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	return scanPeerACLs(rows)
+}
+
+// ListAllPeerACLs loads every rule for every peer, keyed by the owning
+// peer's public key, for bridge.Filter to build its in-memory rule cache
+// at startup and for State.ListPeerACLs to report over the whole fleet.
+func (b *BridgeDB) ListAllPeerACLs() (map[string][]PeerACL, error) {
+	rows, err := b.db.Query(`
+		SELECT r.id, r.peer_id, r.direction, r.proto, r.src_cidr, r.dst_cidr, r.port_low, r.port_high, r.action, p.public_key
+		FROM peer_acl_rules r JOIN peers p ON p.id = r.peer_id
+		ORDER BY r.peer_id, r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make(map[string][]PeerACL)
+	for rows.Next() {
+		var r PeerACL
+		var direction, proto, action, pubKey string
+		var srcCIDR, dstCIDR sql.NullString
+		if err := rows.Scan(&r.ID, &r.PeerID, &direction, &proto, &srcCIDR, &dstCIDR, &r.PortLow, &r.PortHigh, &action, &pubKey); err != nil {
+			return nil, err
+		}
+		r.Direction, r.Proto, r.Action = ACLDirection(direction), ACLProto(proto), ACLAction(action)
+		if srcCIDR.Valid {
+			r.SrcCIDR = srcCIDR.String
+		}
+		if dstCIDR.Valid {
+			r.DstCIDR = dstCIDR.String
+		}
+		out[pubKey] = append(out[pubKey], r)
+	}
+	return out, nil
+}
+
+// scanPeerACLs drains rows of the standard peer_acl_rules column list into
+// PeerACL values.
+func scanPeerACLs(rows *sql.Rows) ([]PeerACL, error) {
+	var rules []PeerACL
+	for rows.Next() {
+		var r PeerACL
+		var direction, proto, action string
+		var srcCIDR, dstCIDR sql.NullString
+		if err := rows.Scan(&r.ID, &r.PeerID, &direction, &proto, &srcCIDR, &dstCIDR, &r.PortLow, &r.PortHigh, &action); err != nil {
+			return nil, err
+		}
+		r.Direction, r.Proto, r.Action = ACLDirection(direction), ACLProto(proto), ACLAction(action)
+		if srcCIDR.Valid {
+			r.SrcCIDR = srcCIDR.String
+		}
+		if dstCIDR.Valid {
+			r.DstCIDR = dstCIDR.String
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// UpdateACLCounters adds acceptedDelta/droppedDelta to pubKey's cumulative
+// filter counters. Called periodically by bridge.Filter's counter
+// flusher rather than per-packet, the same batching tradeoff
+// StatsSyncer makes for rx_bytes/tx_bytes. Returns a PeerEvent when
+// droppedDelta > 0 so the caller can publish it on the existing stats
+// path, or nil if nothing was dropped this interval.
+func (b *BridgeDB) UpdateACLCounters(pubKey string, acceptedDelta, droppedDelta int64) (*PeerEvent, error) {
+	if acceptedDelta == 0 && droppedDelta == 0 {
+		return nil, nil
+	}
+
+	result, err := b.db.Exec(b.rebind(`
+		UPDATE peers SET acl_packets_accepted = acl_packets_accepted + ?, acl_packets_dropped = acl_packets_dropped + ?
+		WHERE public_key = ?`), acceptedDelta, droppedDelta, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 || droppedDelta <= 0 {
+		return nil, nil
+	}
+
+	var dropped int64
+	if err := b.db.QueryRow(b.rebind(
+		"SELECT acl_packets_dropped FROM peers WHERE public_key = ?"), pubKey,
+	).Scan(&dropped); err != nil {
+		return nil, err
+	}
+	return &PeerEvent{
+		PublicKey: pubKey,
+		Kind:      EventACLDrop,
+		Old:       fmt.Sprintf("%d", dropped-droppedDelta),
+		New:       fmt.Sprintf("%d", dropped),
+	}, nil
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// SaveActiveChain persists chainJSON (a marshaled multihop.Chain) as the
+// singleton active chain row, replacing whatever was there before — there's
+// only ever one chain "up" at a time, the same id=1 singleton-row pattern
+// persistent_device.go's devices table uses for device state, so a
+// restart can bring the same chain back via GetActiveChain.
+func (b *BridgeDB) SaveActiveChain(chainJSON string, createdAt int64) error {
+	return b.backend.UpsertActiveChain(b.db, chainJSON, createdAt)
+}
+
+// GetActiveChain returns the persisted active chain's JSON, or ("", nil) if
+// none is stored.
+func (b *BridgeDB) GetActiveChain() (string, error) {
+	var chainJSON string
+	err := b.db.QueryRow("SELECT chain_json FROM active_chain WHERE id = 1").Scan(&chainJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return chainJSON, nil
+}
+
+// ClearActiveChain removes the persisted active chain, e.g. after
+// ChainDown, so a restart doesn't try to bring back a chain that was
+// deliberately torn down.
+func (b *BridgeDB) ClearActiveChain() error {
+	_, err := b.db.Exec("DELETE FROM active_chain WHERE id = 1")
+	return err
+}
@@ -0,0 +1,526 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net"
+	"sync"
+)
+
+// AllowedIPRecord is one extra routed CIDR for a peer, beyond its
+// pool-allocated AllowedIP/AllowedIPv6 on ClientRecord. Stored one row per
+// prefix in peer_allowed_ips so a peer can route N prefixes (e.g. a site's
+// LAN behind a site-to-site peer) instead of just its own tunnel address.
+type AllowedIPRecord struct {
+	ID        int64  `json:"id"`
+	PeerID    int64  `json:"peer_id"`
+	CIDR      string `json:"cidr"`
+	Family    int    `json:"family"`
+	PrefixLen int    `json:"prefix_len"`
+}
+
+// --- in-memory longest-prefix-match trie ---
+//
+// This mirrors the binary radix trie wireguard-go's device package keeps
+// for its own AllowedIPs (device/allowedips.go): one node per stored
+// prefix, path-compressed, with the owning peer kept at the node rather
+// than a separate lookup table. The only difference is what a node points
+// to — a bridge-db peer id instead of a *device.Peer, since this trie
+// lives in the db package and has no dependency on the device package.
+
+type parentIndirection struct {
+	parentBit     **trieNode
+	parentBitType uint8
+}
+
+type trieNode struct {
+	peerID     int64
+	hasPeer    bool
+	child      [2]*trieNode
+	parent     parentIndirection
+	cidr       uint8
+	bitAtByte  uint8
+	bitAtShift uint8
+	bits       []byte
+}
+
+func commonBits(a, b []byte) uint8 {
+	size := len(a)
+	if size == net.IPv4len {
+		x := binary.BigEndian.Uint32(a) ^ binary.BigEndian.Uint32(b)
+		return uint8(bits.LeadingZeros32(x))
+	}
+	hi := binary.BigEndian.Uint64(a[:8]) ^ binary.BigEndian.Uint64(b[:8])
+	if hi != 0 {
+		return uint8(bits.LeadingZeros64(hi))
+	}
+	lo := binary.BigEndian.Uint64(a[8:]) ^ binary.BigEndian.Uint64(b[8:])
+	return 64 + uint8(bits.LeadingZeros64(lo))
+}
+
+func (node *trieNode) choose(ip []byte) byte {
+	return (ip[node.bitAtByte] >> node.bitAtShift) & 1
+}
+
+func (node *trieNode) maskSelf() {
+	mask := net.CIDRMask(int(node.cidr), len(node.bits)*8)
+	for i := range mask {
+		node.bits[i] &= mask[i]
+	}
+}
+
+func (node *trieNode) nodePlacement(ip []byte, cidr uint8) (parent *trieNode, exact bool) {
+	for node != nil && node.cidr <= cidr && commonBits(node.bits, ip) >= node.cidr {
+		parent = node
+		if parent.cidr == cidr {
+			exact = true
+			return
+		}
+		node = node.child[node.choose(ip)]
+	}
+	return
+}
+
+func newTrieNode(ip []byte, cidr uint8, peerID int64) *trieNode {
+	n := &trieNode{
+		peerID:     peerID,
+		hasPeer:    true,
+		bits:       ip,
+		cidr:       cidr,
+		bitAtByte:  cidr / 8,
+		bitAtShift: 7 - (cidr % 8),
+	}
+	n.maskSelf()
+	return n
+}
+
+func (root parentIndirection) insert(ip []byte, cidr uint8, peerID int64) {
+	if *root.parentBit == nil {
+		node := newTrieNode(ip, cidr, peerID)
+		node.parent = root
+		*root.parentBit = node
+		return
+	}
+
+	node, exact := (*root.parentBit).nodePlacement(ip, cidr)
+	if exact {
+		node.peerID = peerID
+		node.hasPeer = true
+		return
+	}
+
+	newNode := newTrieNode(ip, cidr, peerID)
+
+	var down *trieNode
+	if node == nil {
+		down = *root.parentBit
+	} else {
+		bit := node.choose(ip)
+		down = node.child[bit]
+		if down == nil {
+			newNode.parent = parentIndirection{&node.child[bit], bit}
+			node.child[bit] = newNode
+			return
+		}
+	}
+
+	common := commonBits(down.bits, ip)
+	if common < cidr {
+		cidr = common
+	}
+	parent := node
+
+	if newNode.cidr == cidr {
+		bit := newNode.choose(down.bits)
+		down.parent = parentIndirection{&newNode.child[bit], bit}
+		newNode.child[bit] = down
+		if parent == nil {
+			newNode.parent = root
+			*root.parentBit = newNode
+		} else {
+			bit := parent.choose(newNode.bits)
+			newNode.parent = parentIndirection{&parent.child[bit], bit}
+			parent.child[bit] = newNode
+		}
+		return
+	}
+
+	split := &trieNode{
+		bits:       append([]byte{}, newNode.bits...),
+		cidr:       cidr,
+		bitAtByte:  cidr / 8,
+		bitAtShift: 7 - (cidr % 8),
+	}
+	split.maskSelf()
+
+	bit := split.choose(down.bits)
+	down.parent = parentIndirection{&split.child[bit], bit}
+	split.child[bit] = down
+	bit = split.choose(newNode.bits)
+	newNode.parent = parentIndirection{&split.child[bit], bit}
+	split.child[bit] = newNode
+
+	if parent == nil {
+		split.parent = root
+		*root.parentBit = split
+	} else {
+		bit := parent.choose(split.bits)
+		split.parent = parentIndirection{&parent.child[bit], bit}
+		parent.child[bit] = split
+	}
+}
+
+func (node *trieNode) lookup(ip []byte) (int64, bool) {
+	var foundID int64
+	var found bool
+	size := uint8(len(ip))
+	for node != nil && commonBits(node.bits, ip) >= node.cidr {
+		if node.hasPeer {
+			foundID, found = node.peerID, true
+		}
+		if node.bitAtByte == size {
+			break
+		}
+		node = node.child[node.choose(ip)]
+	}
+	return foundID, found
+}
+
+// remove detaches node from the trie. Unlike allowedips.go's node.remove,
+// this doesn't also collapse a now-single-child grandparent back out —
+// that node just becomes a bookkeeping-only split point, skipped by
+// lookup's hasPeer check, so leaving it in place costs a stale node rather
+// than correctness.
+func (node *trieNode) remove() {
+	node.hasPeer = false
+	if node.child[0] != nil && node.child[1] != nil {
+		return
+	}
+	bit := byte(0)
+	if node.child[0] == nil {
+		bit = 1
+	}
+	child := node.child[bit]
+	if child != nil {
+		child.parent = node.parent
+	}
+	*node.parent.parentBit = child
+}
+
+// allowedIPTrie is the loaded-at-startup, mutated-on-write view of every
+// enabled peer's routable prefixes (primary AllowedIP/AllowedIPv6 plus any
+// extra peer_allowed_ips rows), used for conflict detection and
+// LookupPeerByIP. It intentionally duplicates what's in SQL rather than
+// querying it per-packet — the same reasoning wireguard-go's own AllowedIPs
+// trie is built on.
+type allowedIPTrie struct {
+	mu   sync.RWMutex
+	v4   *trieNode
+	v6   *trieNode
+	byID map[int64]map[string]struct{} // peerID -> set of CIDR strings it owns, for removeByPeer
+}
+
+func newAllowedIPTrie() *allowedIPTrie {
+	return &allowedIPTrie{byID: make(map[int64]map[string]struct{})}
+}
+
+func parseCIDR(cidr string) (ip []byte, prefixLen int, family int, err error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("parse cidr %q: %w", cidr, err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if v4 := ipNet.IP.To4(); v4 != nil && bits == 32 {
+		return v4, ones, 4, nil
+	}
+	return ipNet.IP.To16(), ones, 6, nil
+}
+
+func (t *allowedIPTrie) insert(cidr string, peerID int64) error {
+	ip, prefixLen, family, err := parseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if family == 4 {
+		parentIndirection{&t.v4, 2}.insert(ip, uint8(prefixLen), peerID)
+	} else {
+		parentIndirection{&t.v6, 2}.insert(ip, uint8(prefixLen), peerID)
+	}
+	if t.byID[peerID] == nil {
+		t.byID[peerID] = make(map[string]struct{})
+	}
+	t.byID[peerID][cidr] = struct{}{}
+	return nil
+}
+
+// conflict reports the peer id already owning a prefix that overlaps cidr
+// in either direction (broader, narrower, or equal), if that owner isn't
+// peerID itself. A new peer not yet assigned an id passes 0, which never
+// matches a real row. The trie's nodePlacement walk only finds a covering
+// ancestor or an exact match in one pass — it can't also tell us whether
+// cidr is broader than something already stored beneath it — so this
+// checks against every other peer's recorded prefixes directly. Peer
+// counts here are small enough (tens to low thousands) that a linear
+// overlap scan on this admin-path operation is simpler than teaching the
+// trie to do reverse subtree walks.
+func (t *allowedIPTrie) conflict(cidr string, peerID int64) (int64, bool, error) {
+	_, target, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse cidr %q: %w", cidr, err)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for ownerID, cidrs := range t.byID {
+		if ownerID == peerID {
+			continue
+		}
+		for existing := range cidrs {
+			_, existingNet, err := net.ParseCIDR(existing)
+			if err != nil {
+				continue
+			}
+			if cidrsOverlap(target, existingNet) {
+				return ownerID, true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// cidrsOverlap reports whether a and b share any address, i.e. one
+// contains the other's base address.
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func (t *allowedIPTrie) lookup(ip net.IP) (int64, bool) {
+	var b []byte
+	if v4 := ip.To4(); v4 != nil {
+		b = v4
+	} else {
+		b = ip.To16()
+	}
+	if b == nil {
+		return 0, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(b) == net.IPv4len {
+		return t.v4.lookup(b)
+	}
+	return t.v6.lookup(b)
+}
+
+// removeExact detaches cidr's node, iff it's both an exact match and still
+// owned by peerID — callers hold t.mu.
+func (t *allowedIPTrie) removeExact(cidr string, peerID int64) {
+	ip, prefixLen, family, err := parseCIDR(cidr)
+	if err != nil {
+		return
+	}
+	root := t.v4
+	if family == 6 {
+		root = t.v6
+	}
+	if node, exact := root.nodePlacement(ip, uint8(prefixLen)); exact && node != nil && node.peerID == peerID {
+		node.remove()
+	}
+}
+
+// removeOne drops a single cidr from peerID's entries, e.g. when one
+// pool-allocated address is released but the peer's other prefixes stay.
+func (t *allowedIPTrie) removeOne(cidr string, peerID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeExact(cidr, peerID)
+	if set, ok := t.byID[peerID]; ok {
+		delete(set, cidr)
+	}
+}
+
+func (t *allowedIPTrie) removeByPeer(peerID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for cidr := range t.byID[peerID] {
+		t.removeExact(cidr, peerID)
+	}
+	delete(t.byID, peerID)
+}
+
+// --- BridgeDB wiring ---
+
+// CheckAllowedIPConflict reports whether cidr is already routed to a peer
+// other than peerID (pass 0 for a peer not yet inserted). The bridge calls
+// this before committing a new prefix so overlapping routes are rejected
+// rather than silently shadowing an existing peer.
+func (b *BridgeDB) CheckAllowedIPConflict(peerID int64, cidr string) (conflictPeerID int64, conflict bool, err error) {
+	return b.allowedIPs.conflict(cidr, peerID)
+}
+
+// LookupPeerByIP returns the enabled client that owns the longest matching
+// prefix for ip, for the bridge to use during packet routing decisions.
+func (b *BridgeDB) LookupPeerByIP(ip net.IP) (*ClientRecord, error) {
+	peerID, ok := b.allowedIPs.lookup(ip)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	row := b.db.QueryRow(b.rebind("SELECT "+peerColumns+" FROM peers WHERE id = ?"), peerID)
+	return b.scanClient(row)
+}
+
+// AddAllowedIP adds an extra routed prefix for peerID, on top of its
+// pool-allocated AllowedIP/AllowedIPv6. Rejects the insert if cidr overlaps
+// a prefix already owned by a different peer. allowedIPWriteMu holds the
+// conflict check, the SQL write, and the trie update together as one
+// atomic sequence — the SQL transaction alone only protects the write; the
+// conflict check reads the in-memory trie, which isn't updated until after
+// commit, so two concurrent calls for overlapping CIDRs could otherwise
+// both pass the check before either committed.
+func (b *BridgeDB) AddAllowedIP(peerID int64, cidr string) error {
+	_, prefixLen, family, err := parseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+
+	b.allowedIPWriteMu.Lock()
+	defer b.allowedIPWriteMu.Unlock()
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if conflictID, has, cerr := b.CheckAllowedIPConflict(peerID, cidr); cerr != nil {
+		return cerr
+	} else if has {
+		return fmt.Errorf("allowed ip %s conflicts with existing peer %d", cidr, conflictID)
+	}
+
+	if _, err := tx.Exec(b.rebind(
+		"INSERT INTO peer_allowed_ips (peer_id, cidr, family, prefix_len) VALUES (?, ?, ?, ?)"),
+		peerID, cidr, family, prefixLen,
+	); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return b.allowedIPs.insert(cidr, peerID)
+}
+
+// RemoveAllowedIP removes one extra routed prefix from peerID.
+func (b *BridgeDB) RemoveAllowedIP(peerID int64, cidr string) error {
+	result, err := b.db.Exec(b.rebind("DELETE FROM peer_allowed_ips WHERE peer_id = ? AND cidr = ?"), peerID, cidr)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Rebuild peerID's trie entries from what's left in the db rather than
+	// trying to splice a single node out from under an in-progress lookup;
+	// ListAllowedIPs plus the primary AllowedIP/AllowedIPv6 is cheap and
+	// this path isn't hot.
+	b.allowedIPs.removeByPeer(peerID)
+	return b.reinsertPeerAllowedIPs(peerID)
+}
+
+// ListAllowedIPs returns the extra routed prefixes for a peer.
+func (b *BridgeDB) ListAllowedIPs(peerID int64) ([]AllowedIPRecord, error) {
+	rows, err := b.db.Query(b.rebind(
+		"SELECT id, peer_id, cidr, family, prefix_len FROM peer_allowed_ips WHERE peer_id = ? ORDER BY id"), peerID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var recs []AllowedIPRecord
+	for rows.Next() {
+		var r AllowedIPRecord
+		if err := rows.Scan(&r.ID, &r.PeerID, &r.CIDR, &r.Family, &r.PrefixLen); err != nil {
+			return nil, err
+		}
+		recs = append(recs, r)
+	}
+	return recs, nil
+}
+
+// reinsertPeerAllowedIPs re-adds peerID's primary AllowedIP/AllowedIPv6 and
+// any remaining peer_allowed_ips rows to the trie, e.g. after
+// removeByPeer cleared all of them for a rebuild.
+func (b *BridgeDB) reinsertPeerAllowedIPs(peerID int64) error {
+	var allowedIP, allowedIPv6 string
+	row := b.db.QueryRow(b.rebind("SELECT allowed_ip, allowed_ip_v6 FROM peers WHERE id = ?"), peerID)
+	var ipv6 sql.NullString
+	if err := row.Scan(&allowedIP, &ipv6); err != nil {
+		if err == sql.ErrNoRows {
+			return nil // peer itself was deleted; nothing to reinsert
+		}
+		return err
+	}
+	if ipv6.Valid {
+		allowedIPv6 = ipv6.String
+	}
+
+	for _, cidr := range []string{allowedIP, allowedIPv6} {
+		if cidr == "" || cidr == "pending" {
+			continue
+		}
+		if err := b.allowedIPs.insert(cidr, peerID); err != nil {
+			return err
+		}
+	}
+
+	extra, err := b.ListAllowedIPs(peerID)
+	if err != nil {
+		return err
+	}
+	for _, r := range extra {
+		if err := b.allowedIPs.insert(r.CIDR, peerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAllowedIPTrie populates the in-memory trie from EnabledClients and
+// their peer_allowed_ips rows. Called once from Open, after migration.
+func (b *BridgeDB) loadAllowedIPTrie() error {
+	clients, err := b.EnabledClients()
+	if err != nil {
+		return err
+	}
+	for _, c := range clients {
+		if c.AllowedIP != "" && c.AllowedIP != "pending" {
+			if err := b.allowedIPs.insert(c.AllowedIP, c.ID); err != nil {
+				return fmt.Errorf("load allowed_ip for peer %d: %w", c.ID, err)
+			}
+		}
+		if c.AllowedIPv6 != "" {
+			if err := b.allowedIPs.insert(c.AllowedIPv6, c.ID); err != nil {
+				return fmt.Errorf("load allowed_ip_v6 for peer %d: %w", c.ID, err)
+			}
+		}
+		extra, err := b.ListAllowedIPs(c.ID)
+		if err != nil {
+			return fmt.Errorf("load peer_allowed_ips for peer %d: %w", c.ID, err)
+		}
+		for _, r := range extra {
+			if err := b.allowedIPs.insert(r.CIDR, c.ID); err != nil {
+				return fmt.Errorf("load peer_allowed_ips row for peer %d: %w", c.ID, err)
+			}
+		}
+	}
+	return nil
+}
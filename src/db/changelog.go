@@ -0,0 +1,264 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Change ops recorded in change_log and accepted by ApplyRemoteChange.
+const (
+	OpInsertClient = "insert_client"
+	OpDeleteClient = "delete_client"
+	OpSetEnabled   = "set_enabled"
+	OpSetPeerIndex = "set_peer_index"
+)
+
+// ChangeLogEntry is one row of the append-only replication log the mesh
+// package's Server/Client use to converge peer state across bridge
+// instances. NodeID/Seq identify where the change originated — not where
+// it's currently stored — so a node relaying an entry it learned about
+// from someone else still reports the original source, and the
+// (node_id, seq) UNIQUE constraint makes reapplying the same entry a
+// no-op instead of a rebroadcast loop.
+type ChangeLogEntry struct {
+	ID          int64  `json:"id"`
+	NodeID      string `json:"node_id"`
+	Seq         int64  `json:"seq"`
+	Op          string `json:"op"`
+	PubKey      string `json:"pubkey"`
+	PayloadJSON string `json:"payload_json"`
+	Ts          int64  `json:"ts"`
+}
+
+// insertClientPayload is change_log's JSON payload for OpInsertClient —
+// enough of a ClientRecord to recreate the peer on another node. The
+// payload still carries PrivateKey/PresharedKey in plaintext JSON fields
+// (mesh.Client needs the real values to install the peer on the other
+// node, and two nodes have no guarantee of sharing a KEK to decrypt a
+// field-level seal), but if this node has a KEK configured (see SetKEK)
+// the row appendChangeLog actually writes to change_log.payload_json is
+// sealed as a whole — see changeLogAAD — so the plaintext only ever
+// exists in transit (over what's now a required https:// mesh URL, see
+// mesh.NewClient) and in memory, never at rest in this node's own DB.
+type insertClientPayload struct {
+	PublicKey    string `json:"public_key"`
+	PresharedKey string `json:"preshared_key,omitempty"`
+	PrivateKey   string `json:"private_key"`
+	AllowedIP    string `json:"allowed_ip"`
+	AllowedIPv6  string `json:"allowed_ip_v6,omitempty"`
+	Keepalive    int    `json:"keepalive"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+type setEnabledPayload struct {
+	Enabled bool `json:"enabled"`
+}
+
+type setPeerIndexPayload struct {
+	Index *int64 `json:"peer_index,omitempty"`
+}
+
+// changeLogAAD binds a sealed change_log payload to the specific row it
+// was sealed for, the same way the peers table uses each row's own public
+// key — (node_id, seq) is the row's stable identity (see ChangeLogEntry's
+// doc comment on why it's the original source, not wherever it's
+// currently stored), known before the row is written and preserved across
+// however many mesh hops the entry is relayed through.
+func changeLogAAD(nodeID string, seq int64) string {
+	return fmt.Sprintf("changelog:%s:%d", nodeID, seq)
+}
+
+// execer is the subset of *sql.DB and *sql.Tx that appendChangeLog needs,
+// so callers already inside a transaction (DeleteClient, SetEnabled,
+// SetPeerIndex) can log in the same one.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// SetNodeID sets this instance's identifier for change_log rows it
+// originates. Call once at startup before any mutating operation; left
+// unset (""), every local change logs under the same empty node_id, which
+// is harmless for a standalone (non-meshed) deployment.
+func (b *BridgeDB) SetNodeID(id string) {
+	b.nodeMu.Lock()
+	b.nodeID = id
+	b.nodeMu.Unlock()
+}
+
+// NodeID returns the identifier set by SetNodeID.
+func (b *BridgeDB) NodeID() string {
+	b.nodeMu.Lock()
+	defer b.nodeMu.Unlock()
+	return b.nodeID
+}
+
+// appendChangeLog allocates the next seq for this node and writes one
+// change_log row for a locally-originated mutation. exec is either b.db
+// or a tx the caller is already inside, so the log row lands atomically
+// with the mutation it describes wherever the caller already has one.
+func (b *BridgeDB) appendChangeLog(exec execer, op, pubkey string, payload any) error {
+	b.changeLogMu.Lock()
+	defer b.changeLogMu.Unlock()
+
+	nodeID := b.NodeID()
+	var seq int64
+	if err := exec.QueryRow(b.rebind("SELECT COALESCE(MAX(seq), 0) FROM change_log WHERE node_id = ?"), nodeID).Scan(&seq); err != nil {
+		return err
+	}
+	seq++
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	stored, err := b.sealField(string(payloadJSON), changeLogAAD(nodeID, seq))
+	if err != nil {
+		return fmt.Errorf("seal change_log payload: %w", err)
+	}
+
+	_, err = exec.Exec(b.rebind(`
+		INSERT INTO change_log (node_id, seq, op, pubkey, payload_json, ts)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		nodeID, seq, op, pubkey, stored, time.Now().Unix())
+	return err
+}
+
+// ChangesSince returns every change_log row with id > sinceID, oldest
+// first — mesh.Server's backing query for GET /mesh/changes?since=N. Each
+// entry's PayloadJSON is opened back to plaintext (a no-op for rows
+// written before a KEK was configured, see openField) since what's
+// transmitted to a mesh peer needs to be the real JSON regardless of how
+// it's stored at rest here — mesh.NewClient's https:// requirement is what
+// protects it in transit now, not field-level sealing.
+func (b *BridgeDB) ChangesSince(sinceID int64) ([]ChangeLogEntry, error) {
+	rows, err := b.db.Query(b.rebind(`
+		SELECT id, node_id, seq, op, pubkey, payload_json, ts FROM change_log
+		WHERE id > ? ORDER BY id`), sinceID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []ChangeLogEntry
+	for rows.Next() {
+		var e ChangeLogEntry
+		if err := rows.Scan(&e.ID, &e.NodeID, &e.Seq, &e.Op, &e.PubKey, &e.PayloadJSON, &e.Ts); err != nil {
+			return nil, err
+		}
+		opened, err := b.openField(e.PayloadJSON, changeLogAAD(e.NodeID, e.Seq))
+		if err != nil {
+			return nil, fmt.Errorf("open change_log payload for %s/%d: %w", e.NodeID, e.Seq, err)
+		}
+		e.PayloadJSON = opened
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// insertChangeLogIgnoreDup records e under its original node_id/seq,
+// silently doing nothing if that pair is already present. e.PayloadJSON
+// arrives as plaintext (whether it's a pull/push entry from another node,
+// which already opened it the same way ChangesSince does, or a locally
+// logged-then-relayed one), so it's sealed with this node's own KEK (if
+// configured) before being written here, same as a locally-originated
+// entry — this node's own at-rest protection shouldn't depend on whether
+// the mutation originated here or was relayed in. The two backends spell
+// "insert, ignore on conflict" differently, so this branches on
+// BackendName rather than going through the Backend interface for what is
+// otherwise a one-off helper.
+func (b *BridgeDB) insertChangeLogIgnoreDup(e ChangeLogEntry) (bool, error) {
+	stored, err := b.sealField(e.PayloadJSON, changeLogAAD(e.NodeID, e.Seq))
+	if err != nil {
+		return false, fmt.Errorf("seal change_log payload: %w", err)
+	}
+
+	var query string
+	if b.BackendName() == "postgres" {
+		query = `INSERT INTO change_log (node_id, seq, op, pubkey, payload_json, ts)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (node_id, seq) DO NOTHING`
+	} else {
+		query = `INSERT OR IGNORE INTO change_log (node_id, seq, op, pubkey, payload_json, ts)
+			VALUES (?, ?, ?, ?, ?, ?)`
+	}
+	result, err := b.db.Exec(b.rebind(query), e.NodeID, e.Seq, e.Op, e.PubKey, stored, e.Ts)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ApplyRemoteChange applies a ChangeLogEntry pulled or pushed from another
+// mesh node. It's a no-op if (e.NodeID, e.Seq) has already been applied —
+// that's the loop-prevention mechanism: a node that relays an entry it
+// learned about elsewhere doesn't re-stamp it with its own node_id/seq, so
+// the original (node_id, seq) keeps dedup working no matter how many hops
+// the entry has been through.
+func (b *BridgeDB) ApplyRemoteChange(e ChangeLogEntry) error {
+	var seen int
+	if err := b.db.QueryRow(b.rebind(
+		"SELECT COUNT(*) FROM change_log WHERE node_id = ? AND seq = ?"), e.NodeID, e.Seq,
+	).Scan(&seen); err != nil {
+		return err
+	}
+	if seen > 0 {
+		return nil
+	}
+
+	switch e.Op {
+	case OpInsertClient:
+		var p insertClientPayload
+		if err := json.Unmarshal([]byte(e.PayloadJSON), &p); err != nil {
+			return fmt.Errorf("decode %s payload: %w", e.Op, err)
+		}
+		rec := &ClientRecord{
+			PublicKey: p.PublicKey, PresharedKey: p.PresharedKey, PrivateKey: p.PrivateKey,
+			AllowedIP: p.AllowedIP, AllowedIPv6: p.AllowedIPv6, Keepalive: p.Keepalive, CreatedAt: p.CreatedAt,
+		}
+		if err := b.insertClientRow(rec); err != nil && !isUniqueViolation(err) {
+			return err
+		}
+	case OpDeleteClient:
+		if err := b.deleteClientRow(e.PubKey); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	case OpSetEnabled:
+		var p setEnabledPayload
+		if err := json.Unmarshal([]byte(e.PayloadJSON), &p); err != nil {
+			return fmt.Errorf("decode %s payload: %w", e.Op, err)
+		}
+		if err := b.setEnabledRow(e.PubKey, p.Enabled); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	case OpSetPeerIndex:
+		var p setPeerIndexPayload
+		if err := json.Unmarshal([]byte(e.PayloadJSON), &p); err != nil {
+			return fmt.Errorf("decode %s payload: %w", e.Op, err)
+		}
+		if err := b.setPeerIndexRow(e.PubKey, p.Index); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown change_log op %q", e.Op)
+	}
+
+	_, err := b.insertChangeLogIgnoreDup(e)
+	return err
+}
+
+// isUniqueViolation reports whether err looks like a duplicate-key error
+// from either backend's driver — ApplyRemoteChange treats a remote
+// OpInsertClient for a peer this node already knows about (e.g. it was
+// added locally and raced a mesh pull) as already-applied rather than
+// fatal.
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint") || strings.Contains(msg, "duplicate key")
+}
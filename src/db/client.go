@@ -11,7 +11,10 @@ import (
 
 // peerColumns is the canonical SELECT column list for peers table.
 const peerColumns = `id, public_key, preshared_key, private_key, allowed_ip, allowed_ip_v6,
-	keepalive, enabled, created_at, peer_index, endpoint, last_handshake, rx_bytes, tx_bytes`
+	keepalive, enabled, created_at, peer_index, endpoint, last_handshake, rx_bytes, tx_bytes,
+	quota_bytes, quota_period_sec, quota_reset_at, quota_action,
+	quota_baseline_rx_bytes, quota_baseline_tx_bytes, pinned,
+	acl_packets_accepted, acl_packets_dropped`
 
 // ClientRecord represents a peer/client in bridge-db.
 type ClientRecord struct {
@@ -29,6 +32,38 @@ type ClientRecord struct {
 	LastHandshake *int64 `json:"last_handshake,omitempty"`
 	RxBytes       int64  `json:"rx_bytes"`
 	TxBytes       int64  `json:"tx_bytes"`
+
+	// Quota configuration, set via SetQuota. QuotaBytes == 0 means no quota.
+	QuotaBytes     int64  `json:"quota_bytes,omitempty"`
+	QuotaPeriodSec int    `json:"quota_period_sec,omitempty"`
+	QuotaResetAt   *int64 `json:"quota_reset_at,omitempty"`
+	QuotaAction    string `json:"quota_action,omitempty"`
+
+	// QuotaBaselineRxBytes/QuotaBaselineTxBytes are RxBytes/TxBytes as of
+	// the last SetQuota or quota-period reset (see resetExpiredQuotas).
+	// RxBytes/TxBytes themselves are WireGuard's own lifetime device
+	// counters and never reset, so BytesUsed/checkQuota measure against
+	// these baselines rather than the raw totals — otherwise a period
+	// "reset" would be undone by the very next stats sync, which just
+	// writes the same ever-growing counters back (see db/stats.go's
+	// StatsSyncer).
+	QuotaBaselineRxBytes int64 `json:"quota_baseline_rx_bytes,omitempty"`
+	QuotaBaselineTxBytes int64 `json:"quota_baseline_tx_bytes,omitempty"`
+
+	// Derived gauge fields for a management UI, computed from the fields
+	// above rather than stored — see GetQuotaStatus for the same math.
+	BytesUsed      int64  `json:"bytes_used,omitempty"`
+	BytesRemaining int64  `json:"bytes_remaining,omitempty"`
+	ResetsAt       *int64 `json:"resets_at,omitempty"`
+
+	// Pinned exempts a peer from bridge.State's lazy-peer reaper (see
+	// SetPinned) — it stays IPC-configured on the device even when idle.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Cumulative stateful-filter counters, periodically flushed here by
+	// bridge.Filter — see UpdateACLCounters and db/acl.go.
+	ACLPacketsAccepted int64 `json:"acl_packets_accepted,omitempty"`
+	ACLPacketsDropped  int64 `json:"acl_packets_dropped,omitempty"`
 }
 
 // ClientList is a paginated list of clients.
@@ -51,77 +86,171 @@ type DeviceRecord struct {
 // --- Device operations ---
 
 // UpsertDevice creates or replaces the device record (singleton, id=1).
+// privKey is sealed in place if a KEK is configured via SetKEK.
 func (b *BridgeDB) UpsertDevice(name, privKey, pubKey string, port int) error {
-	_, err := b.db.Exec(`
-		INSERT OR REPLACE INTO device (id, name, private_key, public_key, listen_port)
-		VALUES (1, ?, ?, ?, ?)`,
-		name, privKey, pubKey, port)
-	return err
+	sealed, err := b.sealField(privKey, deviceKEKAAD)
+	if err != nil {
+		return err
+	}
+	return b.backend.UpsertDevice(b.db, name, sealed, pubKey, port)
 }
 
-// GetDevice returns the device record.
+// GetDevice returns the device record, with PrivateKey opened if it was
+// sealed by SetKEK + UpsertDevice/MigrateToEncrypted.
 func (b *BridgeDB) GetDevice() (*DeviceRecord, error) {
-	row := b.db.QueryRow("SELECT name, private_key, public_key, listen_port, started_at FROM device WHERE id = 1")
+	row := b.db.QueryRow(b.rebind("SELECT name, private_key, public_key, listen_port, started_at FROM device WHERE id = 1"))
 	var d DeviceRecord
 	if err := row.Scan(&d.Name, &d.PrivateKey, &d.PublicKey, &d.ListenPort, &d.StartedAt); err != nil {
 		return nil, err
 	}
+	privKey, err := b.openField(d.PrivateKey, deviceKEKAAD)
+	if err != nil {
+		return nil, err
+	}
+	d.PrivateKey = privKey
 	return &d, nil
 }
 
 // SetDeviceStartedAt updates the started_at timestamp.
 func (b *BridgeDB) SetDeviceStartedAt(t *int64) error {
-	_, err := b.db.Exec("UPDATE device SET started_at = ? WHERE id = 1", t)
+	_, err := b.db.Exec(b.rebind("UPDATE device SET started_at = ? WHERE id = 1"), t)
 	return err
 }
 
 // --- Client (peer) operations ---
 
-// InsertClient adds a new client to bridge-db.
+// InsertClient adds a new client to bridge-db. If rec.AllowedIP is already a
+// real prefix (not empty or the "pending" placeholder AddClient uses before
+// pool allocation), it's checked against every other enabled peer's routed
+// prefixes and rejected on conflict before the row is written.
+//
+// rec.PrivateKey/PresharedKey are sealed in the row if a KEK is configured
+// via SetKEK (using rec.PublicKey as AAD, so a sealed blob can't be copied
+// to a different peer's row); rec itself is left holding the plaintext the
+// caller passed in. Also appends a change_log row (see ChangeLogEntry) so
+// any configured mesh peers pick up the new client on their next sync.
 func (b *BridgeDB) InsertClient(rec *ClientRecord) error {
+	if rec.AllowedIP != "" && rec.AllowedIP != "pending" {
+		if conflictID, has, err := b.CheckAllowedIPConflict(0, rec.AllowedIP); err != nil {
+			return err
+		} else if has {
+			return fmt.Errorf("allowed ip %s conflicts with existing peer %d", rec.AllowedIP, conflictID)
+		}
+	}
+
 	rec.CreatedAt = time.Now().Unix()
-	var ipv6 interface{}
-	if rec.AllowedIPv6 != "" {
-		ipv6 = rec.AllowedIPv6
+	if err := b.insertClientRow(rec); err != nil {
+		return err
+	}
+
+	payload := insertClientPayload{
+		PublicKey: rec.PublicKey, PresharedKey: rec.PresharedKey, PrivateKey: rec.PrivateKey,
+		AllowedIP: rec.AllowedIP, AllowedIPv6: rec.AllowedIPv6, Keepalive: rec.Keepalive, CreatedAt: rec.CreatedAt,
+	}
+	if err := b.appendChangeLog(b.db, OpInsertClient, rec.PublicKey, payload); err != nil {
+		return fmt.Errorf("log change: %w", err)
+	}
+	return nil
+}
+
+// insertClientRow does the actual write InsertClient and ApplyRemoteChange
+// share: seal+store the row and load its allowed IP(s) into the trie.
+// Unlike InsertClient, it doesn't check for allowed-IP conflicts or record
+// a change_log row — InsertClient does both itself, and a remotely-applied
+// insert already carries a network-wide-unique allowed_ip from wherever it
+// was originally allocated.
+func (b *BridgeDB) insertClientRow(rec *ClientRecord) error {
+	stored := *rec
+	sealedPriv, err := b.sealField(rec.PrivateKey, rec.PublicKey)
+	if err != nil {
+		return err
+	}
+	stored.PrivateKey = sealedPriv
+	sealedPSK, err := b.sealField(rec.PresharedKey, rec.PublicKey)
+	if err != nil {
+		return err
 	}
-	result, err := b.db.Exec(`
-		INSERT INTO peers (public_key, preshared_key, private_key, allowed_ip, allowed_ip_v6, keepalive, enabled, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, 1, ?)`,
-		rec.PublicKey, rec.PresharedKey, rec.PrivateKey, rec.AllowedIP, ipv6, rec.Keepalive, rec.CreatedAt)
+	stored.PresharedKey = sealedPSK
+
+	id, err := b.backend.InsertPeer(b.db, &stored)
 	if err != nil {
 		return err
 	}
-	rec.ID, _ = result.LastInsertId()
+	rec.ID = id
 	rec.Enabled = true
+
+	if rec.AllowedIP != "" && rec.AllowedIP != "pending" {
+		_ = b.allowedIPs.insert(rec.AllowedIP, id)
+	}
+	if rec.AllowedIPv6 != "" {
+		_ = b.allowedIPs.insert(rec.AllowedIPv6, id)
+	}
 	return nil
 }
 
-// DeleteClient removes a client by public key and releases its IP(s).
+// DeleteClient removes a client by public key, releases its IP(s), and
+// appends a change_log row so any configured mesh peers remove it too.
 func (b *BridgeDB) DeleteClient(pubKey string) error {
-	tx, err := b.db.Begin()
+	peerID, removed, err := b.deleteClientTx(pubKey, true)
+	if err != nil {
+		return err
+	}
+	if removed {
+		b.allowedIPs.removeByPeer(peerID)
+	}
+	return nil
+}
+
+// deleteClientRow is ApplyRemoteChange's entry point — same write DeleteClient
+// does, minus the change_log row (a remote op is already one).
+func (b *BridgeDB) deleteClientRow(pubKey string) error {
+	peerID, removed, err := b.deleteClientTx(pubKey, false)
 	if err != nil {
 		return err
 	}
+	if removed {
+		b.allowedIPs.removeByPeer(peerID)
+	}
+	return nil
+}
+
+func (b *BridgeDB) deleteClientTx(pubKey string, logChange bool) (peerID int64, removed bool, err error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
 	defer func() { _ = tx.Rollback() }()
 
+	hasID := tx.QueryRow(b.rebind("SELECT id FROM peers WHERE public_key = ?"), pubKey).Scan(&peerID) == nil
+
 	// Release IPs back to pool
-	_, _ = tx.Exec("UPDATE ip_pool SET assigned = 0, peer_id = NULL WHERE peer_id = (SELECT id FROM peers WHERE public_key = ?)", pubKey)
+	_, _ = tx.Exec(b.rebind("UPDATE ip_pool SET assigned = 0, peer_id = NULL WHERE peer_id = (SELECT id FROM peers WHERE public_key = ?)"), pubKey)
 
-	result, err := tx.Exec("DELETE FROM peers WHERE public_key = ?", pubKey)
+	result, err := tx.Exec(b.rebind("DELETE FROM peers WHERE public_key = ?"), pubKey)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
 	n, _ := result.RowsAffected()
 	if n == 0 {
-		return sql.ErrNoRows
+		return 0, false, sql.ErrNoRows
 	}
-	return tx.Commit()
+
+	if logChange {
+		if err := b.appendChangeLog(tx, OpDeleteClient, pubKey, struct{}{}); err != nil {
+			return 0, false, fmt.Errorf("log change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return peerID, hasID, nil
 }
 
 // GetClient retrieves a client by public key.
 func (b *BridgeDB) GetClient(pubKey string) (*ClientRecord, error) {
-	row := b.db.QueryRow("SELECT "+peerColumns+" FROM peers WHERE public_key = ?", pubKey)
-	return scanClient(row)
+	row := b.db.QueryRow(b.rebind("SELECT "+peerColumns+" FROM peers WHERE public_key = ?"), pubKey)
+	return b.scanClient(row)
 }
 
 // ListClients returns a paginated list of all clients.
@@ -139,7 +268,7 @@ func (b *BridgeDB) ListClients(page, limit int) (*ClientList, error) {
 		return nil, err
 	}
 
-	rows, err := b.db.Query("SELECT "+peerColumns+" FROM peers ORDER BY id LIMIT ? OFFSET ?", limit, offset)
+	rows, err := b.db.Query(b.rebind("SELECT "+peerColumns+" FROM peers ORDER BY id LIMIT ? OFFSET ?"), limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +276,7 @@ func (b *BridgeDB) ListClients(page, limit int) (*ClientList, error) {
 
 	var clients []ClientRecord
 	for rows.Next() {
-		c, err := scanClient(rows)
+		c, err := b.scanClient(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -165,13 +294,37 @@ func (b *BridgeDB) ListClients(page, limit int) (*ClientList, error) {
 	}, nil
 }
 
-// SetEnabled toggles the enabled status of a client.
+// SetEnabled toggles the enabled status of a client. A disabled peer's
+// prefixes are pulled from the in-memory trie (so CheckAllowedIPConflict
+// frees them up for reassignment and LookupPeerByIP stops routing to them);
+// re-enabling reloads them. Appends a change_log row so any configured mesh
+// peers pick up the new enabled state on their next sync.
 func (b *BridgeDB) SetEnabled(pubKey string, enabled bool) error {
+	return b.setEnabledTx(pubKey, enabled, true)
+}
+
+// setEnabledRow is ApplyRemoteChange's entry point — same write SetEnabled
+// does, minus the change_log row (a remote op is already one).
+func (b *BridgeDB) setEnabledRow(pubKey string, enabled bool) error {
+	return b.setEnabledTx(pubKey, enabled, false)
+}
+
+func (b *BridgeDB) setEnabledTx(pubKey string, enabled bool, logChange bool) error {
 	val := 0
 	if enabled {
 		val = 1
 	}
-	result, err := b.db.Exec("UPDATE peers SET enabled = ?, peer_index = NULL WHERE public_key = ?", val, pubKey)
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var peerID int64
+	hasID := tx.QueryRow(b.rebind("SELECT id FROM peers WHERE public_key = ?"), pubKey).Scan(&peerID) == nil
+
+	result, err := tx.Exec(b.rebind("UPDATE peers SET enabled = ?, peer_index = NULL WHERE public_key = ?"), val, pubKey)
 	if err != nil {
 		return err
 	}
@@ -179,18 +332,90 @@ func (b *BridgeDB) SetEnabled(pubKey string, enabled bool) error {
 	if n == 0 {
 		return sql.ErrNoRows
 	}
+
+	if logChange {
+		if err := b.appendChangeLog(tx, OpSetEnabled, pubKey, setEnabledPayload{Enabled: enabled}); err != nil {
+			return fmt.Errorf("log change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if hasID {
+		b.allowedIPs.removeByPeer(peerID)
+		if enabled {
+			if err := b.reinsertPeerAllowedIPs(peerID); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-// SetPeerIndex updates the bridge handle for a peer.
+// SetPeerIndex updates the bridge handle for a peer. Appends a change_log
+// row so any configured mesh peers pick up the new index on their next
+// sync — mostly relevant for diagnostics, since peer_index is a runtime
+// handle that's only meaningful on the node that assigned it.
 func (b *BridgeDB) SetPeerIndex(pubKey string, idx *int64) error {
-	_, err := b.db.Exec("UPDATE peers SET peer_index = ? WHERE public_key = ?", idx, pubKey)
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(b.rebind("UPDATE peers SET peer_index = ? WHERE public_key = ?"), idx, pubKey); err != nil {
+		return err
+	}
+	if err := b.appendChangeLog(tx, OpSetPeerIndex, pubKey, setPeerIndexPayload{Index: idx}); err != nil {
+		return fmt.Errorf("log change: %w", err)
+	}
+	return tx.Commit()
+}
+
+// setPeerIndexRow is ApplyRemoteChange's entry point — same write
+// SetPeerIndex does, minus the change_log row (a remote op is already one).
+func (b *BridgeDB) setPeerIndexRow(pubKey string, idx *int64) error {
+	_, err := b.db.Exec(b.rebind("UPDATE peers SET peer_index = ? WHERE public_key = ?"), idx, pubKey)
 	return err
 }
 
+// SetPresharedKey updates a peer's stored preshared key, e.g. after a PSK
+// rotation. Returns sql.ErrNoRows if pubKey is not a known client.
+func (b *BridgeDB) SetPresharedKey(pubKey, psk string) error {
+	result, err := b.db.Exec(b.rebind("UPDATE peers SET preshared_key = ? WHERE public_key = ?"), psk, pubKey)
+	if err != nil {
+		return err
+	}
+	n, _ := result.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetPinned exempts (or un-exempts) a peer from bridge.State's lazy-peer
+// reaper. Returns sql.ErrNoRows if pubKey is not a known client.
+func (b *BridgeDB) SetPinned(pubKey string, pinned bool) error {
+	val := 0
+	if pinned {
+		val = 1
+	}
+	result, err := b.db.Exec(b.rebind("UPDATE peers SET pinned = ? WHERE public_key = ?"), val, pubKey)
+	if err != nil {
+		return err
+	}
+	n, _ := result.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // EnabledClients returns all enabled clients for startup restoration.
 func (b *BridgeDB) EnabledClients() ([]ClientRecord, error) {
-	rows, err := b.db.Query("SELECT "+peerColumns+" FROM peers WHERE enabled = 1 ORDER BY id")
+	rows, err := b.db.Query(b.rebind("SELECT " + peerColumns + " FROM peers WHERE enabled = 1 ORDER BY id"))
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +423,7 @@ func (b *BridgeDB) EnabledClients() ([]ClientRecord, error) {
 
 	var clients []ClientRecord
 	for rows.Next() {
-		c, err := scanClient(rows)
+		c, err := b.scanClient(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -208,14 +433,74 @@ func (b *BridgeDB) EnabledClients() ([]ClientRecord, error) {
 }
 
 // UpdateStats updates runtime stats for a client (called by stats syncer).
+// A non-nil quota for this peer is checked against the new totals; see
+// checkQuota for what happens on breach.
 func (b *BridgeDB) UpdateStats(pubKey string, endpoint string, lastHandshake *int64, rxBytes, txBytes int64) error {
-	_, err := b.db.Exec(`
+	_, err := b.db.Exec(b.rebind(`
 		UPDATE peers SET endpoint = ?, last_handshake = ?, rx_bytes = ?, tx_bytes = ?
-		WHERE public_key = ?`,
+		WHERE public_key = ?`),
 		endpoint, lastHandshake, rxBytes, txBytes, pubKey)
+	if err != nil {
+		return err
+	}
+	_, err = b.checkQuota(pubKey, rxBytes, txBytes)
 	return err
 }
 
+// StatUpdate is one peer's runtime stats row for BatchUpdateStats.
+type StatUpdate struct {
+	PublicKey     string
+	Endpoint      string
+	LastHandshake *int64
+	RxBytes       int64
+	TxBytes       int64
+}
+
+// BatchUpdateStats writes multiple peers' runtime stats in a single
+// transaction, for StatsSyncer's change-detected batched sync. Returns one
+// PeerEvent per peer whose quota was breached by this batch, so the caller
+// can publish them the same way it publishes handshake/endpoint events.
+func (b *BridgeDB) BatchUpdateStats(updates []StatUpdate) ([]PeerEvent, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare(b.rebind(`
+		UPDATE peers SET endpoint = ?, last_handshake = ?, rx_bytes = ?, tx_bytes = ?
+		WHERE public_key = ?`))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, u := range updates {
+		if _, err := stmt.Exec(u.Endpoint, u.LastHandshake, u.RxBytes, u.TxBytes, u.PublicKey); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var events []PeerEvent
+	for _, u := range updates {
+		ev, err := b.checkQuota(u.PublicKey, u.RxBytes, u.TxBytes)
+		if err != nil {
+			continue
+		}
+		if ev != nil {
+			events = append(events, *ev)
+		}
+	}
+	return events, nil
+}
+
 // ClearRuntimeState resets ephemeral fields on shutdown.
 func (b *BridgeDB) ClearRuntimeState() error {
 	_, err := b.db.Exec("UPDATE peers SET peer_index = NULL")
@@ -239,7 +524,7 @@ func (b *BridgeDB) InitIPPool(network, networkV6 string) error {
 	}
 
 	// Populate IPv4
-	ips, err := expandSubnet(network, 4)
+	ips, err := expandSubnet(network)
 	if err != nil {
 		return fmt.Errorf("expand v4: %w", err)
 	}
@@ -250,7 +535,7 @@ func (b *BridgeDB) InitIPPool(network, networkV6 string) error {
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	stmt, err := tx.Prepare("INSERT INTO ip_pool (ip, family, assigned) VALUES (?, 4, 0)")
+	stmt, err := tx.Prepare(b.rebind("INSERT INTO ip_pool (ip, family, assigned) VALUES (?, 4, 0)"))
 	if err != nil {
 		return err
 	}
@@ -269,47 +554,41 @@ func (b *BridgeDB) InitIPPool(network, networkV6 string) error {
 	return b.initIPPoolV6(networkV6)
 }
 
+// initIPPoolV6 records networkV6 as a range in ip_pool_v6_ranges rather than
+// materializing every address the way the v4 pool does — see AllocateIP's
+// v6 branch for why this pool only ever stores allocated addresses.
 func (b *BridgeDB) initIPPoolV6(networkV6 string) error {
 	if networkV6 == "" {
 		return nil
 	}
 	var count int
-	if err := b.db.QueryRow("SELECT COUNT(*) FROM ip_pool WHERE family = 6").Scan(&count); err != nil {
+	if err := b.db.QueryRow("SELECT COUNT(*) FROM ip_pool_v6_ranges").Scan(&count); err != nil {
 		return err
 	}
 	if count > 0 {
 		return nil
 	}
 
-	ips, err := expandSubnet(networkV6, 6)
+	start, end, err := v6RangeBounds(networkV6)
 	if err != nil {
 		return fmt.Errorf("expand v6: %w", err)
 	}
 
-	tx, err := b.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	stmt, err := tx.Prepare("INSERT INTO ip_pool (ip, family, assigned) VALUES (?, 6, 0)")
-	if err != nil {
-		return err
-	}
-	defer func() { _ = stmt.Close() }()
-
-	for _, ip := range ips {
-		if _, err := stmt.Exec(ip); err != nil {
-			return err
-		}
-	}
-
-	return tx.Commit()
+	_, err = b.db.Exec(b.rebind(
+		"INSERT INTO ip_pool_v6_ranges (start, end, family) VALUES (?, ?, 6)"),
+		start.String(), end.String())
+	return err
 }
 
-// AllocateIP finds the first unassigned IP, marks it assigned, and links to peer.
-// Returns CIDR notation (e.g. "10.8.0.2/32" or "fd00::2/128").
+// AllocateIP finds an unassigned IP, marks it assigned, and links to peer.
+// Returns CIDR notation (e.g. "10.8.0.2/32" or "fd00::2/128"). IPv4 still
+// picks the first unassigned row out of the materialized ip_pool; IPv6 is
+// sparse (see allocateV6IP) since its pool is never materialized.
 func (b *BridgeDB) AllocateIP(peerID int64, family int) (string, error) {
+	if family == 6 {
+		return b.allocateV6IP(peerID)
+	}
+
 	tx, err := b.db.Begin()
 	if err != nil {
 		return "", err
@@ -317,12 +596,12 @@ func (b *BridgeDB) AllocateIP(peerID int64, family int) (string, error) {
 	defer func() { _ = tx.Rollback() }()
 
 	var ip string
-	err = tx.QueryRow("SELECT ip FROM ip_pool WHERE family = ? AND assigned = 0 ORDER BY rowid LIMIT 1", family).Scan(&ip)
+	err = tx.QueryRow(b.rebind("SELECT ip FROM ip_pool WHERE family = 4 AND assigned = 0 ORDER BY ip LIMIT 1")).Scan(&ip)
 	if err != nil {
-		return "", fmt.Errorf("ip pool exhausted (family=%d): %w", family, err)
+		return "", fmt.Errorf("ip pool exhausted (family=4): %w", err)
 	}
 
-	if _, err := tx.Exec("UPDATE ip_pool SET assigned = 1, peer_id = ? WHERE ip = ?", peerID, ip); err != nil {
+	if _, err := tx.Exec(b.rebind("UPDATE ip_pool SET assigned = 1, peer_id = ? WHERE ip = ?"), peerID, ip); err != nil {
 		return "", err
 	}
 
@@ -330,14 +609,14 @@ func (b *BridgeDB) AllocateIP(peerID int64, family int) (string, error) {
 		return "", err
 	}
 
-	cidr := "/32"
-	if family == 6 {
-		cidr = "/128"
-	}
-	return ip + cidr, nil
+	cidr := ip + "/32"
+	_ = b.allowedIPs.insert(cidr, peerID)
+	return cidr, nil
 }
 
-// ReleaseIP marks an IP as unassigned.
+// ReleaseIP marks an IP as unassigned. Checks ip_pool_v6_assigned first
+// since a v6 address has no corresponding materialized ip_pool row to
+// un-assign — it either has an assigned row there or it was never taken.
 func (b *BridgeDB) ReleaseIP(ip string) error {
 	// Strip CIDR suffix if present
 	for i := len(ip) - 1; i >= 0; i-- {
@@ -346,35 +625,47 @@ func (b *BridgeDB) ReleaseIP(ip string) error {
 			break
 		}
 	}
-	_, err := b.db.Exec("UPDATE ip_pool SET assigned = 0, peer_id = NULL WHERE ip = ?", ip)
-	return err
+
+	var v6PeerID int64
+	hasV6 := b.db.QueryRow(b.rebind("SELECT peer_id FROM ip_pool_v6_assigned WHERE ip = ?"), ip).Scan(&v6PeerID) == nil
+	if hasV6 {
+		if _, err := b.db.Exec(b.rebind("DELETE FROM ip_pool_v6_assigned WHERE ip = ?"), ip); err != nil {
+			return err
+		}
+		b.allowedIPs.removeOne(ip+"/128", v6PeerID)
+		return nil
+	}
+
+	var v4PeerID sql.NullInt64
+	_ = b.db.QueryRow(b.rebind("SELECT peer_id FROM ip_pool WHERE ip = ?"), ip).Scan(&v4PeerID)
+
+	if _, err := b.db.Exec(b.rebind("UPDATE ip_pool SET assigned = 0, peer_id = NULL WHERE ip = ?"), ip); err != nil {
+		return err
+	}
+	if v4PeerID.Valid {
+		b.allowedIPs.removeOne(ip+"/32", v4PeerID.Int64)
+	}
+	return nil
 }
 
-// expandSubnet generates usable host IPs from a CIDR.
-// For IPv4: skips .0 (network) and .1 (gateway).
-// For IPv6: generates first 253 hosts after ::1 (practical limit for WG peers).
-func expandSubnet(cidr string, family int) ([]string, error) {
+// expandSubnet generates usable IPv4 host addresses from a CIDR, skipping
+// .0 (network) and .1 (gateway). IPv6 pools are sparse (see ipv6pool.go)
+// and never materialized this way.
+func expandSubnet(cidr string) ([]string, error) {
 	_, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return nil, fmt.Errorf("parse cidr: %w", err)
 	}
 
-	if family == 4 {
-		return expandV4(ipNet), nil
-	}
-	return expandV6(ipNet), nil
-}
-
-func expandV4(ipNet *net.IPNet) []string {
 	base := ipNet.IP.To4()
 	if base == nil {
-		return nil
+		return nil, fmt.Errorf("not an IPv4 cidr: %s", cidr)
 	}
 
 	ones, bits := ipNet.Mask.Size()
 	hostCount := (1 << (bits - ones)) - 2 // exclude network + broadcast
 	if hostCount <= 1 {
-		return nil
+		return nil, nil
 	}
 
 	baseInt := binary.BigEndian.Uint32(base)
@@ -387,26 +678,7 @@ func expandV4(ipNet *net.IPNet) []string {
 			ips = append(ips, ip.String())
 		}
 	}
-	return ips
-}
-
-func expandV6(ipNet *net.IPNet) []string {
-	base := ipNet.IP.To16()
-	if base == nil {
-		return nil
-	}
-
-	// Generate first 253 usable addresses (::2 through ::fe)
-	var ips []string
-	for i := 2; i <= 254; i++ {
-		ip := make(net.IP, 16)
-		copy(ip, base)
-		ip[15] = byte(i)
-		if ipNet.Contains(ip) {
-			ips = append(ips, ip.String())
-		}
-	}
-	return ips
+	return ips, nil
 }
 
 // --- JSON helpers ---
@@ -429,20 +701,37 @@ type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-func scanClient(s scanner) (*ClientRecord, error) {
+// scanClient scans one peers row and opens PrivateKey/PresharedKey if they
+// were sealed by SetKEK + InsertClient/MigrateToEncrypted.
+func (b *BridgeDB) scanClient(s scanner) (*ClientRecord, error) {
 	var c ClientRecord
-	var enabled int
+	var enabled, pinned int
 	var psk, ipv6, endpoint sql.NullString
-	var peerIdx, handshake sql.NullInt64
+	var peerIdx, handshake, quotaResetAt sql.NullInt64
 	if err := s.Scan(
 		&c.ID, &c.PublicKey, &psk, &c.PrivateKey, &c.AllowedIP, &ipv6,
 		&c.Keepalive, &enabled, &c.CreatedAt, &peerIdx, &endpoint, &handshake, &c.RxBytes, &c.TxBytes,
+		&c.QuotaBytes, &c.QuotaPeriodSec, &quotaResetAt, &c.QuotaAction,
+		&c.QuotaBaselineRxBytes, &c.QuotaBaselineTxBytes, &pinned,
+		&c.ACLPacketsAccepted, &c.ACLPacketsDropped,
 	); err != nil {
 		return nil, err
 	}
 	c.Enabled = enabled == 1
+	c.Pinned = pinned == 1
+
+	privKey, err := b.openField(c.PrivateKey, c.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	c.PrivateKey = privKey
+
 	if psk.Valid {
-		c.PresharedKey = psk.String
+		presharedKey, err := b.openField(psk.String, c.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		c.PresharedKey = presharedKey
 	}
 	if ipv6.Valid {
 		c.AllowedIPv6 = ipv6.String
@@ -458,5 +747,18 @@ func scanClient(s scanner) (*ClientRecord, error) {
 		v := handshake.Int64
 		c.LastHandshake = &v
 	}
+	if quotaResetAt.Valid {
+		v := quotaResetAt.Int64
+		c.QuotaResetAt = &v
+		c.ResetsAt = &v
+	}
+	if c.QuotaBytes > 0 {
+		if c.BytesUsed = (c.RxBytes - c.QuotaBaselineRxBytes) + (c.TxBytes - c.QuotaBaselineTxBytes); c.BytesUsed < 0 {
+			c.BytesUsed = 0
+		}
+		if c.BytesRemaining = c.QuotaBytes - c.BytesUsed; c.BytesRemaining < 0 {
+			c.BytesRemaining = 0
+		}
+	}
 	return &c, nil
-}
\ No newline at end of file
+}
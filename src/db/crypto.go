@@ -0,0 +1,201 @@
+package db
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Cipher seals and opens small secrets (private keys, PSKs) for storage at
+// rest. aad is authenticated but not encrypted, and the same aad used to
+// Seal a value must be supplied to Open it.
+type Cipher interface {
+	Seal(plaintext, aad []byte) ([]byte, error)
+	Open(ciphertext, aad []byte) ([]byte, error)
+}
+
+// xchachaCipher implements Cipher with XChaCha20-Poly1305. Its 24-byte
+// nonce is large enough to generate at random per call without the
+// birthday-bound collision risk plain ChaCha20-Poly1305's 12-byte nonce
+// would have at bridge-db's write volume.
+type xchachaCipher struct {
+	aead cipher.AEAD
+}
+
+// xchachaKeyInfo domain-separates bridge-db's at-rest key from any other
+// use of the same KEK material elsewhere in a deployment.
+const xchachaKeyInfo = "wireguard-go-bridge/db-at-rest-v1"
+
+func newXChaChaCipher(kek []byte) (*xchachaCipher, error) {
+	if len(kek) == 0 {
+		return nil, fmt.Errorf("kek must not be empty")
+	}
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, kek, nil, []byte(xchachaKeyInfo)), key); err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("new aead: %w", err)
+	}
+	return &xchachaCipher{aead: aead}, nil
+}
+
+func (c *xchachaCipher) Seal(plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("random nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (c *xchachaCipher) Open(ciphertext, aad []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:n], ciphertext[n:]
+	return c.aead.Open(nil, nonce, sealed, aad)
+}
+
+// encFieldPrefix marks a column value as a sealed nonce||ciphertext||tag
+// blob (base64-encoded so it still fits the existing TEXT columns) rather
+// than the plaintext hex key/PSK those columns held before chunk3-4.
+const encFieldPrefix = "enc:v1:"
+
+// SetKEK derives bridge-db's at-rest key from kek and enables sealing for
+// every subsequent InsertClient/UpsertDevice call. kek can come from an
+// env var, a file, or an OS keychain — BridgeDB doesn't care, it just
+// needs the raw bytes; callers that want plaintext-at-rest (the default,
+// backward-compatible behavior) simply never call this.
+func (b *BridgeDB) SetKEK(kek []byte) error {
+	c, err := newXChaChaCipher(kek)
+	if err != nil {
+		return err
+	}
+	b.cipher = c
+	return nil
+}
+
+// sealField seals plaintext for storage, or returns it unchanged if no KEK
+// is configured or plaintext is empty (an unset PSK stays unset).
+func (b *BridgeDB) sealField(plaintext, aad string) (string, error) {
+	if b.cipher == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	ct, err := b.cipher.Seal([]byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("seal: %w", err)
+	}
+	return encFieldPrefix + base64.StdEncoding.EncodeToString(ct), nil
+}
+
+// openField reverses sealField. Values without the enc:v1: prefix are
+// passed through unchanged, so a bridge-db that's never called SetKEK (or
+// a row written before MigrateToEncrypted ran) keeps reading as plaintext.
+func (b *BridgeDB) openField(stored, aad string) (string, error) {
+	payload, ok := strings.CutPrefix(stored, encFieldPrefix)
+	if !ok {
+		return stored, nil
+	}
+	if b.cipher == nil {
+		return "", fmt.Errorf("field is sealed but no KEK is configured")
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("decode sealed field: %w", err)
+	}
+	pt, err := b.cipher.Open(raw, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("open sealed field: %w", err)
+	}
+	return string(pt), nil
+}
+
+// deviceKEKAAD is the AAD for the singleton device row's private key —
+// peers use their own public_key as AAD, but the device row has no
+// equivalent natural identifier to bind to.
+const deviceKEKAAD = "device:1"
+
+// MigrateToEncrypted seals every peer's private_key/preshared_key and the
+// device's private_key in place. Idempotent — values already carrying the
+// enc:v1: prefix are left untouched, so it's safe to run on every startup
+// once a KEK is configured. SetKEK must be called first.
+func (b *BridgeDB) MigrateToEncrypted() error {
+	if b.cipher == nil {
+		return fmt.Errorf("MigrateToEncrypted: call SetKEK first")
+	}
+
+	type peerSecrets struct {
+		id      int64
+		pubKey  string
+		privKey string
+		psk     sql.NullString
+	}
+
+	rows, err := b.db.Query("SELECT id, public_key, private_key, preshared_key FROM peers")
+	if err != nil {
+		return err
+	}
+	var peers []peerSecrets
+	for rows.Next() {
+		var p peerSecrets
+		if err := rows.Scan(&p.id, &p.pubKey, &p.privKey, &p.psk); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		peers = append(peers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_ = rows.Close()
+
+	for _, p := range peers {
+		privKey := p.privKey
+		if !strings.HasPrefix(privKey, encFieldPrefix) {
+			if privKey, err = b.sealField(privKey, p.pubKey); err != nil {
+				return err
+			}
+		}
+
+		var psk interface{}
+		if p.psk.Valid {
+			v := p.psk.String
+			if !strings.HasPrefix(v, encFieldPrefix) {
+				if v, err = b.sealField(v, p.pubKey); err != nil {
+					return err
+				}
+			}
+			psk = v
+		}
+
+		if _, err := b.db.Exec(b.rebind("UPDATE peers SET private_key = ?, preshared_key = ? WHERE id = ?"),
+			privKey, psk, p.id); err != nil {
+			return err
+		}
+	}
+
+	var devPriv string
+	if err := b.db.QueryRow("SELECT private_key FROM device WHERE id = 1").Scan(&devPriv); err == nil {
+		if !strings.HasPrefix(devPriv, encFieldPrefix) {
+			sealed, err := b.sealField(devPriv, deviceKEKAAD)
+			if err != nil {
+				return err
+			}
+			if _, err := b.db.Exec("UPDATE device SET private_key = ? WHERE id = 1", sealed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
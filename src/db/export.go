@@ -0,0 +1,358 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ExportSnapshot is the full-state payload bridge.State.ExportState/
+// ImportState round-trip as HJSON — device keypair, server config, every
+// client, and every multihop tunnel. See Snapshot and ApplyImport.
+type ExportSnapshot struct {
+	Device          *DeviceRecord    `json:"device,omitempty" comment:"This node's own WireGuard keypair and listen port."`
+	ServerConfig    *ServerConfig    `json:"server_config,omitempty" comment:"Network, DNS, MTU, fwmark, and routing-hook settings."`
+	Clients         []ClientRecord   `json:"clients,omitempty" comment:"Every peer this node knows about, enabled or not."`
+	MultihopTunnels []MultihopTunnel `json:"multihop_tunnels,omitempty" comment:"Upstream multihop exit/relay tunnels."`
+}
+
+// Snapshot reads the device keypair, server config, every client, and
+// every multihop tunnel into one ExportSnapshot.
+func (b *BridgeDB) Snapshot() (*ExportSnapshot, error) {
+	snap := &ExportSnapshot{}
+
+	if dev, err := b.GetDevice(); err == nil {
+		snap.Device = dev
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if cfg, err := b.GetServerConfig(1); err == nil {
+		snap.ServerConfig = cfg
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	clients, err := b.AllClients()
+	if err != nil {
+		return nil, err
+	}
+	snap.Clients = clients
+
+	tunnels, err := b.ListMultihopTunnels()
+	if err != nil {
+		return nil, err
+	}
+	snap.MultihopTunnels = tunnels
+
+	return snap, nil
+}
+
+// AllClients returns every client row, unpaginated — ListClients caps its
+// page size for API callers, but Snapshot needs the whole fleet at once.
+func (b *BridgeDB) AllClients() ([]ClientRecord, error) {
+	rows, err := b.db.Query(b.rebind("SELECT " + peerColumns + " FROM peers ORDER BY id"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var clients []ClientRecord
+	for rows.Next() {
+		c, err := b.scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	return clients, nil
+}
+
+// SetClientRouting updates an existing client's routed prefixes and
+// keepalive interval, checking the new AllowedIP for pool conflicts the
+// same way InsertClient does. Used by ApplyImport to reconcile a peer's
+// routing against an imported snapshot; there's no dedicated setter for
+// this pair elsewhere because nothing but import changes them in place
+// today (AllocateIP/ReleaseIP own the normal pool-assignment path).
+func (b *BridgeDB) SetClientRouting(pubKey, allowedIP, allowedIPv6 string, keepalive int) error {
+	client, err := b.GetClient(pubKey)
+	if err != nil {
+		return err
+	}
+
+	if allowedIP != client.AllowedIP && allowedIP != "" && allowedIP != "pending" {
+		if conflictID, has, err := b.CheckAllowedIPConflict(client.ID, allowedIP); err != nil {
+			return err
+		} else if has {
+			return fmt.Errorf("allowed ip %s conflicts with existing peer %d", allowedIP, conflictID)
+		}
+	}
+
+	result, err := b.db.Exec(b.rebind(
+		"UPDATE peers SET allowed_ip = ?, allowed_ip_v6 = ?, keepalive = ? WHERE public_key = ?"),
+		allowedIP, allowedIPv6, keepalive, pubKey)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	b.allowedIPs.removeByPeer(client.ID)
+	if allowedIP != "" && allowedIP != "pending" {
+		_ = b.allowedIPs.insert(allowedIP, client.ID)
+	}
+	if allowedIPv6 != "" {
+		_ = b.allowedIPs.insert(allowedIPv6, client.ID)
+	}
+	return nil
+}
+
+// ImportDiff summarizes what ApplyImport changed (or would change, in
+// dry-run mode), keyed by public key / tunnel name for the caller to render
+// or log.
+type ImportDiff struct {
+	DeviceChanged       bool     `json:"device_changed,omitempty"`
+	ServerConfigChanged bool     `json:"server_config_changed,omitempty"`
+	ClientsAdded        []string `json:"clients_added,omitempty"`
+	ClientsUpdated      []string `json:"clients_updated,omitempty"`
+	ClientsRemoved      []string `json:"clients_removed,omitempty"`
+	TunnelsAdded        []string `json:"tunnels_added,omitempty"`
+	TunnelsUpdated      []string `json:"tunnels_updated,omitempty"`
+	TunnelsRemoved      []string `json:"tunnels_removed,omitempty"`
+}
+
+// empty reports whether diff found nothing to do, so ApplyImport can return
+// without writing anything when an import was a no-op.
+func (d *ImportDiff) empty() bool {
+	return !d.DeviceChanged && !d.ServerConfigChanged &&
+		len(d.ClientsAdded) == 0 && len(d.ClientsUpdated) == 0 && len(d.ClientsRemoved) == 0 &&
+		len(d.TunnelsAdded) == 0 && len(d.TunnelsUpdated) == 0 && len(d.TunnelsRemoved) == 0
+}
+
+// ApplyImport diffs snapshot against the current database state and,
+// unless dryRun, applies the difference: clients/tunnels present in
+// snapshot but not the database are inserted, ones that differ are
+// updated in place, and — unless merge is set to keep them — ones present
+// in the database but absent from snapshot are removed. Device and server
+// config are replaced outright when snapshot carries them (there's only
+// ever one of each, so there's no add/remove case for either).
+//
+// Each entity is written through its own existing setter (InsertClient,
+// SetClientRouting, UpdateMultihopTunnel, ...) rather than one shared
+// *sql.Tx — BridgeDB's backend interface doesn't thread an executer
+// through those paths, so this isn't atomic across entities the way
+// ReplacePeerACLs is within one table. A failure partway leaves the
+// database holding whatever was applied before it; the caller gets the
+// error immediately and a re-run is safe, since already-applied entities
+// diff to no-ops against the same snapshot.
+func (b *BridgeDB) ApplyImport(snapshot *ExportSnapshot, merge, dryRun bool) (*ImportDiff, error) {
+	current, err := b.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ImportDiff{}
+
+	if snapshot.Device != nil {
+		cur := current.Device
+		if cur == nil || cur.Name != snapshot.Device.Name || cur.PrivateKey != snapshot.Device.PrivateKey ||
+			cur.PublicKey != snapshot.Device.PublicKey || cur.ListenPort != snapshot.Device.ListenPort {
+			diff.DeviceChanged = true
+		}
+	}
+
+	if snapshot.ServerConfig != nil {
+		cur := current.ServerConfig
+		if cur == nil || *cur != *snapshot.ServerConfig {
+			diff.ServerConfigChanged = true
+		}
+	}
+
+	currentClients := make(map[string]ClientRecord, len(current.Clients))
+	for _, c := range current.Clients {
+		currentClients[c.PublicKey] = c
+	}
+	snapshotClients := make(map[string]struct{}, len(snapshot.Clients))
+	for _, c := range snapshot.Clients {
+		snapshotClients[c.PublicKey] = struct{}{}
+		if cur, ok := currentClients[c.PublicKey]; !ok {
+			diff.ClientsAdded = append(diff.ClientsAdded, c.PublicKey)
+		} else if clientChanged(cur, c) {
+			diff.ClientsUpdated = append(diff.ClientsUpdated, c.PublicKey)
+		}
+	}
+	if !merge {
+		for pubKey := range currentClients {
+			if _, ok := snapshotClients[pubKey]; !ok {
+				diff.ClientsRemoved = append(diff.ClientsRemoved, pubKey)
+			}
+		}
+	}
+
+	currentTunnels := make(map[string]MultihopTunnel, len(current.MultihopTunnels))
+	for _, t := range current.MultihopTunnels {
+		currentTunnels[t.Name] = t
+	}
+	snapshotTunnels := make(map[string]struct{}, len(snapshot.MultihopTunnels))
+	for _, t := range snapshot.MultihopTunnels {
+		snapshotTunnels[t.Name] = struct{}{}
+		if cur, ok := currentTunnels[t.Name]; !ok {
+			diff.TunnelsAdded = append(diff.TunnelsAdded, t.Name)
+		} else if tunnelChanged(cur, t) {
+			diff.TunnelsUpdated = append(diff.TunnelsUpdated, t.Name)
+		}
+	}
+	if !merge {
+		for name := range currentTunnels {
+			if _, ok := snapshotTunnels[name]; !ok {
+				diff.TunnelsRemoved = append(diff.TunnelsRemoved, name)
+			}
+		}
+	}
+
+	if dryRun || diff.empty() {
+		return diff, nil
+	}
+
+	if diff.DeviceChanged {
+		d := snapshot.Device
+		if err := b.UpsertDevice(d.Name, d.PrivateKey, d.PublicKey, d.ListenPort); err != nil {
+			return nil, fmt.Errorf("apply device: %w", err)
+		}
+	}
+	if diff.ServerConfigChanged {
+		if err := b.UpsertServerConfig(snapshot.ServerConfig); err != nil {
+			return nil, fmt.Errorf("apply server config: %w", err)
+		}
+	}
+
+	byPubKey := make(map[string]ClientRecord, len(snapshot.Clients))
+	for _, c := range snapshot.Clients {
+		byPubKey[c.PublicKey] = c
+	}
+	for _, pubKey := range diff.ClientsAdded {
+		rec := byPubKey[pubKey]
+		enabled := rec.Enabled // InsertClient sets rec.Enabled to true
+		if err := b.InsertClient(&rec); err != nil {
+			return nil, fmt.Errorf("apply client %s: %w", pubKey, err)
+		}
+		if !enabled {
+			_ = b.SetEnabled(pubKey, false)
+		}
+		if rec.Pinned {
+			_ = b.SetPinned(pubKey, true)
+		}
+	}
+	for _, pubKey := range diff.ClientsUpdated {
+		want := byPubKey[pubKey]
+		have := currentClients[pubKey]
+		if want.AllowedIP != have.AllowedIP || want.AllowedIPv6 != have.AllowedIPv6 || want.Keepalive != have.Keepalive {
+			if err := b.SetClientRouting(pubKey, want.AllowedIP, want.AllowedIPv6, want.Keepalive); err != nil {
+				return nil, fmt.Errorf("apply client %s routing: %w", pubKey, err)
+			}
+		}
+		if want.PresharedKey != have.PresharedKey {
+			if err := b.SetPresharedKey(pubKey, want.PresharedKey); err != nil {
+				return nil, fmt.Errorf("apply client %s psk: %w", pubKey, err)
+			}
+		}
+		if want.Enabled != have.Enabled {
+			if err := b.SetEnabled(pubKey, want.Enabled); err != nil {
+				return nil, fmt.Errorf("apply client %s enabled: %w", pubKey, err)
+			}
+		}
+		if want.Pinned != have.Pinned {
+			if err := b.SetPinned(pubKey, want.Pinned); err != nil {
+				return nil, fmt.Errorf("apply client %s pinned: %w", pubKey, err)
+			}
+		}
+	}
+	for _, pubKey := range diff.ClientsRemoved {
+		if err := b.DeleteClient(pubKey); err != nil {
+			return nil, fmt.Errorf("remove client %s: %w", pubKey, err)
+		}
+	}
+
+	byName := make(map[string]MultihopTunnel, len(snapshot.MultihopTunnels))
+	for _, t := range snapshot.MultihopTunnels {
+		byName[t.Name] = t
+	}
+	for _, name := range diff.TunnelsAdded {
+		t := byName[name]
+		if err := b.InsertMultihopTunnel(&t); err != nil {
+			return nil, fmt.Errorf("apply tunnel %s: %w", name, err)
+		}
+		if t.Enabled {
+			_ = b.SetMultihopEnabled(name, true)
+		}
+		if err := b.ReplaceMultihopPeers(t.ID, t.Peers); err != nil {
+			return nil, fmt.Errorf("apply tunnel %s peers: %w", name, err)
+		}
+	}
+	for _, name := range diff.TunnelsUpdated {
+		t := byName[name]
+		if err := b.UpdateMultihopTunnel(&t); err != nil {
+			return nil, fmt.Errorf("apply tunnel %s: %w", name, err)
+		}
+		if cur := currentTunnels[name]; cur.Enabled != t.Enabled {
+			_ = b.SetMultihopEnabled(name, t.Enabled)
+		}
+		if peersChanged(currentTunnels[name].Peers, t.Peers) {
+			if err := b.ReplaceMultihopPeers(currentTunnels[name].ID, t.Peers); err != nil {
+				return nil, fmt.Errorf("apply tunnel %s peers: %w", name, err)
+			}
+		}
+	}
+	for _, name := range diff.TunnelsRemoved {
+		if err := b.DeleteMultihopTunnel(name); err != nil {
+			return nil, fmt.Errorf("remove tunnel %s: %w", name, err)
+		}
+	}
+
+	return diff, nil
+}
+
+// clientChanged reports whether importing want over have would change
+// anything ApplyImport is able to write (routing, PSK, enabled, pinned).
+func clientChanged(have, want ClientRecord) bool {
+	return have.AllowedIP != want.AllowedIP || have.AllowedIPv6 != want.AllowedIPv6 ||
+		have.Keepalive != want.Keepalive || have.PresharedKey != want.PresharedKey ||
+		have.Enabled != want.Enabled || have.Pinned != want.Pinned
+}
+
+// tunnelChanged reports whether importing want over have would change any
+// of the fields UpdateMultihopTunnel/SetMultihopEnabled can write. Identity
+// fields (InterfaceName, ListenPort, PrivateKey/PublicKey) are set once at
+// creation and aren't compared: tunnels are matched by Name, so a change
+// to only those fields diffs as unchanged and is not applied by an import.
+func tunnelChanged(have, want MultihopTunnel) bool {
+	return have.RemoteEndpoint != want.RemoteEndpoint || have.RemotePublicKey != want.RemotePublicKey ||
+		have.RemotePresharedKey != want.RemotePresharedKey || have.RemoteAllowedIPs != want.RemoteAllowedIPs ||
+		have.RemoteKeepalive != want.RemoteKeepalive ||
+		have.Transport != want.Transport || have.RelayURL != want.RelayURL || have.RelayAuthSecret != want.RelayAuthSecret ||
+		have.FWMark != want.FWMark ||
+		have.RoutingTable != want.RoutingTable || have.RoutingTableID != want.RoutingTableID ||
+		have.Priority != want.Priority || have.Enabled != want.Enabled ||
+		peersChanged(have.Peers, want.Peers)
+}
+
+// peersChanged reports whether want's failover peer candidates differ from
+// have's, by identity and priority order — a shorter or longer list, a
+// different public key at some priority, or a changed endpoint/allowed-ips/
+// keepalive/PSK all count. Both are sorted by priority before comparing,
+// since want may come from a hand-edited import document.
+func peersChanged(have, want []MultihopPeer) bool {
+	if len(have) != len(want) {
+		return true
+	}
+	have = sortedMultihopPeers(have)
+	want = sortedMultihopPeers(want)
+	for i := range have {
+		h, w := have[i], want[i]
+		if h.PublicKey != w.PublicKey || h.Endpoint != w.Endpoint || h.AllowedIPs != w.AllowedIPs ||
+			h.PresharedKey != w.PresharedKey || h.Keepalive != w.Keepalive || h.Priority != w.Priority {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// peerHealthHistoryLimit bounds peer_health_history to roughly 24h of
+// samples at a 5-minute StatsSyncer interval.
+const peerHealthHistoryLimit = 288
+
+// PeerHealth is the latest computed connection-quality snapshot for a peer,
+// in the spirit of netbird's extended peer status output.
+type PeerHealth struct {
+	PeerID          int64  `json:"peer_id"`
+	Status          string `json:"status"` // connected / idle / stale / disconnected
+	HandshakeAgeSec *int64 `json:"handshake_age_sec,omitempty"`
+	RxBps           int64  `json:"rx_bps"`
+	TxBps           int64  `json:"tx_bps"`
+	EndpointChanges int64  `json:"endpoint_changes"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+// PeerHealthSample is one row of the peer_health_history ring.
+type PeerHealthSample struct {
+	Status          string `json:"status"`
+	HandshakeAgeSec *int64 `json:"handshake_age_sec,omitempty"`
+	RxBps           int64  `json:"rx_bps"`
+	TxBps           int64  `json:"tx_bps"`
+	SampledAt       int64  `json:"sampled_at"`
+}
+
+// PeerHealthReport bundles the current snapshot with its rolling history,
+// oldest sample first, for GetPeerHealthJSON.
+type PeerHealthReport struct {
+	PeerHealth
+	History []PeerHealthSample `json:"history"`
+}
+
+// UpsertPeerHealth records the latest computed health for a peer. When
+// endpointChanged is set, endpoint_changes is bumped rather than overwritten.
+func (b *BridgeDB) UpsertPeerHealth(pubKey, status string, handshakeAge *int64, rxBps, txBps int64, endpointChanged bool) error {
+	var bump int64
+	if endpointChanged {
+		bump = 1
+	}
+	_, err := b.db.Exec(b.rebind(`
+		INSERT INTO peer_health (peer_id, status, handshake_age_sec, rx_bps, tx_bps, endpoint_changes, updated_at)
+		SELECT id, ?, ?, ?, ?, ?, ? FROM peers WHERE public_key = ?
+		ON CONFLICT (peer_id) DO UPDATE SET
+			status = excluded.status,
+			handshake_age_sec = excluded.handshake_age_sec,
+			rx_bps = excluded.rx_bps,
+			tx_bps = excluded.tx_bps,
+			endpoint_changes = peer_health.endpoint_changes + ?,
+			updated_at = excluded.updated_at`),
+		status, handshakeAge, rxBps, txBps, bump, time.Now().Unix(), pubKey, bump)
+	return err
+}
+
+// AppendPeerHealthHistory appends one sample to peer_health_history and
+// prunes rows beyond peerHealthHistoryLimit for that peer.
+func (b *BridgeDB) AppendPeerHealthHistory(pubKey, status string, handshakeAge *int64, rxBps, txBps int64) error {
+	var peerID int64
+	row := b.db.QueryRow(b.rebind("SELECT id FROM peers WHERE public_key = ?"), pubKey)
+	if err := row.Scan(&peerID); err != nil {
+		return err
+	}
+
+	if _, err := b.db.Exec(b.rebind(`
+		INSERT INTO peer_health_history (peer_id, status, handshake_age_sec, rx_bps, tx_bps, sampled_at)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		peerID, status, handshakeAge, rxBps, txBps, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	_, err := b.db.Exec(b.rebind(`
+		DELETE FROM peer_health_history WHERE peer_id = ? AND id NOT IN (
+			SELECT id FROM peer_health_history WHERE peer_id = ? ORDER BY sampled_at DESC LIMIT ?)`),
+		peerID, peerID, peerHealthHistoryLimit)
+	return err
+}
+
+// GetPeerHealth returns a peer's current health snapshot plus its rolling
+// history, oldest sample first.
+func (b *BridgeDB) GetPeerHealth(pubKey string) (*PeerHealthReport, error) {
+	row := b.db.QueryRow(b.rebind(`
+		SELECT ph.peer_id, ph.status, ph.handshake_age_sec, ph.rx_bps, ph.tx_bps, ph.endpoint_changes, ph.updated_at
+		FROM peer_health ph JOIN peers p ON p.id = ph.peer_id
+		WHERE p.public_key = ?`), pubKey)
+
+	var h PeerHealth
+	var handshakeAge sql.NullInt64
+	if err := row.Scan(&h.PeerID, &h.Status, &handshakeAge, &h.RxBps, &h.TxBps, &h.EndpointChanges, &h.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if handshakeAge.Valid {
+		v := handshakeAge.Int64
+		h.HandshakeAgeSec = &v
+	}
+
+	rows, err := b.db.Query(b.rebind(`
+		SELECT status, handshake_age_sec, rx_bps, tx_bps, sampled_at
+		FROM peer_health_history WHERE peer_id = ? ORDER BY sampled_at DESC LIMIT ?`), h.PeerID, peerHealthHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var history []PeerHealthSample
+	for rows.Next() {
+		var s PeerHealthSample
+		var age sql.NullInt64
+		if err := rows.Scan(&s.Status, &age, &s.RxBps, &s.TxBps, &s.SampledAt); err != nil {
+			return nil, err
+		}
+		if age.Valid {
+			v := age.Int64
+			s.HandshakeAgeSec = &v
+		}
+		history = append(history, s)
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return &PeerHealthReport{PeerHealth: h, History: history}, nil
+}
+
+// ToJSON marshals the report to a JSON string.
+func (r *PeerHealthReport) ToJSON() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+)
+
+// v6RangeBounds returns the first and last usable address of networkV6,
+// skipping :: (network) and ::1 (gateway) the same way the v4 pool skips
+// .0/.1. Unlike the v4 pool, these bounds are only ever stored as a range
+// row — see allocateV6IP for why nothing in between gets materialized.
+func v6RangeBounds(networkV6 string) (start, end net.IP, err error) {
+	_, ipNet, err := net.ParseCIDR(networkV6)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse cidr: %w", err)
+	}
+	base := ipNet.IP.To16()
+	if base == nil {
+		return nil, nil, fmt.Errorf("not an IPv6 cidr: %s", networkV6)
+	}
+
+	startInt := new(big.Int).SetBytes(base)
+	startInt.Add(startInt, big.NewInt(2)) // skip :: and ::1
+
+	ones, bits := ipNet.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	endInt := new(big.Int).Add(new(big.Int).SetBytes(base), size)
+	endInt.Sub(endInt, big.NewInt(1))
+
+	return bigToIP(startInt), bigToIP(endInt), nil
+}
+
+func bigToIP(n *big.Int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, 16)
+	copy(ip[16-len(b):], b)
+	return ip
+}
+
+// ipv6PoolMu serializes allocateV6IP's read-hash-probe-write sequence.
+// sql.DB transactions alone don't prevent two concurrent callers from
+// hashing to the same candidate and both probing past it before either
+// commits; a process-local mutex is simpler than relying on the backend's
+// isolation level to catch that.
+var ipv6PoolMu sync.Mutex
+
+// maxV6ProbeAttempts bounds allocateV6IP's linear probe. A /64 pool is
+// 2^64 addresses, so probing "until size" is effectively unbounded once
+// the pool has enough assigned rows (deliberately or otherwise, e.g. via
+// mesh-synced ApplyRemoteChange rows) to make collisions common — and the
+// whole loop runs under ipv6PoolMu, so an unbounded probe there hangs
+// every other v6 allocation in the process, not just this caller's. A
+// pool that's actually collided this many times in a row is for all
+// practical purposes exhausted.
+const maxV6ProbeAttempts = 4096
+
+// allocateV6IP picks an address for peerID out of the range(s) recorded in
+// ip_pool_v6_ranges by InitIPPool, without ever materializing the range
+// the way expandSubnet does for v4 — a /64 is 2^64 addresses, so "insert a
+// row per address" isn't an option. Candidates are chosen by hashing
+// peerID into the range (so repeated allocation attempts for the same
+// peer within one process start from the same candidate; the hash seed
+// is per process, see v6PoolKey0) and linearly
+// probing forward on collision, matching the "sequential-from-cursor on
+// collision" fallback a hash-keyed allocator needs to still terminate.
+func (b *BridgeDB) allocateV6IP(peerID int64) (string, error) {
+	ipv6PoolMu.Lock()
+	defer ipv6PoolMu.Unlock()
+
+	var startStr, endStr string
+	err := b.db.QueryRow(b.rebind("SELECT start, end FROM ip_pool_v6_ranges WHERE family = 6 LIMIT 1")).Scan(&startStr, &endStr)
+	if err != nil {
+		return "", fmt.Errorf("no ipv6 pool configured: %w", err)
+	}
+	start := net.ParseIP(startStr).To16()
+	end := net.ParseIP(endStr).To16()
+	if start == nil || end == nil {
+		return "", fmt.Errorf("corrupt ipv6 range row")
+	}
+
+	startInt := new(big.Int).SetBytes(start)
+	endInt := new(big.Int).SetBytes(end)
+	size := new(big.Int).Sub(endInt, startInt)
+	size.Add(size, big.NewInt(1))
+	if size.Sign() <= 0 {
+		return "", fmt.Errorf("ipv6 pool range is empty")
+	}
+
+	offset := new(big.Int).SetUint64(sipHash24(v6PoolKey0, v6PoolKey1, peerIDBytes(peerID)))
+	offset.Mod(offset, size)
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	maxTries := big.NewInt(maxV6ProbeAttempts)
+	if size.Cmp(maxTries) < 0 {
+		maxTries = size
+	}
+
+	pos := new(big.Int).Set(offset) // 0 <= pos < size
+	one := big.NewInt(1)
+	for tries := new(big.Int); tries.Cmp(maxTries) < 0; tries.Add(tries, one) {
+		candidate := new(big.Int).Add(startInt, pos)
+		ip := bigToIP(candidate).String()
+
+		var exists int
+		err := tx.QueryRow(b.rebind("SELECT COUNT(*) FROM ip_pool_v6_assigned WHERE ip = ?"), ip).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if exists == 0 {
+			if _, err := tx.Exec(b.rebind("INSERT INTO ip_pool_v6_assigned (ip, peer_id) VALUES (?, ?)"), ip, peerID); err != nil {
+				return "", err
+			}
+			if err := tx.Commit(); err != nil {
+				return "", err
+			}
+			cidr := ip + "/128"
+			_ = b.allowedIPs.insert(cidr, peerID)
+			return cidr, nil
+		}
+
+		pos.Add(pos, one) // linear probe past the collision
+		if pos.Cmp(size) >= 0 {
+			pos.SetInt64(0) // wrap the probe back to the start of the range
+		}
+	}
+	return "", fmt.Errorf("ipv6 pool exhausted")
+}
+
+func peerIDBytes(peerID int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(peerID))
+	return b[:]
+}
+
+// v6PoolKey0/v6PoolKey1 seed sipHash24's allocation hash. They only need to
+// spread candidates across the pool, not resist an adversary who already
+// has write access to bridge-db, so a process-lifetime random seed (rather
+// than a persisted one) is enough — it just means the peer-to-address
+// mapping isn't stable across restarts, which AllocateIP never promised.
+var v6PoolKey0, v6PoolKey1 = randSeed(), randSeed()
+
+func randSeed() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0x9ae16a3b2f90404f // fixed fallback, still spreads hash output fine
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// sipHash24 is a standard SipHash-2-4 (Aumasson & Bernstein), used here
+// purely as a fast, well-distributed keyed hash for picking a pool offset
+// — not for anything cryptographically load-bearing.
+func sipHash24(k0, k1 uint64, data []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = v1<<13 | v1>>51
+		v1 ^= v0
+		v0 = v0<<32 | v0>>32
+		v2 += v3
+		v3 = v3<<16 | v3>>48
+		v3 ^= v2
+		v0 += v3
+		v3 = v3<<21 | v3>>43
+		v3 ^= v0
+		v2 += v1
+		v1 = v1<<17 | v1>>47
+		v1 ^= v2
+		v2 = v2<<32 | v2>>32
+	}
+
+	length := len(data)
+	end := length - (length % 8)
+	for i := 0; i < end; i += 8 {
+		m := binary.LittleEndian.Uint64(data[i : i+8])
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+
+	var last [8]byte
+	copy(last[:], data[end:])
+	last[7] = byte(length)
+	m := binary.LittleEndian.Uint64(last[:])
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
@@ -30,6 +30,17 @@ type MultihopTunnel struct {
 	RemoteAllowedIPs   string `json:"remote_allowed_ips"`   // '0.0.0.0/0'
 	RemoteKeepalive    int    `json:"remote_keepalive"`     // 25
 
+	// Transport — how this tunnel reaches RemoteEndpoint. "udp" (default)
+	// dials it directly; "wss" tunnels over a relay instead, for when UDP
+	// to RemoteEndpoint is blocked (see relayBind, multihop_relay_bind.go).
+	// RelayAuthSecret is the shared HMAC secret relayBind's HELLO frame is
+	// built from — serialized to JSON like PrivateKey and
+	// RemotePresharedKey above, for the same reason: this API has no
+	// separate secrets endpoint.
+	Transport       string `json:"transport"`           // 'udp', 'wss'
+	RelayURL        string `json:"relay_url,omitempty"` // 'wss://relay.example.com/hop0'
+	RelayAuthSecret string `json:"relay_auth_secret,omitempty"`
+
 	// Policy routing
 	FWMark         int    `json:"fwmark"`           // SO_MARK on this tunnel's socket
 	RoutingTable   string `json:"routing_table"`    // 'phantom_multihop'
@@ -37,10 +48,36 @@ type MultihopTunnel struct {
 	Priority       int    `json:"priority"`         // ip rule priority
 
 	// Runtime state (ephemeral)
-	Status    string `json:"status"`               // 'running', 'stopped', 'error'
+	Status    string `json:"status"` // 'running', 'stopped', 'error'
 	ErrorMsg  string `json:"error_msg,omitempty"`
 	StartedAt *int64 `json:"started_at,omitempty"`
 	CreatedAt int64  `json:"created_at"`
+
+	// Upstream link stats, polled via MultihopStatsSyncer.
+	RxBytes       int64  `json:"rx_bytes"`
+	TxBytes       int64  `json:"tx_bytes"`
+	LastHandshake *int64 `json:"last_handshake,omitempty"`
+
+	// DiscoveredMTU is the last PMTU the probe in multihopMTUProber settled
+	// on for this hop's TUN, or nil if it hasn't probed yet.
+	DiscoveredMTU *int `json:"discovered_mtu,omitempty"`
+
+	// Out-of-band pong health check, see multihop_pong.go. PongPort = 0
+	// means the feature is off for this hop; PongIntervalSec = 0 falls
+	// back to multihopPongDefaultInterval. PongLastOKAt is the last time
+	// the poller got a verified response, for an operator to see how
+	// stale a hop's health signal is without waiting on the next tick.
+	PongPort        int    `json:"pong_port,omitempty"`
+	PongIntervalSec int    `json:"pong_interval_sec,omitempty"`
+	PongLastOKAt    *int64 `json:"pong_last_ok_at,omitempty"`
+
+	// Peers lists this hop's upstream candidates, ordered by Priority
+	// (most preferred first), for endpoint failover — see MultihopPeer.
+	// Empty for a tunnel that's never had more than the one upstream in
+	// Remote*; startMultihopDevice falls back to treating Remote* as a
+	// single-candidate list in that case. Loaded separately from
+	// multihop_peers by loadMultihopPeers, not a column on this table.
+	Peers []MultihopPeer `json:"peers,omitempty"`
 }
 
 // --- CRUD ---
@@ -49,38 +86,38 @@ type MultihopTunnel struct {
 func (b *BridgeDB) InsertMultihopTunnel(t *MultihopTunnel) error {
 	t.CreatedAt = time.Now().Unix()
 	t.Status = "stopped"
-	result, err := b.db.Exec(`
-		INSERT INTO multihop_tunnels
-			(name, enabled, interface_name, listen_port, private_key, public_key,
-			 remote_endpoint, remote_public_key, remote_preshared_key, remote_allowed_ips, remote_keepalive,
-			 fwmark, routing_table, routing_table_id, priority,
-			 status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		t.Name, boolToInt(t.Enabled), t.InterfaceName, t.ListenPort, t.PrivateKey, t.PublicKey,
-		t.RemoteEndpoint, t.RemotePublicKey, t.RemotePresharedKey, t.RemoteAllowedIPs, t.RemoteKeepalive,
-		t.FWMark, t.RoutingTable, t.RoutingTableID, t.Priority,
-		t.Status, t.CreatedAt)
+	id, err := b.backend.InsertMultihopTunnel(b.db, t)
 	if err != nil {
 		return err
 	}
-	t.ID, _ = result.LastInsertId()
+	t.ID = id
 	return nil
 }
 
 // GetMultihopTunnel retrieves a tunnel by name.
 func (b *BridgeDB) GetMultihopTunnel(name string) (*MultihopTunnel, error) {
-	row := b.db.QueryRow(`
+	row := b.db.QueryRow(b.rebind(`
 		SELECT id, name, enabled, interface_name, listen_port, private_key, public_key,
 		       remote_endpoint, remote_public_key, remote_preshared_key, remote_allowed_ips, remote_keepalive,
+		       transport, relay_url, relay_auth_secret,
 		       fwmark, routing_table, routing_table_id, priority,
-		       status, error_msg, started_at, created_at
-		FROM multihop_tunnels WHERE name = ?`, name)
-	return scanMultihopTunnel(row)
+		       status, error_msg, started_at, created_at,
+		       rx_bytes, tx_bytes, last_handshake, discovered_mtu,
+		       pong_port, pong_interval_sec, pong_last_ok_at
+		FROM multihop_tunnels WHERE name = ?`), name)
+	t, err := scanMultihopTunnel(row)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.loadMultihopPeers(t); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
 // DeleteMultihopTunnel removes a tunnel by name.
 func (b *BridgeDB) DeleteMultihopTunnel(name string) error {
-	result, err := b.db.Exec("DELETE FROM multihop_tunnels WHERE name = ?", name)
+	result, err := b.db.Exec(b.rebind("DELETE FROM multihop_tunnels WHERE name = ?"), name)
 	if err != nil {
 		return err
 	}
@@ -96,8 +133,11 @@ func (b *BridgeDB) ListMultihopTunnels() ([]MultihopTunnel, error) {
 	rows, err := b.db.Query(`
 		SELECT id, name, enabled, interface_name, listen_port, private_key, public_key,
 		       remote_endpoint, remote_public_key, remote_preshared_key, remote_allowed_ips, remote_keepalive,
+		       transport, relay_url, relay_auth_secret,
 		       fwmark, routing_table, routing_table_id, priority,
-		       status, error_msg, started_at, created_at
+		       status, error_msg, started_at, created_at,
+		       rx_bytes, tx_bytes, last_handshake, discovered_mtu,
+		       pong_port, pong_interval_sec, pong_last_ok_at
 		FROM multihop_tunnels ORDER BY id`)
 	if err != nil {
 		return nil, err
@@ -110,6 +150,9 @@ func (b *BridgeDB) ListMultihopTunnels() ([]MultihopTunnel, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := b.loadMultihopPeers(t); err != nil {
+			return nil, err
+		}
 		tunnels = append(tunnels, *t)
 	}
 	return tunnels, nil
@@ -117,12 +160,15 @@ func (b *BridgeDB) ListMultihopTunnels() ([]MultihopTunnel, error) {
 
 // EnabledMultihopTunnels returns tunnels with enabled=1 for crash recovery.
 func (b *BridgeDB) EnabledMultihopTunnels() ([]MultihopTunnel, error) {
-	rows, err := b.db.Query(`
+	rows, err := b.db.Query(b.rebind(`
 		SELECT id, name, enabled, interface_name, listen_port, private_key, public_key,
 		       remote_endpoint, remote_public_key, remote_preshared_key, remote_allowed_ips, remote_keepalive,
+		       transport, relay_url, relay_auth_secret,
 		       fwmark, routing_table, routing_table_id, priority,
-		       status, error_msg, started_at, created_at
-		FROM multihop_tunnels WHERE enabled = 1 ORDER BY priority`)
+		       status, error_msg, started_at, created_at,
+		       rx_bytes, tx_bytes, last_handshake, discovered_mtu,
+		       pong_port, pong_interval_sec, pong_last_ok_at
+		FROM multihop_tunnels WHERE enabled = 1 ORDER BY priority`))
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +180,9 @@ func (b *BridgeDB) EnabledMultihopTunnels() ([]MultihopTunnel, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := b.loadMultihopPeers(t); err != nil {
+			return nil, err
+		}
 		tunnels = append(tunnels, *t)
 	}
 	return tunnels, nil
@@ -143,7 +192,7 @@ func (b *BridgeDB) EnabledMultihopTunnels() ([]MultihopTunnel, error) {
 
 // SetMultihopEnabled sets the enabled (crash recovery) flag.
 func (b *BridgeDB) SetMultihopEnabled(name string, enabled bool) error {
-	result, err := b.db.Exec("UPDATE multihop_tunnels SET enabled = ? WHERE name = ?", boolToInt(enabled), name)
+	result, err := b.db.Exec(b.rebind("UPDATE multihop_tunnels SET enabled = ? WHERE name = ?"), enabled, name)
 	if err != nil {
 		return err
 	}
@@ -156,9 +205,9 @@ func (b *BridgeDB) SetMultihopEnabled(name string, enabled bool) error {
 
 // SetMultihopStatus updates runtime status (running/stopped/error).
 func (b *BridgeDB) SetMultihopStatus(name, status, errorMsg string, startedAt *int64) error {
-	_, err := b.db.Exec(`
+	_, err := b.db.Exec(b.rebind(`
 		UPDATE multihop_tunnels SET status = ?, error_msg = ?, started_at = ?
-		WHERE name = ?`, status, errorMsg, startedAt, name)
+		WHERE name = ?`), status, errorMsg, startedAt, name)
 	return err
 }
 
@@ -170,14 +219,16 @@ func (b *BridgeDB) ClearMultihopRuntimeState() error {
 
 // UpdateMultihopTunnel updates connection details for an existing tunnel.
 func (b *BridgeDB) UpdateMultihopTunnel(t *MultihopTunnel) error {
-	result, err := b.db.Exec(`
+	result, err := b.db.Exec(b.rebind(`
 		UPDATE multihop_tunnels SET
 			remote_endpoint = ?, remote_public_key = ?, remote_preshared_key = ?,
 			remote_allowed_ips = ?, remote_keepalive = ?,
+			transport = ?, relay_url = ?, relay_auth_secret = ?,
 			fwmark = ?, routing_table = ?, routing_table_id = ?, priority = ?
-		WHERE name = ?`,
+		WHERE name = ?`),
 		t.RemoteEndpoint, t.RemotePublicKey, t.RemotePresharedKey,
 		t.RemoteAllowedIPs, t.RemoteKeepalive,
+		t.Transport, nullStr(t.RelayURL), nullStr(t.RelayAuthSecret),
 		t.FWMark, t.RoutingTable, t.RoutingTableID, t.Priority,
 		t.Name)
 	if err != nil {
@@ -190,6 +241,58 @@ func (b *BridgeDB) UpdateMultihopTunnel(t *MultihopTunnel) error {
 	return nil
 }
 
+// UpdateMultihopStats updates the upstream link stats for a tunnel, polled
+// from the tunnel device's own IpcGet by MultihopStatsSyncer.
+func (b *BridgeDB) UpdateMultihopStats(name string, lastHandshake *int64, rxBytes, txBytes int64) error {
+	_, err := b.db.Exec(b.rebind(`
+		UPDATE multihop_tunnels SET last_handshake = ?, rx_bytes = ?, tx_bytes = ?
+		WHERE name = ?`), lastHandshake, rxBytes, txBytes, name)
+	return err
+}
+
+// SetMultihopDiscoveredMTU records the PMTU multihopMTUProber settled on for
+// a hop, so it survives a daemon restart instead of re-probing from scratch.
+func (b *BridgeDB) SetMultihopDiscoveredMTU(name string, mtu int) error {
+	_, err := b.db.Exec(b.rebind(`
+		UPDATE multihop_tunnels SET discovered_mtu = ? WHERE name = ?`), mtu, name)
+	return err
+}
+
+// SetMultihopPongConfig configures name's out-of-band pong health check
+// (see multihop_pong.go). port = 0 turns the feature off. Callers still
+// need to restart the tunnel's device for a running hop to pick up the
+// change, same as SetMultihopRelay.
+func (b *BridgeDB) SetMultihopPongConfig(name string, port, intervalSec int) error {
+	_, err := b.db.Exec(b.rebind(`
+		UPDATE multihop_tunnels SET pong_port = ?, pong_interval_sec = ?
+		WHERE name = ?`), port, intervalSec, name)
+	return err
+}
+
+// SetMultihopPongLastOK records the last time name's pong poller got a
+// verified response, so MultihopChainHealth can report how stale a hop's
+// health signal is across a daemon restart.
+func (b *BridgeDB) SetMultihopPongLastOK(name string, ts int64) error {
+	_, err := b.db.Exec(b.rebind(`
+		UPDATE multihop_tunnels SET pong_last_ok_at = ? WHERE name = ?`), ts, name)
+	return err
+}
+
+// SetMultihopRelay configures name's transport to tunnel over a WSS relay
+// (relayURL non-empty) or clears it back to plain UDP (relayURL empty) —
+// see relayBind, multihop_relay_bind.go. Callers still need to restart the
+// tunnel's device for a running hop to pick up the change.
+func (b *BridgeDB) SetMultihopRelay(name, relayURL, authSecret string) error {
+	transport := "udp"
+	if relayURL != "" {
+		transport = "wss"
+	}
+	_, err := b.db.Exec(b.rebind(`
+		UPDATE multihop_tunnels SET transport = ?, relay_url = ?, relay_auth_secret = ?
+		WHERE name = ?`), transport, nullStr(relayURL), nullStr(authSecret), name)
+	return err
+}
+
 // --- JSON ---
 
 func (t *MultihopTunnel) ToJSON() string {
@@ -214,17 +317,30 @@ func boolToInt(b bool) int {
 	return 0
 }
 
+// multihopTransportOrDefault returns t's transport, defaulting to "udp" for
+// callers (e.g. CreateMultihopTunnel) that build a MultihopTunnel without
+// setting Transport explicitly.
+func multihopTransportOrDefault(transport string) string {
+	if transport == "" {
+		return "udp"
+	}
+	return transport
+}
+
 func scanMultihopTunnel(s scanner) (*MultihopTunnel, error) {
 	var t MultihopTunnel
 	var enabled int
-	var remotePSK, errorMsg sql.NullString
-	var startedAt sql.NullInt64
+	var remotePSK, errorMsg, relayURL, relayAuthSecret sql.NullString
+	var startedAt, lastHandshake, discoveredMTU, pongLastOKAt sql.NullInt64
 
 	if err := s.Scan(
 		&t.ID, &t.Name, &enabled, &t.InterfaceName, &t.ListenPort, &t.PrivateKey, &t.PublicKey,
 		&t.RemoteEndpoint, &t.RemotePublicKey, &remotePSK, &t.RemoteAllowedIPs, &t.RemoteKeepalive,
+		&t.Transport, &relayURL, &relayAuthSecret,
 		&t.FWMark, &t.RoutingTable, &t.RoutingTableID, &t.Priority,
 		&t.Status, &errorMsg, &startedAt, &t.CreatedAt,
+		&t.RxBytes, &t.TxBytes, &lastHandshake, &discoveredMTU,
+		&t.PongPort, &t.PongIntervalSec, &pongLastOKAt,
 	); err != nil {
 		return nil, fmt.Errorf("scan multihop: %w", err)
 	}
@@ -232,6 +348,12 @@ func scanMultihopTunnel(s scanner) (*MultihopTunnel, error) {
 	if remotePSK.Valid {
 		t.RemotePresharedKey = remotePSK.String
 	}
+	if relayURL.Valid {
+		t.RelayURL = relayURL.String
+	}
+	if relayAuthSecret.Valid {
+		t.RelayAuthSecret = relayAuthSecret.String
+	}
 	if errorMsg.Valid {
 		t.ErrorMsg = errorMsg.String
 	}
@@ -239,5 +361,17 @@ func scanMultihopTunnel(s scanner) (*MultihopTunnel, error) {
 		v := startedAt.Int64
 		t.StartedAt = &v
 	}
+	if lastHandshake.Valid {
+		v := lastHandshake.Int64
+		t.LastHandshake = &v
+	}
+	if discoveredMTU.Valid {
+		v := int(discoveredMTU.Int64)
+		t.DiscoveredMTU = &v
+	}
+	if pongLastOKAt.Valid {
+		v := pongLastOKAt.Int64
+		t.PongLastOKAt = &v
+	}
 	return &t, nil
 }
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// MultihopPeer is one candidate upstream for a multihop hop — a tunnel can
+// have several, ordered by Priority (lower is preferred), so a failed exit
+// relay can be swapped for the next one without tearing down the tun
+// device. See bridge.startMultihopDevice and the failover selector in
+// bridge/multihop_failover.go.
+type MultihopPeer struct {
+	ID           int64  `json:"id"`
+	TunnelID     int64  `json:"tunnel_id"`
+	PublicKey    string `json:"public_key"`
+	Endpoint     string `json:"endpoint"`
+	AllowedIPs   string `json:"allowed_ips"`
+	PresharedKey string `json:"preshared_key,omitempty"`
+	Keepalive    int    `json:"keepalive"`
+	Priority     int    `json:"priority"`
+}
+
+// ListMultihopPeers returns tunnelID's peer candidates ordered by priority
+// (most preferred first).
+func (b *BridgeDB) ListMultihopPeers(tunnelID int64) ([]MultihopPeer, error) {
+	rows, err := b.db.Query(b.rebind(`
+		SELECT id, tunnel_id, public_key, endpoint, allowed_ips, preshared_key, keepalive, priority
+		FROM multihop_peers WHERE tunnel_id = ? ORDER BY priority`), tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var peers []MultihopPeer
+	for rows.Next() {
+		var p MultihopPeer
+		var psk sql.NullString
+		if err := rows.Scan(&p.ID, &p.TunnelID, &p.PublicKey, &p.Endpoint, &p.AllowedIPs, &psk, &p.Keepalive, &p.Priority); err != nil {
+			return nil, err
+		}
+		if psk.Valid {
+			p.PresharedKey = psk.String
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// ReplaceMultihopPeers replaces tunnelID's entire peer candidate list in
+// one pass — there's no partial-update case for this set (it's edited as a
+// whole failover list, not one peer at a time), so delete-then-reinsert is
+// simpler than diffing old against new like ApplyImport does for clients.
+func (b *BridgeDB) ReplaceMultihopPeers(tunnelID int64, peers []MultihopPeer) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(b.rebind("DELETE FROM multihop_peers WHERE tunnel_id = ?"), tunnelID); err != nil {
+		return err
+	}
+	for _, p := range peers {
+		if _, err := tx.Exec(b.rebind(`
+			INSERT INTO multihop_peers (tunnel_id, public_key, endpoint, allowed_ips, preshared_key, keepalive, priority)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			tunnelID, p.PublicKey, p.Endpoint, p.AllowedIPs, p.PresharedKey, p.Keepalive, p.Priority); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// loadMultihopPeers fills t.Peers from multihop_peers, sorted by priority.
+// Called after every scanMultihopTunnel so callers never have to remember
+// to join the two tables themselves.
+func (b *BridgeDB) loadMultihopPeers(t *MultihopTunnel) error {
+	peers, err := b.ListMultihopPeers(t.ID)
+	if err != nil {
+		return err
+	}
+	t.Peers = sortedMultihopPeers(peers)
+	return nil
+}
+
+// sortedMultihopPeers returns peers ordered by Priority (most preferred
+// first) without modifying the input slice.
+func sortedMultihopPeers(peers []MultihopPeer) []MultihopPeer {
+	out := make([]MultihopPeer, len(peers))
+	copy(out, peers)
+	sort.Slice(out, func(i, j int) bool { return out[i].Priority < out[j].Priority })
+	return out
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MultihopStatsSyncer periodically polls each active multihop tunnel's own
+// WireGuard device via IpcGet and persists its upstream rx/tx/last_handshake,
+// mirroring StatsSyncer for the client-mode devices multihop tunnels use.
+type MultihopStatsSyncer struct {
+	db       *BridgeDB
+	listFn   func() map[string]func() (string, error) // tunnel name -> IpcGet
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewMultihopStatsSyncer creates a multihop stats syncer. listFn is called
+// on every tick and should return the IpcGet function for each currently
+// running tunnel, keyed by tunnel name.
+func NewMultihopStatsSyncer(db *BridgeDB, listFn func() map[string]func() (string, error), intervalSec int) *MultihopStatsSyncer {
+	return &MultihopStatsSyncer{
+		db:       db,
+		listFn:   listFn,
+		interval: time.Duration(intervalSec) * time.Second,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins the background sync goroutine.
+func (s *MultihopStatsSyncer) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.syncOnce()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the background sync goroutine and waits for it to finish.
+func (s *MultihopStatsSyncer) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *MultihopStatsSyncer) syncOnce() {
+	for name, ipcGetFn := range s.listFn() {
+		output, err := ipcGetFn()
+		if err != nil {
+			continue
+		}
+		lastHandshake, rxBytes, txBytes := parseSinglePeerStats(output)
+		_ = s.db.UpdateMultihopStats(name, lastHandshake, rxBytes, txBytes)
+	}
+}
+
+// parseSinglePeerStats extracts last_handshake_time_sec/rx_bytes/tx_bytes
+// from a multihop device's IpcGet output. That output carries one peer
+// block per upstream candidate (the active one plus any failover
+// standbys), so rx/tx are summed over all of them and the most recent
+// handshake among them is reported.
+func parseSinglePeerStats(output string) (lastHandshake *int64, rxBytes, txBytes int64) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := parts[0], parts[1]
+		switch key {
+		case "last_handshake_time_sec":
+			if v, err := strconv.ParseInt(val, 10, 64); err == nil && v > 0 && (lastHandshake == nil || v > *lastHandshake) {
+				lastHandshake = &v
+			}
+		case "rx_bytes":
+			v, _ := strconv.ParseInt(val, 10, 64)
+			rxBytes += v
+		case "tx_bytes":
+			v, _ := strconv.ParseInt(val, 10, 64)
+			txBytes += v
+		}
+	}
+	return lastHandshake, rxBytes, txBytes
+}
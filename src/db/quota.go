@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Quota actions, stored verbatim in peers.quota_action.
+const (
+	QuotaActionDisable  = "disable"
+	QuotaActionThrottle = "throttle"
+	QuotaActionNotify   = "notify"
+)
+
+// quotaResetCheckInterval is how often StartQuotaResetter polls for peers
+// whose quota window has elapsed. Quota periods are measured in whole
+// seconds, so a minute of slop before a counter resets is unremarkable.
+const quotaResetCheckInterval = 1 * time.Minute
+
+// SetQuota configures or clears a peer's bandwidth quota. bytes <= 0
+// disables quota enforcement for this peer entirely. action must be one of
+// QuotaActionDisable/QuotaActionThrottle/QuotaActionNotify. The peer's
+// current rx_bytes/tx_bytes become its quota baseline, so usage is counted
+// from here forward rather than including whatever this peer already
+// transferred before the quota was configured — see checkQuota.
+func (b *BridgeDB) SetQuota(pubKey string, bytes int64, periodSec int, action string) error {
+	switch action {
+	case QuotaActionDisable, QuotaActionThrottle, QuotaActionNotify:
+	default:
+		return fmt.Errorf("invalid quota action %q", action)
+	}
+	if periodSec <= 0 {
+		return fmt.Errorf("quota period must be positive")
+	}
+
+	resetAt := time.Now().Unix() + int64(periodSec)
+	result, err := b.db.Exec(b.rebind(`
+		UPDATE peers SET quota_bytes = ?, quota_period_sec = ?, quota_reset_at = ?, quota_action = ?,
+			quota_baseline_rx_bytes = rx_bytes, quota_baseline_tx_bytes = tx_bytes
+		WHERE public_key = ?`),
+		bytes, periodSec, resetAt, action, pubKey)
+	if err != nil {
+		return err
+	}
+	n, _ := result.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	b.quotaMu.Lock()
+	delete(b.quotaNotified, pubKey)
+	b.quotaMu.Unlock()
+	return nil
+}
+
+// QuotaStatus is the gauge view of a peer's quota for a management UI.
+type QuotaStatus struct {
+	PublicKey      string `json:"public_key"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	BytesUsed      int64  `json:"bytes_used"`
+	BytesRemaining int64  `json:"bytes_remaining"`
+	PeriodSec      int    `json:"quota_period_sec"`
+	ResetsAt       *int64 `json:"resets_at,omitempty"`
+	Action         string `json:"quota_action"`
+}
+
+// GetQuotaStatus reports a peer's current usage against its configured
+// quota. QuotaBytes == 0 means no quota is configured for this peer.
+func (b *BridgeDB) GetQuotaStatus(pubKey string) (*QuotaStatus, error) {
+	c, err := b.GetClient(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaStatus{
+		PublicKey:      c.PublicKey,
+		QuotaBytes:     c.QuotaBytes,
+		BytesUsed:      c.BytesUsed,
+		BytesRemaining: c.BytesRemaining,
+		PeriodSec:      c.QuotaPeriodSec,
+		ResetsAt:       c.ResetsAt,
+		Action:         c.QuotaAction,
+	}, nil
+}
+
+// checkQuota compares a peer's new rx+tx totals, less its quota baseline
+// (see SetQuota/resetExpiredQuotas), against its configured quota and, on
+// the first tick that crosses the limit within a window, runs the
+// configured action and records a quota_events audit row. Later ticks in
+// the same window are no-ops (via quotaNotified) so a peer sitting over
+// quota doesn't re-disable itself or flood quota_events every stats tick.
+// Returns a PeerEvent for the caller to publish on breach, or nil if the
+// peer has no quota configured or is still under it.
+func (b *BridgeDB) checkQuota(pubKey string, rxBytes, txBytes int64) (*PeerEvent, error) {
+	var peerID, quotaBytes, baselineRx, baselineTx int64
+	var action string
+	err := b.db.QueryRow(b.rebind(
+		"SELECT id, quota_bytes, quota_action, quota_baseline_rx_bytes, quota_baseline_tx_bytes FROM peers WHERE public_key = ?"), pubKey,
+	).Scan(&peerID, &quotaBytes, &action, &baselineRx, &baselineTx)
+	if err != nil {
+		return nil, nil // unknown peer or no row — nothing to enforce
+	}
+	if quotaBytes <= 0 {
+		return nil, nil
+	}
+
+	used := (rxBytes - baselineRx) + (txBytes - baselineTx)
+	if used < 0 {
+		used = 0 // device counters reset (peer re-added) below the baseline
+	}
+	if used < quotaBytes {
+		b.quotaMu.Lock()
+		delete(b.quotaNotified, pubKey)
+		b.quotaMu.Unlock()
+		return nil, nil
+	}
+
+	b.quotaMu.Lock()
+	if b.quotaNotified[pubKey] {
+		b.quotaMu.Unlock()
+		return nil, nil
+	}
+	b.quotaNotified[pubKey] = true
+	b.quotaMu.Unlock()
+
+	if action == QuotaActionDisable {
+		if err := b.SetEnabled(pubKey, false); err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+	// QuotaActionThrottle has no enforcement mechanism at the db layer —
+	// applying an actual rate limit needs the live device handle, which
+	// only the bridge package has. The audit row and PeerEvent below are
+	// the signal bridge acts on.
+
+	if _, err := b.db.Exec(b.rebind(`
+		INSERT INTO quota_events (peer_id, action, bytes_used, quota_bytes, created_at)
+		VALUES (?, ?, ?, ?, ?)`),
+		peerID, action, used, quotaBytes, time.Now().Unix(),
+	); err != nil {
+		return nil, err
+	}
+
+	return &PeerEvent{
+		PublicKey: pubKey,
+		Kind:      EventQuotaExceeded,
+		Old:       fmt.Sprintf("%d", quotaBytes),
+		New:       fmt.Sprintf("%d", used),
+		RxBytes:   rxBytes,
+		TxBytes:   txBytes,
+	}, nil
+}
+
+// StartQuotaResetter runs until ctx is cancelled, periodically re-arming
+// the quota baseline and quota_reset_at for every peer whose quota window
+// has elapsed. It does not re-enable peers disabled by QuotaActionDisable
+// — that's a separate admin decision.
+func StartQuotaResetter(ctx context.Context, db *BridgeDB) {
+	go func() {
+		ticker := time.NewTicker(quotaResetCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = db.resetExpiredQuotas()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// resetExpiredQuotas re-arms the quota baseline and quota_reset_at for
+// every peer whose current quota window has elapsed. It moves the baseline
+// up to the peer's current rx_bytes/tx_bytes rather than zeroing those
+// columns — they're WireGuard's own lifetime device counters (see
+// db/stats.go's StatsSyncer), so zeroing them would just be overwritten by
+// the next stats sync and the "reset" would never stick.
+func (b *BridgeDB) resetExpiredQuotas() error {
+	now := time.Now().Unix()
+	rows, err := b.db.Query(b.rebind(`
+		SELECT public_key, quota_period_sec FROM peers
+		WHERE quota_bytes > 0 AND quota_reset_at IS NOT NULL AND quota_reset_at <= ?`), now)
+	if err != nil {
+		return err
+	}
+	var pubKeys []string
+	var periods []int
+	for rows.Next() {
+		var pubKey string
+		var period int
+		if err := rows.Scan(&pubKey, &period); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		pubKeys = append(pubKeys, pubKey)
+		periods = append(periods, period)
+	}
+	_ = rows.Close()
+
+	for i, pubKey := range pubKeys {
+		nextReset := now + int64(periods[i])
+		if _, err := b.db.Exec(b.rebind(`
+			UPDATE peers SET quota_baseline_rx_bytes = rx_bytes, quota_baseline_tx_bytes = tx_bytes, quota_reset_at = ?
+			WHERE public_key = ?`), nextReset, pubKey); err != nil {
+			continue
+		}
+		b.quotaMu.Lock()
+		delete(b.quotaNotified, pubKey)
+		b.quotaMu.Unlock()
+	}
+	return nil
+}
@@ -7,6 +7,16 @@ import (
 	"fmt"
 )
 
+// Backend selects what kind of tun.Device the bridge brings up in
+// State.Start — a kernel TUN (BackendTUN, the default) or an in-process
+// gVisor netstack (BackendNetstack, see State.InitNetstack). Persisted on
+// ServerConfig so a restart picks the same one without the caller having to
+// resupply InitNetstack's address list.
+const (
+	BackendTUN      = "tun"
+	BackendNetstack = "netstack"
+)
+
 // ServerConfig holds the server-side configuration that persists across restarts.
 // This is the "what should be configured" layer — read at startup to bootstrap the device.
 type ServerConfig struct {
@@ -22,27 +32,20 @@ type ServerConfig struct {
 	FWMark       int    `json:"fwmark"`                  // SO_MARK for policy routing
 	PostUp       string `json:"post_up,omitempty"`       // hook command
 	PostDown     string `json:"post_down,omitempty"`     // hook command
+	Backend      string `json:"backend,omitempty"`       // BackendTUN or BackendNetstack, empty = BackendTUN
 }
 
 // UpsertServerConfig creates or replaces the server configuration.
 func (b *BridgeDB) UpsertServerConfig(cfg *ServerConfig) error {
-	_, err := b.db.Exec(`
-		INSERT OR REPLACE INTO server_config
-			(device_id, endpoint, endpoint_v6, network, network_v6, dns_primary, dns_secondary, dns_v6, mtu, fwmark, post_up, post_down)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		cfg.DeviceID, cfg.Endpoint, nullStr(cfg.EndpointV6), cfg.Network, nullStr(cfg.NetworkV6),
-		cfg.DNSPrimary, cfg.DNSSecondary, nullStr(cfg.DNSV6),
-		cfg.MTU, cfg.FWMark,
-		cfg.PostUp, cfg.PostDown)
-	return err
+	return b.backend.UpsertServerConfig(b.db, cfg)
 }
 
 // GetServerConfig retrieves the server configuration for a device.
 func (b *BridgeDB) GetServerConfig(deviceID int) (*ServerConfig, error) {
-	row := b.db.QueryRow(`
+	row := b.db.QueryRow(b.rebind(`
 		SELECT device_id, endpoint, endpoint_v6, network, network_v6,
-		       dns_primary, dns_secondary, dns_v6, mtu, fwmark, post_up, post_down
-		FROM server_config WHERE device_id = ?`, deviceID)
+		       dns_primary, dns_secondary, dns_v6, mtu, fwmark, post_up, post_down, backend
+		FROM server_config WHERE device_id = ?`), deviceID)
 
 	var cfg ServerConfig
 	var endpoint, endpointV6, networkV6, dnsSecondary, dnsV6, postUp, postDown sql.NullString
@@ -50,7 +53,7 @@ func (b *BridgeDB) GetServerConfig(deviceID int) (*ServerConfig, error) {
 		&cfg.DeviceID, &endpoint, &endpointV6, &cfg.Network, &networkV6,
 		&cfg.DNSPrimary, &dnsSecondary, &dnsV6,
 		&cfg.MTU, &cfg.FWMark,
-		&postUp, &postDown,
+		&postUp, &postDown, &cfg.Backend,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("no server config for device %d", deviceID)
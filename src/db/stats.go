@@ -7,27 +7,112 @@ import (
 	"time"
 )
 
-// StatsSyncer periodically reads WireGuard runtime state via IpcGet
-// and writes it to bridge-db.
+// defaultMinStatWriteInterval rate-limits how often a single peer's
+// rx_bytes/tx_bytes/endpoint/last_handshake can be written to bridge-db,
+// independent of how often syncOnce runs.
+const defaultMinStatWriteInterval = 1 * time.Second
+
+// PeerEventKind identifies what changed on a peer between two stats ticks.
+type PeerEventKind string
+
+const (
+	EventHandshake      PeerEventKind = "handshake"
+	EventEndpointChange PeerEventKind = "endpoint_change"
+	EventRxDelta        PeerEventKind = "rx_delta"
+	EventTxDelta        PeerEventKind = "tx_delta"
+	EventQuotaExceeded  PeerEventKind = "quota_exceeded"
+	EventACLDrop        PeerEventKind = "acl_drop"
+)
+
+// PeerEvent describes one detected change for a peer, pushed by StatsSyncer
+// to subscribers instead of requiring them to poll bridge-db. Old/New hold
+// the kind-specific diff; Endpoint/RxBytes/TxBytes/LastHandshake are the
+// peer's full state as of this tick, for subscribers that want a snapshot
+// rather than a diff (e.g. BridgeSetPeerEventCallback).
+type PeerEvent struct {
+	PublicKey     string        `json:"public_key"`
+	Kind          PeerEventKind `json:"kind"`
+	Old           string        `json:"old,omitempty"`
+	New           string        `json:"new,omitempty"`
+	Endpoint      string        `json:"endpoint"`
+	RxBytes       int64         `json:"rx_bytes"`
+	TxBytes       int64         `json:"tx_bytes"`
+	LastHandshake *int64        `json:"last_handshake,omitempty"`
+}
+
+// StatsSyncer reads WireGuard runtime state via IpcGet, on a ticker or an
+// explicit Notify(), and writes only the peers whose last_handshake,
+// endpoint, or byte counters actually changed since the last write.
 type StatsSyncer struct {
-	db       *BridgeDB
-	ipcGetFn func() (string, error) // injected: calls device.IpcGet()
-	interval time.Duration
-	stop     chan struct{}
-	wg       sync.WaitGroup
+	db               *BridgeDB
+	ipcGetFn         func() (string, error) // injected: calls device.IpcGet()
+	interval         time.Duration
+	minWriteInterval time.Duration
+	stop             chan struct{}
+	notify           chan struct{}
+	wg               sync.WaitGroup
+
+	// healthPrev tracks the previous tick's counters per peer so syncOnce
+	// can derive per-interval throughput and detect endpoint changes.
+	healthPrev map[string]peerHealthPrev
+
+	// writeState tracks the last values actually written to bridge-db per
+	// peer, so syncOnce can diff against it instead of writing every tick.
+	writeState map[string]peerWriteState
+
+	subMu       sync.Mutex
+	subscribers []chan<- PeerEvent
+}
+
+// peerHealthPrev is the prior tick's snapshot for one peer, used to derive
+// rx_bps/tx_bps and endpoint-change telemetry on the next tick.
+type peerHealthPrev struct {
+	endpoint string
+	rxBytes  int64
+	txBytes  int64
+	tickedAt time.Time
+}
+
+// peerWriteState is the last value actually persisted to the peers table
+// for one peer, used for change detection and event diffing.
+type peerWriteState struct {
+	endpoint      string
+	lastHandshake *int64
+	rxBytes       int64
+	txBytes       int64
+	writtenAt     time.Time
 }
 
 // NewStatsSyncer creates a stats syncer.
 // ipcGetFn should return the UAPI IpcGet output string.
 func NewStatsSyncer(db *BridgeDB, ipcGetFn func() (string, error), intervalSec int) *StatsSyncer {
 	return &StatsSyncer{
-		db:       db,
-		ipcGetFn: ipcGetFn,
-		interval: time.Duration(intervalSec) * time.Second,
-		stop:     make(chan struct{}),
+		db:               db,
+		ipcGetFn:         ipcGetFn,
+		interval:         time.Duration(intervalSec) * time.Second,
+		minWriteInterval: defaultMinStatWriteInterval,
+		stop:             make(chan struct{}),
+		notify:           make(chan struct{}, 1),
+		healthPrev:       make(map[string]peerHealthPrev),
+		writeState:       make(map[string]peerWriteState),
 	}
 }
 
+// SetMinWriteInterval overrides the per-peer minimum time between bridge-db
+// stat writes. Intended to be called before Start.
+func (s *StatsSyncer) SetMinWriteInterval(d time.Duration) {
+	s.minWriteInterval = d
+}
+
+// Subscribe registers ch to receive PeerEvents as syncOnce detects changes.
+// Sends are non-blocking — a full channel drops the event rather than
+// stalling the sync loop.
+func (s *StatsSyncer) Subscribe(ch chan<- PeerEvent) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	s.subscribers = append(s.subscribers, ch)
+}
+
 // Start begins the background sync goroutine.
 func (s *StatsSyncer) Start() {
 	s.wg.Add(1)
@@ -39,6 +124,8 @@ func (s *StatsSyncer) Start() {
 			select {
 			case <-ticker.C:
 				s.syncOnce()
+			case <-s.notify:
+				s.syncOnce()
 			case <-s.stop:
 				return
 			}
@@ -52,6 +139,15 @@ func (s *StatsSyncer) Stop() {
 	s.wg.Wait()
 }
 
+// Notify requests an immediate sync pass, e.g. from a handshake or
+// keepalive hook in the device layer. Coalesces with any pending request.
+func (s *StatsSyncer) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
 // peerStats holds parsed per-peer stats from IpcGet output.
 type peerStats struct {
 	publicKey     string
@@ -61,6 +157,12 @@ type peerStats struct {
 	txBytes       int64
 }
 
+// Connection-health thresholds, in the spirit of netbird's status output.
+const (
+	healthConnectedMaxAgeSec = 180
+	healthIdleMaxAgeSec      = 600
+)
+
 func (s *StatsSyncer) syncOnce() {
 	output, err := s.ipcGetFn()
 	if err != nil {
@@ -68,9 +170,158 @@ func (s *StatsSyncer) syncOnce() {
 	}
 
 	peers := parseIpcGetPeers(output)
+	now := time.Now()
+
+	var updates []StatUpdate
 	for _, p := range peers {
-		_ = s.db.UpdateStats(p.publicKey, p.endpoint, p.lastHandshake, p.rxBytes, p.txBytes)
+		if s.shouldWrite(p, now) {
+			updates = append(updates, StatUpdate{
+				PublicKey:     p.publicKey,
+				Endpoint:      p.endpoint,
+				LastHandshake: p.lastHandshake,
+				RxBytes:       p.rxBytes,
+				TxBytes:       p.txBytes,
+			})
+		}
+		s.updateHealth(p, now)
+	}
+	if len(updates) > 0 {
+		quotaEvents, _ := s.db.BatchUpdateStats(updates)
+		for _, ev := range quotaEvents {
+			s.publish(ev)
+		}
+	}
+}
+
+// shouldWrite reports whether p differs from the last value written for its
+// public key and enough time has passed since that write (minWriteInterval).
+// On the peer's first tick it always returns true to seed writeState.
+// As a side effect, it emits a PeerEvent per changed field and, when it
+// returns true, records p as the new writeState.
+func (s *StatsSyncer) shouldWrite(p peerStats, now time.Time) bool {
+	prev, ok := s.writeState[p.publicKey]
+	if ok {
+		unchanged := prev.endpoint == p.endpoint &&
+			equalHandshake(prev.lastHandshake, p.lastHandshake) &&
+			prev.rxBytes == p.rxBytes &&
+			prev.txBytes == p.txBytes
+		if unchanged {
+			return false
+		}
+		if now.Sub(prev.writtenAt) < s.minWriteInterval {
+			return false
+		}
+		s.emitChanges(p, prev)
+	}
+
+	s.writeState[p.publicKey] = peerWriteState{
+		endpoint: p.endpoint, lastHandshake: p.lastHandshake,
+		rxBytes: p.rxBytes, txBytes: p.txBytes, writtenAt: now,
+	}
+	return true
+}
+
+// emitChanges publishes a PeerEvent per field that changed between prev
+// (the last written state) and p (this tick's observed state).
+func (s *StatsSyncer) emitChanges(p peerStats, prev peerWriteState) {
+	base := PeerEvent{
+		PublicKey: p.publicKey, Endpoint: p.endpoint,
+		RxBytes: p.rxBytes, TxBytes: p.txBytes, LastHandshake: p.lastHandshake,
+	}
+
+	if prev.endpoint != p.endpoint && p.endpoint != "" {
+		ev := base
+		ev.Kind, ev.Old, ev.New = EventEndpointChange, prev.endpoint, p.endpoint
+		s.publish(ev)
+	}
+	if !equalHandshake(prev.lastHandshake, p.lastHandshake) && p.lastHandshake != nil {
+		ev := base
+		ev.Kind, ev.Old, ev.New = EventHandshake, formatHandshake(prev.lastHandshake), formatHandshake(p.lastHandshake)
+		s.publish(ev)
+	}
+	if p.rxBytes > prev.rxBytes {
+		ev := base
+		ev.Kind, ev.Old, ev.New = EventRxDelta, strconv.FormatInt(prev.rxBytes, 10), strconv.FormatInt(p.rxBytes, 10)
+		s.publish(ev)
+	}
+	if p.txBytes > prev.txBytes {
+		ev := base
+		ev.Kind, ev.Old, ev.New = EventTxDelta, strconv.FormatInt(prev.txBytes, 10), strconv.FormatInt(p.txBytes, 10)
+		s.publish(ev)
+	}
+}
+
+// publish fans ev out to all subscribers, dropping it for any that are full.
+func (s *StatsSyncer) publish(ev PeerEvent) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Publish fans ev out to subscribers exactly like an event syncOnce
+// detected itself. Lets a source outside this package (bridge.Filter's
+// counter flusher, for ACL accept/drop counts) ride the same
+// Subscribe/publish path as handshake, endpoint, and quota events instead
+// of needing its own.
+func (s *StatsSyncer) Publish(ev PeerEvent) {
+	s.publish(ev)
+}
+
+func equalHandshake(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return *a == *b
+}
+
+func formatHandshake(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+// updateHealth derives this tick's connection status, throughput, and
+// endpoint-change telemetry for one peer and persists it to peer_health /
+// peer_health_history.
+func (s *StatsSyncer) updateHealth(p peerStats, now time.Time) {
+	var handshakeAge *int64
+	status := "disconnected"
+	if p.lastHandshake != nil {
+		age := now.Unix() - *p.lastHandshake
+		handshakeAge = &age
+		switch {
+		case age < healthConnectedMaxAgeSec:
+			status = "connected"
+		case age < healthIdleMaxAgeSec:
+			status = "idle"
+		default:
+			status = "stale"
+		}
+	}
+
+	var rxBps, txBps int64
+	var endpointChanged bool
+	if prev, ok := s.healthPrev[p.publicKey]; ok {
+		if elapsed := now.Sub(prev.tickedAt).Seconds(); elapsed > 0 {
+			if d := p.rxBytes - prev.rxBytes; d > 0 {
+				rxBps = int64(float64(d) / elapsed)
+			}
+			if d := p.txBytes - prev.txBytes; d > 0 {
+				txBps = int64(float64(d) / elapsed)
+			}
+		}
+		endpointChanged = p.endpoint != "" && prev.endpoint != "" && p.endpoint != prev.endpoint
+	}
+	s.healthPrev[p.publicKey] = peerHealthPrev{endpoint: p.endpoint, rxBytes: p.rxBytes, txBytes: p.txBytes, tickedAt: now}
+
+	_ = s.db.UpsertPeerHealth(p.publicKey, status, handshakeAge, rxBps, txBps, endpointChanged)
+	_ = s.db.AppendPeerHealthHistory(p.publicKey, status, handshakeAge, rxBps, txBps)
 }
 
 // parseIpcGetPeers parses the UAPI IpcGet output into per-peer stats.
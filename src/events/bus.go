@@ -0,0 +1,205 @@
+// Package events models a structured, push-based event stream for the
+// FFI caller, alongside the strictly request/response surface the rest
+// of the bridge exposes. It holds only the event/subscription/ring-buffer
+// model; wiring it to device.Logger and the cookie/peer/bind paths that
+// produce events lives in the main package's bridge_events.go, the same
+// split metrics and l2 already draw between their data model and
+// lifecycle.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Kind identifies an event type as a bit so a subscriber's mask can
+// select any combination.
+type Kind uint32
+
+const (
+	KindHandshakeCompleted Kind = 1 << iota
+	KindHandshakeFailed
+	KindPeerEndpointChanged
+	KindCookieReplySent
+	KindUnderLoadChanged
+	KindBindUpdated
+	KindTunMTUChanged
+	KindLinkChanged
+)
+
+// Name returns the JSON event-name string for k, or "" if k isn't a
+// single known kind.
+func (k Kind) Name() string {
+	switch k {
+	case KindHandshakeCompleted:
+		return "handshake_completed"
+	case KindHandshakeFailed:
+		return "handshake_failed"
+	case KindPeerEndpointChanged:
+		return "peer_endpoint_changed"
+	case KindCookieReplySent:
+		return "cookie_reply_sent"
+	case KindUnderLoadChanged:
+		return "under_load_changed"
+	case KindBindUpdated:
+		return "bind_updated"
+	case KindTunMTUChanged:
+		return "tun_mtu_changed"
+	case KindLinkChanged:
+		return "link_changed"
+	default:
+		return ""
+	}
+}
+
+// Event is one JSON-encodable occurrence on a device.
+type Event struct {
+	Kind      Kind              `json:"-"`
+	Name      string            `json:"event"`
+	Timestamp int64             `json:"timestamp"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// NewEvent builds an Event stamped with the current time.
+func NewEvent(kind Kind, fields map[string]string) Event {
+	return Event{Kind: kind, Name: kind.Name(), Timestamp: time.Now().Unix(), Fields: fields}
+}
+
+// ringCapacity bounds how many unread events a slow consumer can fall
+// behind by before the oldest are dropped, so a stalled FFI caller can't
+// back-pressure the data plane.
+const ringCapacity = 256
+
+// Subscription delivers events matching its mask to a single consumer via
+// Next. It's backed by a buffered channel rather than a slice-based ring:
+// push is always non-blocking, dropping the oldest buffered event on
+// overflow.
+type Subscription struct {
+	mask uint32
+	ch   chan Event
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newSubscription(mask uint32) *Subscription {
+	return &Subscription{
+		mask:   mask,
+		ch:     make(chan Event, ringCapacity),
+		closed: make(chan struct{}),
+	}
+}
+
+func (s *Subscription) push(ev Event) {
+	if uint32(ev.Kind)&s.mask == 0 {
+		return
+	}
+	select {
+	case s.ch <- ev:
+		return
+	default:
+	}
+	// Full: drop the oldest buffered event, then retry once.
+	select {
+	case <-s.ch:
+	default:
+	}
+	select {
+	case s.ch <- ev:
+	default:
+	}
+}
+
+// Next blocks for the next matching event, up to timeout. ok is false on
+// timeout or once the subscription is closed.
+func (s *Subscription) Next(timeout time.Duration) (ev Event, ok bool) {
+	select {
+	case ev = <-s.ch:
+		return ev, true
+	case <-time.After(timeout):
+		return Event{}, false
+	case <-s.closed:
+		return Event{}, false
+	}
+}
+
+// Close stops any blocked Next call and makes future ones return immediately.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// Bus fans events out to subscriptions grouped by device handle.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[int64]map[*Subscription]struct{}
+}
+
+// NewBus creates an empty Bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int64]map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new Subscription for deviceHandle with the given
+// event mask.
+func (b *Bus) Subscribe(deviceHandle int64, mask uint32) *Subscription {
+	sub := newSubscription(mask)
+	b.mu.Lock()
+	if b.subs[deviceHandle] == nil {
+		b.subs[deviceHandle] = make(map[*Subscription]struct{})
+	}
+	b.subs[deviceHandle][sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes sub from deviceHandle's subscriber set. It does not
+// close sub; the caller does that once it's done draining it.
+func (b *Bus) Unsubscribe(deviceHandle int64, sub *Subscription) {
+	b.mu.Lock()
+	if set, ok := b.subs[deviceHandle]; ok {
+		delete(set, sub)
+		if len(set) == 0 {
+			delete(b.subs, deviceHandle)
+		}
+	}
+	b.mu.Unlock()
+}
+
+// Publish delivers ev to every subscription registered for deviceHandle.
+func (b *Bus) Publish(deviceHandle int64, ev Event) {
+	b.mu.Lock()
+	set := b.subs[deviceHandle]
+	targets := make([]*Subscription, 0, len(set))
+	for s := range set {
+		targets = append(targets, s)
+	}
+	b.mu.Unlock()
+	for _, s := range targets {
+		s.push(ev)
+	}
+}
+
+// PublishAll delivers ev to every subscription on every device handle, for
+// events (like a cookie reply) that aren't naturally scoped to one device.
+func (b *Bus) PublishAll(ev Event) {
+	b.mu.Lock()
+	var targets []*Subscription
+	for _, set := range b.subs {
+		for s := range set {
+			targets = append(targets, s)
+		}
+	}
+	b.mu.Unlock()
+	for _, s := range targets {
+		s.push(ev)
+	}
+}
+
+// HasSubscribers reports whether deviceHandle currently has at least one
+// live subscription, so a caller can decide whether a monitor goroutine
+// for it is still worth running.
+func (b *Bus) HasSubscribers(deviceHandle int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[deviceHandle]) > 0
+}
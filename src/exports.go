@@ -22,6 +22,16 @@ package main
 static inline void invoke_log_callback(WgLogCallback cb, int32_t level, const char *msg, void *ctx) {
     if (cb) cb(level, msg, ctx);
 }
+
+// C wrapper to invoke the stats-event callback function pointer from Go.
+static inline void invoke_stats_event_callback(WgStatsEventCallback cb, const char *peer, const char *kind, const char *old_val, const char *new_val, void *ctx) {
+    if (cb) cb(peer, kind, old_val, new_val, ctx);
+}
+
+// C wrapper to invoke the JSON peer-event callback function pointer from Go.
+static inline void invoke_peer_event_callback(WgPeerEventCallback cb, const char *payload, void *ctx) {
+    if (cb) cb(payload, ctx);
+}
 */
 import "C"
 import (
@@ -61,13 +71,77 @@ func BridgeSetLogCallback(callback C.WgLogCallback, context unsafe.Pointer) {
 	}, context)
 }
 
+// ============================================================================
+// Stats Event Callback
+// ============================================================================
+
+// StatsSubscribe registers a callback for push-based peer stats-change
+// events (handshake, endpoint_change, rx_delta, tx_delta, quota_exceeded,
+// acl_drop) so the Python
+// daemon can react without polling bridge-db. Pass nil to unsubscribe.
+//
+//export StatsSubscribe
+func StatsSubscribe(callback C.WgStatsEventCallback, context unsafe.Pointer) {
+	if callback == nil {
+		bridge.SetStatsEventCallback(nil, nil)
+		return
+	}
+	cb := callback
+	bridge.SetStatsEventCallback(func(peer, kind, oldVal, newVal *byte, ctx unsafe.Pointer) {
+		C.invoke_stats_event_callback(cb,
+			(*C.char)(unsafe.Pointer(peer)), (*C.char)(unsafe.Pointer(kind)),
+			(*C.char)(unsafe.Pointer(oldVal)), (*C.char)(unsafe.Pointer(newVal)), ctx)
+	}, context)
+}
+
+//export BridgeNotifyStatsSync
+func BridgeNotifyStatsSync() {
+	bridgeState.NotifyStatsSync()
+}
+
+// BridgeSetPeerEventCallback registers a callback that receives every peer
+// stats-change event as a single JSON payload
+// {event, pubkey, endpoint, rx_bytes, tx_bytes, last_handshake_ns}, for
+// callers that would rather parse one object than StatsSubscribe's four
+// separate C strings. Pass nil to unsubscribe. Independent of
+// StatsSubscribe — both may be registered at once.
+//
+//export BridgeSetPeerEventCallback
+func BridgeSetPeerEventCallback(callback C.WgPeerEventCallback, context unsafe.Pointer) {
+	if callback == nil {
+		bridge.SetPeerEventCallback(nil, nil)
+		return
+	}
+	cb := callback
+	bridge.SetPeerEventCallback(func(payload *byte, ctx unsafe.Pointer) {
+		C.invoke_peer_event_callback(cb, (*C.char)(unsafe.Pointer(payload)), ctx)
+	}, context)
+}
+
 // ============================================================================
 // Bridge-DB High-Level API
 // ============================================================================
 
+// backend selects the bridge-db storage engine ("sqlite", "postgres", or ""
+// for the default). Ignored if dbPath already has a "scheme://" prefix.
+//
 //export BridgeInit
-func BridgeInit(dbPath *C.char, ifname *C.char, listenPort C.int, logLevel C.int) C.int32_t {
-	if err := bridgeState.Init(C.GoString(dbPath), C.GoString(ifname), int(listenPort), int(logLevel)); err != nil {
+func BridgeInit(dbPath *C.char, ifname *C.char, listenPort C.int, logLevel C.int, backend *C.char) C.int32_t {
+	if err := bridgeState.Init(C.GoString(dbPath), C.GoString(ifname), int(listenPort), int(logLevel), C.GoString(backend)); err != nil {
+		return errDBOpen
+	}
+	return errOK
+}
+
+// BridgeInitNetstack is the userspace-TUN counterpart of BridgeInit: the
+// bridge's device is brought up on an in-process gVisor netstack bound to
+// localAddrsCSV (comma-separated IPs) instead of a kernel TUN, so the
+// caller needs no root/CAP_NET_ADMIN. All other BridgeXxx calls behave the
+// same afterward.
+//
+//export BridgeInitNetstack
+func BridgeInitNetstack(dbPath *C.char, ifname *C.char, listenPort C.int, logLevel C.int, backend *C.char, localAddrsCSV *C.char) C.int32_t {
+	if err := bridgeState.InitNetstack(C.GoString(dbPath), C.GoString(ifname), int(listenPort), int(logLevel), C.GoString(backend), C.GoString(localAddrsCSV)); err != nil {
 		return errDBOpen
 	}
 	return errOK
@@ -152,6 +226,15 @@ func BridgeGetClient(pubKeyHex *C.char) *C.char {
 	return C.CString(result)
 }
 
+//export GetPeerHealthJSON
+func GetPeerHealthJSON(pubKeyHex *C.char) *C.char {
+	result, err := bridgeState.GetPeerHealth(C.GoString(pubKeyHex))
+	if err != nil {
+		return nil
+	}
+	return C.CString(result)
+}
+
 //export BridgeListClients
 func BridgeListClients(page C.int, limit C.int) *C.char {
 	result, err := bridgeState.ListClients(int(page), int(limit))
@@ -184,6 +267,168 @@ func BridgeStopStatsSync() C.int32_t {
 	return errOK
 }
 
+//export MultihopStart
+func MultihopStart(name *C.char) C.int32_t {
+	if err := bridgeState.StartMultihopTunnel(C.GoString(name)); err != nil {
+		return errDBWrite
+	}
+	return errOK
+}
+
+//export MultihopStop
+func MultihopStop(name *C.char) C.int32_t {
+	if err := bridgeState.StopMultihopTunnel(C.GoString(name)); err != nil {
+		return errDBWrite
+	}
+	return errOK
+}
+
+//export MultihopStatus
+func MultihopStatus(name *C.char) *C.char {
+	result, err := bridgeState.GetMultihopTunnel(C.GoString(name))
+	if err != nil {
+		return nil
+	}
+	return C.CString(result)
+}
+
+//export BridgeStartMultihopStatsSync
+func BridgeStartMultihopStatsSync(intervalSec C.int) C.int32_t {
+	if err := bridgeState.StartMultihopStatsSync(int(intervalSec)); err != nil {
+		return errStatsRunning
+	}
+	return errOK
+}
+
+//export BridgeStopMultihopStatsSync
+func BridgeStopMultihopStatsSync() C.int32_t {
+	_ = bridgeState.StopMultihopStatsSync()
+	return errOK
+}
+
+// BridgeSetBindOptions records GSO/sticky-socket/buffer-size preferences for
+// the bridge's device bind. See bridge.State.SetBindOptions for why this is
+// diagnostics-only rather than an actual runtime toggle.
+//
+//export BridgeSetBindOptions
+func BridgeSetBindOptions(flags C.int, sndBuf C.int, rcvBuf C.int) C.int32_t {
+	if err := bridgeState.SetBindOptions(int(flags), int(sndBuf), int(rcvBuf)); err != nil {
+		return errNotInitialized
+	}
+	return errOK
+}
+
+//export BridgeGetBindStats
+func BridgeGetBindStats() *C.char {
+	result, err := bridgeState.GetBindStats()
+	if err != nil {
+		return nil
+	}
+	return C.CString(result)
+}
+
+// BridgeEnablePSKRotation registers pubKeyHex's preshared key rotation.
+// kemAlgo is "static" (starts ticking immediately, fresh random PSK each
+// interval) or "ml-kem-768" (PSK derived from an ML-KEM-768 encapsulation
+// against the peer's key — see BridgeSetPeerKEMKey — which does NOT start
+// ticking here; see BridgeStartPSKRotationInitiator).
+//
+//export BridgeEnablePSKRotation
+func BridgeEnablePSKRotation(pubKeyHex *C.char, intervalSec C.int, kemAlgo *C.char) C.int32_t {
+	if err := bridgeState.EnablePSKRotation(C.GoString(pubKeyHex), int(intervalSec), C.GoString(kemAlgo)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+// BridgeStartPSKRotationInitiator begins actively ticking an
+// already-registered "ml-kem-768" rotation. Call this on exactly one side
+// of a pair once both sides have exchanged encapsulation keys via
+// BridgeSetPeerKEMKey — the other side must stay passive and only call
+// BridgeDecapsulatePeerPSK as ciphertexts arrive, or both sides will
+// install different, competing PSKs.
+//
+//export BridgeStartPSKRotationInitiator
+func BridgeStartPSKRotationInitiator(pubKeyHex *C.char) C.int32_t {
+	if err := bridgeState.StartPSKRotationInitiator(C.GoString(pubKeyHex)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+//export BridgeDisablePSKRotation
+func BridgeDisablePSKRotation(pubKeyHex *C.char) C.int32_t {
+	if err := bridgeState.DisablePSKRotation(C.GoString(pubKeyHex)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+// BridgeSetPeerKEMKey registers pubKeyHex's peer's base64-encoded
+// ML-KEM-768 encapsulation key. Required before "ml-kem-768" rotation can
+// derive a PSK for that peer; delivering this node's own encapsulation key
+// to the peer, and the resulting ciphertext back, is the caller's
+// responsibility over its own control channel.
+//
+//export BridgeSetPeerKEMKey
+func BridgeSetPeerKEMKey(pubKeyHex *C.char, encapKeyB64 *C.char) C.int32_t {
+	if err := bridgeState.SetPeerKEMKey(C.GoString(pubKeyHex), C.GoString(encapKeyB64)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
+//export BridgeGetPSKEpoch
+func BridgeGetPSKEpoch(pubKeyHex *C.char) C.int64_t {
+	epoch, err := bridgeState.GetPSKEpoch(C.GoString(pubKeyHex))
+	if err != nil {
+		return -1
+	}
+	return C.int64_t(epoch)
+}
+
+// BridgeGetOwnKEMEncapKey returns this node's base64 ML-KEM-768
+// encapsulation key for pubKeyHex's "ml-kem-768" rotation, for the caller
+// to deliver to the peer so it can encapsulate a PSK back via
+// BridgeDecapsulatePeerPSK.
+//
+//export BridgeGetOwnKEMEncapKey
+func BridgeGetOwnKEMEncapKey(pubKeyHex *C.char) *C.char {
+	encapKeyB64, err := bridgeState.GetOwnKEMEncapKey(C.GoString(pubKeyHex))
+	if err != nil {
+		return nil
+	}
+	return C.CString(encapKeyB64)
+}
+
+// BridgeGetPendingPSKCiphertext returns the initiator side's most recent
+// "ml-kem-768" rotation tick as a JSON string {"ciphertext_b64","epoch"},
+// for the caller to deliver to the peer's BridgeDecapsulatePeerPSK. The
+// epoch must travel with the ciphertext — see bridge.DecapsulatePeerPSK's
+// doc comment.
+//
+//export BridgeGetPendingPSKCiphertext
+func BridgeGetPendingPSKCiphertext(pubKeyHex *C.char) *C.char {
+	result, err := bridgeState.GetPendingPSKCiphertext(C.GoString(pubKeyHex))
+	if err != nil {
+		return nil
+	}
+	return C.CString(result)
+}
+
+// BridgeDecapsulatePeerPSK completes an "ml-kem-768" rotation on the
+// responding side: it decapsulates ciphertextB64 under epoch (both read
+// from the initiator's BridgeGetPendingPSKCiphertext) and installs the
+// resulting PSK the same way a normal rotation tick would.
+//
+//export BridgeDecapsulatePeerPSK
+func BridgeDecapsulatePeerPSK(pubKeyHex *C.char, ciphertextB64 *C.char, epoch C.int64_t) C.int32_t {
+	if err := bridgeState.DecapsulatePeerPSK(C.GoString(pubKeyHex), C.GoString(ciphertextB64), uint64(epoch)); err != nil {
+		return errInternal
+	}
+	return errOK
+}
+
 //export BridgeGetDeviceInfo
 func BridgeGetDeviceInfo() *C.char {
 	result, err := bridgeState.GetDeviceInfo()
@@ -708,6 +953,9 @@ func DeviceUAPISocketPath(ifname *C.char) *C.char {
 // ============================================================================
 
 func getDevice(handle int64) (*device.Device, C.int32_t) {
+	if !Validate(handle, KindDevice) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
 	obj, ok := deviceRegistry.Get(handle)
 	if !ok {
 		return nil, C.WG_ERR_NOT_FOUND
@@ -716,6 +964,9 @@ func getDevice(handle int64) (*device.Device, C.int32_t) {
 }
 
 func getPeer(handle int64) (*device.Peer, C.int32_t) {
+	if !Validate(handle, KindPeer) {
+		return nil, C.WG_ERR_NOT_FOUND
+	}
 	obj, ok := peerRegistry.Get(handle)
 	if !ok {
 		return nil, C.WG_ERR_NOT_FOUND
@@ -724,6 +975,9 @@ func getPeer(handle int64) (*device.Peer, C.int32_t) {
 }
 
 func getLogger(handle int64) *device.Logger {
+	if !Validate(handle, KindLogger) {
+		return device.NewLogger(device.LogLevelSilent, "")
+	}
 	obj, ok := loggerRegistry.Get(handle)
 	if !ok {
 		return device.NewLogger(device.LogLevelSilent, "")
@@ -4,58 +4,180 @@ import (
 	"sync"
 )
 
-// HandleRegistry provides thread-safe storage for Go objects
-// referenced by integer handles across the FFI boundary.
+// HandleKind tags which registry a handle belongs to, packed into its own
+// bits (see packHandle) so a handle minted by one registry can never be
+// mistaken for, or accidentally alias, an object in another.
+type HandleKind uint8
+
+const (
+	KindDevice HandleKind = iota + 1
+	KindPeer
+	KindLogger
+	KindCookieChecker
+	KindCookieGen
+	KindNetstackConn
+	KindNetstackListener
+	KindClientDialer
+	KindPersistentDevice
+)
+
+// Handles are packed 64-bit values: low 32 bits = slot index into the
+// registry's slab, next 16 bits = that slot's generation at Add time, next
+// 8 bits = the registry's HandleKind. The top 8 bits are always zero, so a
+// packed handle is always a positive C.int64_t and never collides with the
+// small negative WG_ERR_* codes callers check it against.
+const (
+	handleIndexBits = 32
+	handleGenBits   = 16
+
+	handleGenShift  = handleIndexBits
+	handleKindShift = handleIndexBits + handleGenBits
+
+	handleIndexMask = 1<<handleIndexBits - 1
+	handleGenMask   = 1<<handleGenBits - 1
+	handleKindMask  = 0xFF
+)
+
+func packHandle(index uint32, gen uint16, kind HandleKind) int64 {
+	return int64(index) | int64(gen)<<handleGenShift | int64(kind)<<handleKindShift
+}
+
+func unpackHandle(h int64) (index uint32, gen uint16, kind HandleKind) {
+	index = uint32(h & handleIndexMask)
+	gen = uint16((h >> handleGenShift) & handleGenMask)
+	kind = HandleKind((h >> handleKindShift) & handleKindMask)
+	return
+}
+
+// HandleType returns the HandleKind packed into h, or 0 if h is 0/negative
+// (an error code, not a handle) or otherwise doesn't decode to a kind this
+// process ever mints.
+func HandleType(h int64) HandleKind {
+	if h <= 0 {
+		return 0
+	}
+	_, _, kind := unpackHandle(h)
+	if kind < KindDevice || kind > KindPersistentDevice {
+		return 0
+	}
+	return kind
+}
+
+// Validate reports whether h's packed kind tag matches expected, without
+// touching the registry itself — callers that only need to reject an
+// obviously-wrong-type handle before taking a lock can use this instead of
+// a full Get.
+func Validate(h int64, expected HandleKind) bool {
+	return HandleType(h) == expected
+}
+
+// handleSlot is one entry in a HandleRegistry's slab. gen is bumped on
+// every Remove so a handle minted before that Remove can never alias
+// whatever Add reuses the slot for next — live is redundant with "was this
+// slot ever Added" but makes the zero-value slot (an index nothing has
+// used yet) unambiguously not live.
+type handleSlot struct {
+	obj  interface{}
+	gen  uint16
+	live bool
+}
+
+// HandleRegistry provides thread-safe storage for Go objects referenced by
+// packed, typed, generation-counted handles across the FFI boundary.
 // Pattern mirrors wstunnel's OpaquePointer approach but supports
-// multi-instance (one handle per device/peer/object).
+// multi-instance (one handle per device/peer/object) and, unlike a plain
+// map[int64]interface{} of raw sequence numbers, refuses to hand back an
+// object for a handle whose slot has since been Removed and reused, or
+// whose kind tag belongs to a different registry entirely.
 type HandleRegistry struct {
-	mu      sync.RWMutex
-	objects map[int64]interface{}
-	seq     int64
+	mu    sync.RWMutex
+	kind  HandleKind
+	slots []handleSlot
+	free  []uint32
 }
 
-func NewHandleRegistry() *HandleRegistry {
-	return &HandleRegistry{
-		objects: make(map[int64]interface{}),
-	}
+func NewHandleRegistry(kind HandleKind) *HandleRegistry {
+	return &HandleRegistry{kind: kind}
 }
 
+// Add stores obj in a free slot (reusing one left behind by Remove where
+// possible) and returns a packed handle for it.
 func (r *HandleRegistry) Add(obj interface{}) int64 {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.seq++
-	r.objects[r.seq] = obj
-	return r.seq
+
+	var index uint32
+	if n := len(r.free); n > 0 {
+		index = r.free[n-1]
+		r.free = r.free[:n-1]
+	} else {
+		index = uint32(len(r.slots))
+		r.slots = append(r.slots, handleSlot{})
+	}
+	r.slots[index].obj = obj
+	r.slots[index].live = true
+	return packHandle(index, r.slots[index].gen, r.kind)
 }
 
+// Get returns the object behind handle if its index is in range, its
+// slot is still live, its generation matches what Add minted it with, and
+// its kind tag matches this registry — a stale or cross-registry handle
+// returns ok=false instead of aliasing whatever the slot holds now.
 func (r *HandleRegistry) Get(handle int64) (interface{}, bool) {
+	index, gen, kind := unpackHandle(handle)
+	if kind != r.kind {
+		return nil, false
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	obj, ok := r.objects[handle]
-	return obj, ok
+	if int(index) >= len(r.slots) {
+		return nil, false
+	}
+	s := r.slots[index]
+	if !s.live || s.gen != gen {
+		return nil, false
+	}
+	return s.obj, true
 }
 
+// Remove frees handle's slot and bumps its generation so this exact handle
+// value can never be accepted by Get again.
 func (r *HandleRegistry) Remove(handle int64) bool {
+	index, gen, kind := unpackHandle(handle)
+	if kind != r.kind {
+		return false
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, ok := r.objects[handle]; ok {
-		delete(r.objects, handle)
-		return true
+	if int(index) >= len(r.slots) {
+		return false
+	}
+	s := &r.slots[index]
+	if !s.live || s.gen != gen {
+		return false
 	}
-	return false
+	s.live = false
+	s.obj = nil
+	s.gen++
+	r.free = append(r.free, index)
+	return true
 }
 
 func (r *HandleRegistry) Count() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return len(r.objects)
+	return len(r.slots) - len(r.free)
 }
 
 // Global registries — one per type for type safety
 var (
-	deviceRegistry        = NewHandleRegistry()
-	peerRegistry          = NewHandleRegistry()
-	loggerRegistry        = NewHandleRegistry()
-	cookieCheckerRegistry = NewHandleRegistry()
-	cookieGenRegistry     = NewHandleRegistry()
-)
\ No newline at end of file
+	deviceRegistry           = NewHandleRegistry(KindDevice)
+	peerRegistry             = NewHandleRegistry(KindPeer)
+	loggerRegistry           = NewHandleRegistry(KindLogger)
+	cookieCheckerRegistry    = NewHandleRegistry(KindCookieChecker)
+	cookieGenRegistry        = NewHandleRegistry(KindCookieGen)
+	netstackConnRegistry     = NewHandleRegistry(KindNetstackConn)
+	netstackListenerRegistry = NewHandleRegistry(KindNetstackListener)
+	clientDialerRegistry     = NewHandleRegistry(KindClientDialer)
+	persistentDeviceRegistry = NewHandleRegistry(KindPersistentDevice)
+)
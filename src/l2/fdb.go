@@ -0,0 +1,91 @@
+// Package l2 provides the forwarding-database and loop-prevention header
+// used to run WireGuard as a layer-2 (Ethernet) overlay: a MAC->peer
+// learning table in place of IP allowed-ips routing, and a minimal
+// sequence-numbered header so flooded frames don't loop between peers.
+//
+// This package holds only the data model. Device/TAP creation and the
+// actual frame dispatch between peers is handled in the main package's
+// bridge_l2.go, the same split multihop uses between its config model and
+// bridge.State's device lifecycle.
+package l2
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a learned MAC->peer mapping is trusted before it
+// must be relearned, matching typical switch FDB aging (Linux bridges
+// default to 300s).
+const DefaultTTL = 5 * time.Minute
+
+// Entry is one learned forwarding-database record.
+type Entry struct {
+	MAC       string `json:"mac"`
+	PeerKey   string `json:"peer_pubkey"`
+	LearnedAt int64  `json:"learned_at"`
+}
+
+// FDB is a MAC-address -> peer-public-key learning table with TTL-based
+// aging, used to decide where to forward a unicast Ethernet frame instead
+// of consulting an allowed-ips trie.
+type FDB struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]Entry
+}
+
+// NewFDB creates an FDB. ttl <= 0 uses DefaultTTL.
+func NewFDB(ttl time.Duration) *FDB {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &FDB{ttl: ttl, entries: make(map[string]Entry)}
+}
+
+// Learn records that mac is reachable via peerKey, refreshing its TTL.
+func (f *FDB) Learn(mac, peerKey string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[mac] = Entry{MAC: mac, PeerKey: peerKey, LearnedAt: time.Now().Unix()}
+}
+
+// Lookup returns the peer a unicast frame to mac should be forwarded to.
+// ok is false for an unknown or expired mac — the caller should flood.
+func (f *FDB) Lookup(mac string) (peerKey string, ok bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	e, found := f.entries[mac]
+	if !found {
+		return "", false
+	}
+	if time.Since(time.Unix(e.LearnedAt, 0)) > f.ttl {
+		return "", false
+	}
+	return e.PeerKey, true
+}
+
+// Flush removes every learned entry.
+func (f *FDB) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = make(map[string]Entry)
+}
+
+// Dump returns a snapshot of all non-expired entries, in no particular
+// order (map iteration).
+func (f *FDB) Dump() []Entry {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	out := make([]Entry, 0, len(f.entries))
+	now := time.Now()
+	for _, e := range f.entries {
+		if now.Sub(time.Unix(e.LearnedAt, 0)) > f.ttl {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package l2
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// HeaderLen is the size of the private loop-prevention header this package
+// prepends to every Ethernet frame before it is handed to the WireGuard
+// transport, and strips again on receive.
+const HeaderLen = 4
+
+// EncodeHeader prepends a 4-byte sequence number to frame, returning a new
+// slice (frame is not modified). seq is meant to be a per-origin-MAC
+// monotonic counter from a SeqCounter.
+func EncodeHeader(seq uint32, frame []byte) []byte {
+	out := make([]byte, HeaderLen+len(frame))
+	binary.BigEndian.PutUint32(out[:HeaderLen], seq)
+	copy(out[HeaderLen:], frame)
+	return out
+}
+
+// DecodeHeader splits a previously-encoded buffer back into its sequence
+// number and the original Ethernet frame. ok is false if buf is too short
+// to contain a header.
+func DecodeHeader(buf []byte) (seq uint32, frame []byte, ok bool) {
+	if len(buf) < HeaderLen {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(buf[:HeaderLen]), buf[HeaderLen:], true
+}
+
+// SeqCounter hands out per-source-MAC sequence numbers for EncodeHeader and
+// detects duplicates/replays of frames that have already been seen for
+// that source — the "small STP-like sequence number" loop-prevention
+// describes: a flooded frame that arrives back at its origin (or at a peer
+// that already relayed it) carries a seq this node has already recorded
+// for that MAC, and is dropped instead of being re-flooded.
+type SeqCounter struct {
+	mu       sync.Mutex
+	next     map[string]uint32
+	lastSeen map[string]uint32
+}
+
+// NewSeqCounter creates an empty SeqCounter.
+func NewSeqCounter() *SeqCounter {
+	return &SeqCounter{
+		next:     make(map[string]uint32),
+		lastSeen: make(map[string]uint32),
+	}
+}
+
+// Next returns the next sequence number to stamp on a frame originating
+// from srcMAC.
+func (c *SeqCounter) Next(srcMAC string) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq := c.next[srcMAC]
+	c.next[srcMAC] = seq + 1
+	return seq
+}
+
+// Seen reports whether seq has already been observed for srcMAC (meaning
+// the frame looped back) and records it as seen either way. Sequence
+// numbers only ever increase per source, so "already seen" means "not
+// newer than the last one recorded".
+func (c *SeqCounter) Seen(srcMAC string, seq uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.lastSeen[srcMAC]
+	looped := ok && seq <= last
+	if !ok || seq > last {
+		c.lastSeen[srcMAC] = seq
+	}
+	return looped
+}
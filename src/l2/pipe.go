@@ -0,0 +1,133 @@
+package l2
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// Pipe is an in-memory tun.Device (golang.zx2c4.com/wireguard/tun):
+// instead of reading/writing a real kernel interface, it hands frames to
+// and from the owning dispatcher over a pair of channels. Each L2 peer's
+// *device.Device is given its own Pipe in place of a real TUN, so the
+// peer-to-peer WireGuard transport only ever sees what the dispatcher
+// chooses to forward — unicast via the FDB, or a flood.
+type Pipe struct {
+	name     string
+	mtu      int
+	outbound chan []byte // frames the dispatcher hands to WireGuard to encrypt+send
+	inbound  chan []byte // frames WireGuard has decrypted, for the dispatcher to relay
+	events   chan tun.Event
+	closed   chan struct{}
+}
+
+// NewPipe creates a Pipe. The channel depth bounds how many frames may be
+// queued before Write/Inject blocks, matching the backpressure a real NIC
+// ring buffer would apply.
+func NewPipe(name string, mtu, depth int) *Pipe {
+	if depth <= 0 {
+		depth = 256
+	}
+	return &Pipe{
+		name:     name,
+		mtu:      mtu,
+		outbound: make(chan []byte, depth),
+		inbound:  make(chan []byte, depth),
+		events:   make(chan tun.Event, 1),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Inject delivers a frame received from the shared TAP (or another peer,
+// for a flood) into the peer's WireGuard device for encryption and send.
+// It returns an error if the Pipe has been closed.
+func (p *Pipe) Inject(frame []byte) error {
+	select {
+	case <-p.closed:
+		return os.ErrClosed
+	default:
+	}
+	select {
+	case p.outbound <- frame:
+		return nil
+	case <-p.closed:
+		return os.ErrClosed
+	}
+}
+
+// Drain blocks until a frame decrypted by the peer's WireGuard device is
+// available, or the Pipe is closed.
+func (p *Pipe) Drain() ([]byte, error) {
+	select {
+	case f := <-p.inbound:
+		return f, nil
+	case <-p.closed:
+		return nil, os.ErrClosed
+	}
+}
+
+// Read implements tun.Device: it blocks for the next frame destined out to
+// WireGuard (queued via Inject) and copies it into bufs[0] starting at
+// offset.
+func (p *Pipe) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	select {
+	case f := <-p.outbound:
+		if len(bufs) == 0 {
+			return 0, errors.New("l2: Read called with no buffers")
+		}
+		n := copy(bufs[0][offset:], f)
+		sizes[0] = n
+		return 1, nil
+	case <-p.closed:
+		return 0, os.ErrClosed
+	}
+}
+
+// Write implements tun.Device: it hands each decrypted frame to the
+// dispatcher via Drain.
+func (p *Pipe) Write(bufs [][]byte, offset int) (int, error) {
+	for _, b := range bufs {
+		frame := make([]byte, len(b)-offset)
+		copy(frame, b[offset:])
+		select {
+		case p.inbound <- frame:
+		case <-p.closed:
+			return 0, os.ErrClosed
+		}
+	}
+	return len(bufs), nil
+}
+
+// File returns nil — a Pipe has no backing OS file descriptor.
+func (p *Pipe) File() *os.File { return nil }
+
+// MTU returns the configured MTU.
+func (p *Pipe) MTU() (int, error) { return p.mtu, nil }
+
+// Name returns the Pipe's label, used only for logging.
+func (p *Pipe) Name() (string, error) { return p.name, nil }
+
+// Events returns a channel that is only ever closed, never signaled —
+// a Pipe has no link-state changes of its own to report.
+func (p *Pipe) Events() <-chan tun.Event { return p.events }
+
+// BatchSize returns 1: Pipe moves one frame per Read/Write call.
+func (p *Pipe) BatchSize() int { return 1 }
+
+// Close shuts down the Pipe, unblocking any pending Read/Write/Inject/Drain.
+func (p *Pipe) Close() error {
+	select {
+	case <-p.closed:
+		return nil
+	default:
+		close(p.closed)
+		close(p.events)
+		return nil
+	}
+}
+
+// ShutdownTimeout is how long the dispatcher waits for in-flight frames to
+// drain before forcing a Pipe closed.
+const ShutdownTimeout = 2 * time.Second
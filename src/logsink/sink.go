@@ -0,0 +1,132 @@
+// Package logsink provides a mutex-guarded, runtime-reconfigurable log
+// destination for device.Logger's Verbosef/Errorf callbacks: a level and
+// output format (printf-style or structured JSON) that can be changed
+// after the logger and any devices using it already exist. Wiring this
+// into loggerRegistry and device creation lives in the main package's
+// bridge_logger.go and bridge_device.go, the same split metrics, l2, and
+// events draw between their data model and lifecycle.
+package logsink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Level mirrors device.LogLevelSilent/Error/Verbose's ordering, so a Sink
+// can be driven by the same level value callers already pass to NewLogger.
+type Level int32
+
+const (
+	LevelSilent Level = iota
+	LevelError
+	LevelVerbose
+)
+
+// Format selects how Sink renders a log line.
+type Format int32
+
+const (
+	// FormatPrintf emits one plain-text line: an RFC 3339 timestamp, the
+	// level name, and the message.
+	FormatPrintf Format = iota
+	// FormatJSON emits one JSON object per line with ts/level/device/msg,
+	// plus peer when the message contains a peer(...) token; attrs is
+	// never filled.
+	FormatJSON
+)
+
+var peerPattern = regexp.MustCompile(`peer\([^)]*\)`)
+
+// jsonEntry is one line of Sink's FormatJSON output.
+type jsonEntry struct {
+	TS     string            `json:"ts"`
+	Level  string            `json:"level"`
+	Device string            `json:"device"`
+	Peer   string            `json:"peer,omitempty"`
+	Msg    string            `json:"msg"`
+	Attrs  map[string]string `json:"attrs,omitempty"`
+}
+
+// Sink is what a *device.Logger's Verbosef/Errorf delegate to. Level and
+// format can be changed at any time via SetLevel/SetFormat, and every
+// device.Logger built from it (directly, or indirectly through a
+// deviceLoggerRedirect) observes the change immediately.
+type Sink struct {
+	mu     sync.RWMutex
+	level  Level
+	format Format
+	device string
+	out    io.Writer
+}
+
+// NewSink creates a Sink at level with FormatPrintf, writing to stdout.
+func NewSink(level Level, deviceName string) *Sink {
+	return &Sink{level: level, device: deviceName, out: os.Stdout}
+}
+
+// SetLevel changes which of Verbosef/Errorf actually emit output.
+func (s *Sink) SetLevel(l Level) {
+	s.mu.Lock()
+	s.level = l
+	s.mu.Unlock()
+}
+
+// SetFormat switches between printf-style and structured JSON output.
+func (s *Sink) SetFormat(f Format) {
+	s.mu.Lock()
+	s.format = f
+	s.mu.Unlock()
+}
+
+// SetDevice updates the "device" field future JSON lines report, since a
+// logger handle can be attached to more than one device over its life.
+func (s *Sink) SetDevice(name string) {
+	s.mu.Lock()
+	s.device = name
+	s.mu.Unlock()
+}
+
+// Verbosef renders a log line at LevelVerbose; suppressed below that level.
+func (s *Sink) Verbosef(format string, args ...any) {
+	s.emit(LevelVerbose, "verbose", format, args...)
+}
+
+// Errorf renders a log line at LevelError; suppressed at LevelSilent.
+func (s *Sink) Errorf(format string, args ...any) {
+	s.emit(LevelError, "error", format, args...)
+}
+
+func (s *Sink) emit(msgLevel Level, levelName, format string, args ...any) {
+	s.mu.RLock()
+	configured, wireFormat, device, out := s.level, s.format, s.device, s.out
+	s.mu.RUnlock()
+
+	if configured < msgLevel {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+
+	if wireFormat != FormatJSON {
+		fmt.Fprintf(out, "%s %s: %s\n", time.Now().Format(time.RFC3339), levelName, msg)
+		return
+	}
+
+	entry := jsonEntry{
+		TS:     time.Now().Format(time.RFC3339),
+		Level:  levelName,
+		Device: device,
+		Peer:   peerPattern.FindString(msg),
+		Msg:    msg,
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(out, string(b))
+}
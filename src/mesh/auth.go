@@ -0,0 +1,22 @@
+package mesh
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// sign returns the hex-encoded HMAC-SHA256 of data under token — the
+// shared secret Server and Client authenticate each other's requests
+// with. An empty token disables authentication (single-node or
+// trusted-network deployments that never configure one).
+func sign(token string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify reports whether sig is the correct signature of data under token.
+func verify(token string, data []byte, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(sign(token, data)))
+}
@@ -0,0 +1,187 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wireguard-go-bridge/db"
+)
+
+// Peer is one remote mesh node Client pulls changes from.
+type Peer struct {
+	Name string // diagnostic label for Status(), e.g. the node's own NodeID
+	URL  string // base URL, e.g. "https://10.8.0.2:9100"
+}
+
+// Client periodically pulls each configured Peer's change_log and applies
+// the entries it hasn't seen yet via db.BridgeDB.ApplyRemoteChange. It
+// never pushes — /mesh/push exists for a node (or an operator's tooling)
+// that wants to proactively send changes instead of waiting to be pulled,
+// but Client's own sync loop is pull-only, which keeps the loop-prevention
+// story simple: a node only ever writes to its own change_log (locally-
+// originated mutations, and remote ones it pulled and applied), never in
+// reaction to serving a pull.
+type Client struct {
+	bdb      *db.BridgeDB
+	token    string
+	peers    []Peer
+	interval time.Duration
+	http     *http.Client
+
+	mu       sync.Mutex
+	cursors  map[string]int64
+	lastSync map[string]time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewClient builds a Client that syncs from peers every intervalSec
+// seconds (defaulting to 30 if <= 0). token must match the Token each
+// Peer's Server was built with. Every Peer.URL must be https:// — the
+// HMAC token authenticates the request but doesn't encrypt it, and
+// change_log payloads carry peer private keys/PSKs in the clear over the
+// wire (see db.insertClientPayload), so a plain http:// peer would leak
+// them to anyone on-path.
+func NewClient(bdb *db.BridgeDB, token string, peers []Peer, intervalSec int) (*Client, error) {
+	for _, p := range peers {
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			return nil, fmt.Errorf("peer %s: parse url: %w", p.Name, err)
+		}
+		if u.Scheme != "https" {
+			return nil, fmt.Errorf("peer %s: url must use https://, got %q", p.Name, u.Scheme)
+		}
+	}
+	if intervalSec <= 0 {
+		intervalSec = 30
+	}
+	return &Client{
+		bdb:      bdb,
+		token:    token,
+		peers:    peers,
+		interval: time.Duration(intervalSec) * time.Second,
+		http:     &http.Client{Timeout: 10 * time.Second},
+		cursors:  make(map[string]int64),
+		lastSync: make(map[string]time.Time),
+	}, nil
+}
+
+// Start runs the sync loop in the background until Stop is called.
+func (c *Client) Start() {
+	c.stop = make(chan struct{})
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			c.syncOnce()
+			select {
+			case <-ticker.C:
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the sync loop and waits for the in-flight round to finish.
+func (c *Client) Stop() {
+	if c.stop == nil {
+		return
+	}
+	close(c.stop)
+	c.wg.Wait()
+}
+
+func (c *Client) syncOnce() {
+	for _, p := range c.peers {
+		c.pullFrom(p)
+	}
+}
+
+func (c *Client) pullFrom(p Peer) {
+	c.mu.Lock()
+	since := c.cursors[p.Name]
+	c.mu.Unlock()
+
+	reqURL := strings.TrimRight(p.URL, "/") + "/mesh/changes?since=" + strconv.FormatInt(since, 10)
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return
+	}
+	if c.token != "" {
+		req.Header.Set("X-Mesh-Signature", sign(c.token, []byte(req.URL.RequestURI())))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	maxID := since
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e db.ChangeLogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		if err := c.bdb.ApplyRemoteChange(e); err != nil {
+			continue
+		}
+		if e.ID > maxID {
+			maxID = e.ID
+		}
+	}
+
+	c.mu.Lock()
+	c.cursors[p.Name] = maxID
+	c.lastSync[p.Name] = time.Now()
+	c.mu.Unlock()
+}
+
+// PeerStatus is Status's per-peer diagnostic: how far this node's
+// replication cursor has advanced against one peer, and how long ago that
+// last succeeded.
+type PeerStatus struct {
+	Name     string `json:"name"`
+	Cursor   int64  `json:"cursor"`
+	LastSync *int64 `json:"last_sync,omitempty"` // unix seconds
+	LagSec   *int64 `json:"lag_sec,omitempty"`   // seconds since LastSync
+}
+
+// Status reports per-peer sync lag, for a management UI or health check.
+func (c *Client) Status() []PeerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	out := make([]PeerStatus, 0, len(c.peers))
+	for _, p := range c.peers {
+		st := PeerStatus{Name: p.Name, Cursor: c.cursors[p.Name]}
+		if t, ok := c.lastSync[p.Name]; ok {
+			unix := t.Unix()
+			lag := int64(now.Sub(t).Seconds())
+			st.LastSync = &unix
+			st.LagSec = &lag
+		}
+		out = append(out, st)
+	}
+	return out
+}
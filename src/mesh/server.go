@@ -0,0 +1,138 @@
+// Package mesh replicates peer state across bridge-db instances over
+// HTTP, so several bridge nodes can share one logical set of clients
+// instead of each owning its own, in the spirit of EtherGuard-VPN's
+// super-node peer-state convergence. Every node appends its own local
+// mutations to db.ChangeLog; Server exposes that log to other nodes and
+// Client periodically pulls from configured peers and applies what it's
+// missing via db.BridgeDB.ApplyRemoteChange. Unlike metrics/l2, which keep
+// HTTP listening or device lifecycle in the main package's
+// bridge_<name>.go, Server owns its HTTP endpoints directly — there's no
+// device handle to split out, just change_log replication against a
+// *db.BridgeDB.
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wireguard-go-bridge/db"
+)
+
+// Server exposes one bridge-db's change_log to other mesh nodes over
+// HTTP: GET /mesh/changes?since=N (newline-delimited JSON of
+// db.ChangeLogEntry, oldest first) and POST /mesh/push (the same format,
+// applied via ApplyRemoteChange). Both are authenticated with an HMAC
+// token shared out of band with the calling node.
+type Server struct {
+	bdb    *db.BridgeDB
+	token  string
+	server *http.Server
+}
+
+// NewServer builds a Server backed by bdb. token is the shared HMAC
+// secret; pass "" to disable authentication.
+func NewServer(bdb *db.BridgeDB, token string) *Server {
+	return &Server{bdb: bdb, token: token}
+}
+
+// Start launches the HTTP listener in the background and returns once it's
+// either bound or failed to — mirrors metrics.Collector.Start's pattern for
+// detecting an immediate bind failure (e.g. port already in use) without
+// blocking forever on a successful ListenAndServe, which never returns.
+func (s *Server) Start(listenAddr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mesh/changes", s.handleChanges)
+	mux.HandleFunc("/mesh/push", s.handlePush)
+	s.server = &http.Server{Addr: listenAddr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.server.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("mesh: listen %s: %w", listenAddr, err)
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+// Stop closes the HTTP listener.
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r, []byte(r.URL.RequestURI())) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	entries, err := s.bdb.ChangesSince(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if !s.authorized(r, body) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e db.ChangeLogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			http.Error(w, "bad entry: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.bdb.ApplyRemoteChange(e); err != nil {
+			http.Error(w, "apply: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) authorized(r *http.Request, data []byte) bool {
+	if s.token == "" {
+		return true
+	}
+	return verify(s.token, data, r.Header.Get("X-Mesh-Signature"))
+}
@@ -0,0 +1,244 @@
+// Package metrics translates WireGuard device/peer state into
+// Prometheus exposition-format text, so operators can scrape the bridge
+// directly instead of polling UAPI from the Python daemon.
+//
+// This package holds only the scrape/render model; HTTP listener
+// lifecycle tied to a caller-supplied device handle lives in the main
+// package's bridge_metrics.go, the same split l2 draws between its data
+// model and bridge_l2.go's device lifecycle.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is what a Collector needs scraped from the device each tick.
+type Snapshot struct {
+	IpcOutput   string // raw device.IpcGet() output
+	IsUnderLoad bool
+	BatchSize   int
+}
+
+// ScrapeFunc retrieves one Snapshot from the live device.
+type ScrapeFunc func() (Snapshot, error)
+
+// peerMetrics is the parsed state for one peer as of the last scrape.
+type peerMetrics struct {
+	endpoint            string
+	lastHandshake       int64
+	rxBytes             int64
+	txBytes             int64
+	persistentKeepalive int64
+}
+
+// Collector periodically scrapes a device and renders Prometheus text,
+// plus exposes push-based counters for events IpcGet can't see directly
+// (handshake initiations/responses, cookie MAC1/MAC2 failures).
+type Collector struct {
+	scrape   ScrapeFunc
+	interval time.Duration
+
+	mu          sync.RWMutex
+	peers       map[string]peerMetrics
+	isUnderLoad bool
+	batchSize   int
+
+	handshakeEvents    atomic.Int64
+	cookieMAC1Failures atomic.Int64
+	cookieMAC2Failures atomic.Int64
+
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	server *http.Server
+}
+
+// NewCollector creates a Collector. intervalSec <= 0 defaults to 5s.
+func NewCollector(scrape ScrapeFunc, intervalSec int) *Collector {
+	if intervalSec <= 0 {
+		intervalSec = 5
+	}
+	return &Collector{
+		scrape:   scrape,
+		interval: time.Duration(intervalSec) * time.Second,
+		peers:    make(map[string]peerMetrics),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins the scrape loop and, if listenAddr is non-empty, serves
+// the rendered text at GET /metrics on listenAddr.
+func (c *Collector) Start(listenAddr string) error {
+	c.scrapeOnce() // seed state so an immediate scrape isn't empty
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.scrapeOnce()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+
+	if listenAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(c.Render()))
+	})
+	c.server = &http.Server{Addr: listenAddr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.server.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("metrics listen %s: %w", listenAddr, err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		// Server is up and blocking in Serve(); this is the expected path.
+	}
+	return nil
+}
+
+// Stop halts the scrape loop and, if running, the HTTP listener.
+func (c *Collector) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+	if c.server != nil {
+		_ = c.server.Close()
+	}
+}
+
+// IncHandshakeEvent records one observed handshake initiation/response.
+func (c *Collector) IncHandshakeEvent() { c.handshakeEvents.Add(1) }
+
+// IncCookieMAC1Failure records one CookieChecker.CheckMAC1 rejection.
+func (c *Collector) IncCookieMAC1Failure() { c.cookieMAC1Failures.Add(1) }
+
+// IncCookieMAC2Failure records one CookieChecker.CheckMAC2 rejection.
+func (c *Collector) IncCookieMAC2Failure() { c.cookieMAC2Failures.Add(1) }
+
+// scrapeOnce pulls one Snapshot and updates the rendered state. A
+// handshake-initiation/response counter isn't available as a direct
+// device hook, so it's derived the same way as the prior stats
+// infrastructure derives handshake events: a change in a peer's
+// last_handshake_time_sec between scrapes.
+func (c *Collector) scrapeOnce() {
+	snap, err := c.scrape()
+	if err != nil {
+		return
+	}
+	peers := parseIpcGetPeers(snap.IpcOutput)
+
+	c.mu.Lock()
+	for pk, p := range peers {
+		if prev, ok := c.peers[pk]; ok && p.lastHandshake > prev.lastHandshake {
+			c.handshakeEvents.Add(1)
+		}
+	}
+	c.peers = peers
+	c.isUnderLoad = snap.IsUnderLoad
+	c.batchSize = snap.BatchSize
+	c.mu.Unlock()
+}
+
+// Render returns the current state as Prometheus exposition-format text.
+func (c *Collector) Render() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# TYPE wireguard_device_is_under_load gauge\nwireguard_device_is_under_load %d\n", boolToInt(c.isUnderLoad))
+	fmt.Fprintf(&b, "# TYPE wireguard_device_batch_size gauge\nwireguard_device_batch_size %d\n", c.batchSize)
+	fmt.Fprintf(&b, "# TYPE wireguard_handshake_events_total counter\nwireguard_handshake_events_total %d\n", c.handshakeEvents.Load())
+	fmt.Fprintf(&b, "# TYPE wireguard_cookie_mac1_failures_total counter\nwireguard_cookie_mac1_failures_total %d\n", c.cookieMAC1Failures.Load())
+	fmt.Fprintf(&b, "# TYPE wireguard_cookie_mac2_failures_total counter\nwireguard_cookie_mac2_failures_total %d\n", c.cookieMAC2Failures.Load())
+
+	b.WriteString("# TYPE wireguard_peer_rx_bytes counter\n")
+	for pk, p := range c.peers {
+		fmt.Fprintf(&b, "wireguard_peer_rx_bytes{pubkey=%q,endpoint=%q} %d\n", pk, p.endpoint, p.rxBytes)
+	}
+	b.WriteString("# TYPE wireguard_peer_tx_bytes counter\n")
+	for pk, p := range c.peers {
+		fmt.Fprintf(&b, "wireguard_peer_tx_bytes{pubkey=%q,endpoint=%q} %d\n", pk, p.endpoint, p.txBytes)
+	}
+	b.WriteString("# TYPE wireguard_peer_last_handshake_time_seconds gauge\n")
+	for pk, p := range c.peers {
+		fmt.Fprintf(&b, "wireguard_peer_last_handshake_time_seconds{pubkey=%q} %d\n", pk, p.lastHandshake)
+	}
+	b.WriteString("# TYPE wireguard_peer_persistent_keepalive_interval gauge\n")
+	for pk, p := range c.peers {
+		fmt.Fprintf(&b, "wireguard_peer_persistent_keepalive_interval{pubkey=%q} %d\n", pk, p.persistentKeepalive)
+	}
+
+	return b.String()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// parseIpcGetPeers parses device.IpcGet() output into per-peer metrics.
+func parseIpcGetPeers(output string) map[string]peerMetrics {
+	peers := make(map[string]peerMetrics)
+	var currentKey string
+	var current peerMetrics
+
+	flush := func() {
+		if currentKey != "" {
+			peers[currentKey] = current
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := parts[0], parts[1]
+
+		switch key {
+		case "public_key":
+			flush()
+			currentKey = val
+			current = peerMetrics{}
+		case "endpoint":
+			current.endpoint = val
+		case "last_handshake_time_sec":
+			current.lastHandshake, _ = strconv.ParseInt(val, 10, 64)
+		case "rx_bytes":
+			current.rxBytes, _ = strconv.ParseInt(val, 10, 64)
+		case "tx_bytes":
+			current.txBytes, _ = strconv.ParseInt(val, 10, 64)
+		case "persistent_keepalive_interval":
+			current.persistentKeepalive, _ = strconv.ParseInt(val, 10, 64)
+		}
+	}
+	flush()
+	return peers
+}
@@ -10,8 +10,12 @@
 // Policy routing (managed by firewall_bridge) uses these marks
 // to direct traffic through the correct chain.
 //
-// This package provides the data model — actual device creation
-// is handled by bridge.State, routing by firewall_bridge via daemon-db.
+// This package provides the data model plus Manager, which brings up one
+// WireGuard device per Hop and supervises them (see manager.go). Policy
+// routing itself — the ip-rule/routing-table plumbing that gets a marked
+// packet to the right hop's egress — is still applied externally by
+// firewall_bridge via daemon-db; Manager only guarantees every hop ends up
+// with a distinct fwmark for it to key off of.
 package multihop
 
 // Hop represents a single node in a multihop chain.
@@ -20,6 +24,7 @@ type Hop struct {
 	Role       string `json:"role"`        // 'entry', 'relay', 'exit'
 	Interface  string `json:"interface"`   // 'wg-hop0', 'wg-hop1'
 	ListenPort int    `json:"listen_port"`
+	PrivateKey string `json:"private_key,omitempty"` // our key for this hop; Manager.Up generates one if empty
 	FWMark     int    `json:"fwmark"`      // SO_MARK for policy routing
 	Endpoint   string `json:"endpoint"`    // remote endpoint for this hop
 	PublicKey  string `json:"public_key"`  // remote peer public key
@@ -0,0 +1,367 @@
+package multihop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+
+	"wireguard-go-bridge/core"
+)
+
+// baseFWMark is where Up starts auto-allocating fwmarks for hops that don't
+// already have one set in their Chain, counting up by hop index so a
+// chain's marks never collide with each other. Policy routing itself (the
+// `ip rule`/routing-table plumbing that gets a marked packet to the right
+// hop's egress) is applied externally — see the package doc — Up only
+// guarantees every hop in the chain ends up with a distinct mark.
+const baseFWMark = 51000
+
+// fwmarkRegistry tracks every fwmark currently reserved by any Manager in
+// this process, across however many chains are concurrently up (ChainUp
+// gives each call its own Manager). fwmarks are a process-wide (really
+// OS-wide, via SO_MARK) resource, not scoped to one chain, so allocation
+// has to be tracked at that scope too — otherwise two chains brought up
+// without explicit FWMarks both start counting from baseFWMark and collide,
+// scrambling policy routing between them.
+var (
+	fwmarkRegistry   = make(map[int]bool)
+	fwmarkRegistryMu sync.Mutex
+)
+
+// reserveFWMark claims mark for the caller, reporting false if it's already
+// reserved by another Manager.
+func reserveFWMark(mark int) bool {
+	fwmarkRegistryMu.Lock()
+	defer fwmarkRegistryMu.Unlock()
+	if fwmarkRegistry[mark] {
+		return false
+	}
+	fwmarkRegistry[mark] = true
+	return true
+}
+
+// allocateFWMark reserves and returns the lowest fwmark at or above
+// baseFWMark not already reserved by another Manager.
+func allocateFWMark() int {
+	fwmarkRegistryMu.Lock()
+	defer fwmarkRegistryMu.Unlock()
+	for mark := baseFWMark; ; mark++ {
+		if !fwmarkRegistry[mark] {
+			fwmarkRegistry[mark] = true
+			return mark
+		}
+	}
+}
+
+// releaseFWMarks frees marks previously claimed via reserveFWMark/
+// allocateFWMark, so a torn-down chain's marks become available again.
+func releaseFWMarks(marks []int) {
+	fwmarkRegistryMu.Lock()
+	defer fwmarkRegistryMu.Unlock()
+	for _, mark := range marks {
+		delete(fwmarkRegistry, mark)
+	}
+}
+
+// handshakeStaleAfter is how long a hop can go without a fresh handshake
+// before the recovery loop re-triggers it alone: device.RekeyAfterTime is
+// when wireguard-go itself starts rekeying and device.KeepaliveTimeout is
+// how long it then waits for a response, so anything past their sum means
+// the hop has gone quiet even by wireguard-go's own clock.
+const handshakeStaleAfter = device.RekeyAfterTime + device.KeepaliveTimeout
+
+// recoveryInterval is how often Manager's background goroutine checks
+// every hop's handshake for staleness.
+const recoveryInterval = 15 * time.Second
+
+// hopDevice is one running hop: the WireGuard device and TUN Up created for
+// it, plus the Hop config it was brought up from (kept so the recovery loop
+// can rebuild it later without the caller re-supplying the chain).
+type hopDevice struct {
+	hop    Hop
+	device *device.Device
+	tun    tun.Device
+}
+
+// HopStatus is one hop's live state, as returned by Manager.Status.
+type HopStatus struct {
+	Name              string `json:"name"`
+	Role              string `json:"role"`
+	Interface         string `json:"interface"`
+	FWMark            int    `json:"fwmark"`
+	RxBytes           int64  `json:"rx_bytes"`
+	TxBytes           int64  `json:"tx_bytes"`
+	LastHandshakeTime int64  `json:"last_handshake_time,omitempty"`
+	Stalled           bool   `json:"stalled"`
+}
+
+// Manager brings up, tears down, and supervises every device.Device in a
+// Chain. Device creation lives here rather than on bridge.State because a
+// chain's hops are siblings wired to each other by fwmark, not layered
+// under one primary device the way bridge.State's own client/multihop
+// tunnels are — they need their own atomic up/down and their own
+// per-hop recovery loop instead of sharing bridge.State's.
+type Manager struct {
+	mu      sync.Mutex
+	chain   Chain
+	hops    []*hopDevice
+	fwmarks []int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Up brings up one WireGuard device per hop in chain, in order. Any hop
+// without an explicit FWMark gets one auto-allocated from baseFWMark,
+// reserved process-wide via fwmarkRegistry so it can't collide with
+// another concurrently-running chain's hop; a hop with an explicit FWMark
+// is reserved the same way instead of trusted blindly, so two chains can't
+// collide on a hand-picked mark either. Any hop without a PrivateKey gets a
+// fresh one generated, mirroring how bridge.State.CreateMultihopTunnel
+// auto-generates its own tunnel's keys. If any hop fails, every hop already
+// brought up is torn down before returning, so a partially-built chain is
+// never left running. The returned Manager's Chain() reflects the
+// fwmarks/keys actually used, so the caller can persist it.
+func Up(chain Chain) (*Manager, error) {
+	m := &Manager{chain: chain}
+	for i := range m.chain.Hops {
+		h := &m.chain.Hops[i]
+		if h.FWMark == 0 {
+			h.FWMark = allocateFWMark()
+		} else if !reserveFWMark(h.FWMark) {
+			m.teardown()
+			return nil, fmt.Errorf("hop %s: fwmark %d already in use by another chain", h.Name, h.FWMark)
+		}
+		m.fwmarks = append(m.fwmarks, h.FWMark)
+		if h.PrivateKey == "" {
+			privKey, err := core.GeneratePrivateKey()
+			if err != nil {
+				m.teardown()
+				return nil, fmt.Errorf("hop %s: keygen: %w", h.Name, err)
+			}
+			h.PrivateKey = privKey
+		}
+
+		hd, err := bringUpHop(*h)
+		if err != nil {
+			m.teardown()
+			return nil, fmt.Errorf("hop %s: %w", h.Name, err)
+		}
+		m.hops = append(m.hops, hd)
+	}
+
+	m.startRecovery()
+	return m, nil
+}
+
+// bringUpHop creates h's TUN and WireGuard device, binds its egress socket
+// to h.FWMark via SO_MARK, configures its single upstream peer, and brings
+// the device up.
+func bringUpHop(h Hop) (*hopDevice, error) {
+	tunDev, err := tun.CreateTUN(h.Interface, device.DefaultMTU)
+	if err != nil {
+		return nil, fmt.Errorf("tun: %w", err)
+	}
+
+	logger := device.NewLogger(device.LogLevelError, "("+h.Interface+") ")
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+	if dev == nil {
+		_ = tunDev.Close()
+		return nil, fmt.Errorf("device create")
+	}
+
+	if err := dev.BindSetMark(uint32(h.FWMark)); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("bind set mark: %w", err)
+	}
+
+	ipcConfig := fmt.Sprintf("private_key=%s\n", h.PrivateKey)
+	if h.ListenPort > 0 {
+		ipcConfig += fmt.Sprintf("listen_port=%d\n", h.ListenPort)
+	}
+	if h.PublicKey != "" {
+		ipcConfig += fmt.Sprintf("public_key=%s\nendpoint=%s\nallowed_ip=0.0.0.0/0\npersistent_keepalive_interval=25\n",
+			h.PublicKey, h.Endpoint)
+	}
+	if err := dev.IpcSet(ipcConfig); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("ipc set: %w", err)
+	}
+
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("up: %w", err)
+	}
+
+	return &hopDevice{hop: h, device: dev, tun: tunDev}, nil
+}
+
+// Chain returns the chain this Manager is running, with the fwmarks and
+// keys Up actually assigned filled in.
+func (m *Manager) Chain() Chain {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.chain
+}
+
+// Down stops the recovery loop and closes every hop's device, in reverse
+// hop order (exit first, entry last) so a hop is never closed while
+// something downstream of it might still be using its tun as a route.
+func (m *Manager) Down() {
+	m.mu.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	hops := m.hops
+	m.hops = nil
+	m.mu.Unlock()
+
+	m.wg.Wait()
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hops[i].device.Close()
+	}
+	releaseFWMarks(m.fwmarks)
+	m.fwmarks = nil
+}
+
+// teardown closes whatever hops Up has brought up so far, used when a
+// later hop in the chain fails to come up.
+func (m *Manager) teardown() {
+	for i := len(m.hops) - 1; i >= 0; i-- {
+		m.hops[i].device.Close()
+	}
+	m.hops = nil
+	releaseFWMarks(m.fwmarks)
+	m.fwmarks = nil
+}
+
+// Status returns every hop's live counters and handshake staleness, pulled
+// from its device's IpcGet.
+func (m *Manager) Status() []HopStatus {
+	m.mu.Lock()
+	hops := make([]*hopDevice, len(m.hops))
+	copy(hops, m.hops)
+	m.mu.Unlock()
+
+	out := make([]HopStatus, 0, len(hops))
+	for _, hd := range hops {
+		out = append(out, hopStatus(hd))
+	}
+	return out
+}
+
+func hopStatus(hd *hopDevice) HopStatus {
+	st := HopStatus{
+		Name:      hd.hop.Name,
+		Role:      hd.hop.Role,
+		Interface: hd.hop.Interface,
+		FWMark:    hd.hop.FWMark,
+	}
+	output, err := hd.device.IpcGet()
+	if err != nil {
+		return st
+	}
+	sample := parseSinglePeerDump(output)
+	st.RxBytes = sample.rxBytes
+	st.TxBytes = sample.txBytes
+	if sample.lastHandshake != 0 {
+		st.LastHandshakeTime = sample.lastHandshake
+	}
+	st.Stalled = sample.lastHandshake == 0 ||
+		time.Since(time.Unix(sample.lastHandshake, 0)) > handshakeStaleAfter
+	return st
+}
+
+// startRecovery starts the background goroutine that re-triggers any hop
+// whose handshake has gone stale, without touching the rest of the chain.
+func (m *Manager) startRecovery() {
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(recoveryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.recoverStaleHops()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// recoverStaleHops restarts each hop whose handshake looks stale, one at a
+// time, leaving every other hop in the chain running.
+func (m *Manager) recoverStaleHops() {
+	m.mu.Lock()
+	hops := make([]*hopDevice, len(m.hops))
+	copy(hops, m.hops)
+	m.mu.Unlock()
+
+	for i, hd := range hops {
+		if !hopStatus(hd).Stalled {
+			continue
+		}
+		// The old device still holds the hop's TUN name and listen port,
+		// so it is closed before the replacement is brought up.
+		hd.device.Close()
+		newHd, err := bringUpHop(hd.hop)
+		if err != nil {
+			continue
+		}
+
+		m.mu.Lock()
+		if i < len(m.hops) && m.hops[i] == hd {
+			m.hops[i] = newHd
+		} else {
+			// The chain was torn down or reordered while we were
+			// restarting this hop — don't resurrect it into a
+			// Manager that's no longer tracking it.
+			newHd.device.Close()
+		}
+		m.mu.Unlock()
+	}
+}
+
+// singlePeerSample is one hop's upstream counters, parsed from its
+// device's IpcGet dump. Unlike bridge's multi-candidate multihop tunnels, a
+// chain hop has exactly one upstream peer, so there's no need for the
+// per-public-key map bridge/multihop_stats.go keeps.
+type singlePeerSample struct {
+	rxBytes       int64
+	txBytes       int64
+	lastHandshake int64
+}
+
+func parseSinglePeerDump(output string) singlePeerSample {
+	var s singlePeerSample
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "last_handshake_time_sec":
+			if v, err := strconv.ParseInt(parts[1], 10, 64); err == nil && v > 0 {
+				s.lastHandshake = v
+			}
+		case "rx_bytes":
+			s.rxBytes, _ = strconv.ParseInt(parts[1], 10, 64)
+		case "tx_bytes":
+			s.txBytes, _ = strconv.ParseInt(parts[1], 10, 64)
+		}
+	}
+	return s
+}
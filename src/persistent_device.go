@@ -20,12 +20,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	"golang.zx2c4.com/wireguard/conn"
 	"golang.zx2c4.com/wireguard/device"
 	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
 )
 
 // persistentDevice wraps a WireGuard device with automatic IPC state persistence.
@@ -35,6 +37,50 @@ type persistentDevice struct {
 	db  *sql.DB
 }
 
+// persistentDeviceID is the singleton devices row id this process's own
+// device persists under — one persistentDevice per state DB file, the same
+// "id=1 singleton row" convention db/server.go's server_config and
+// db/active_chain.go's active_chain tables use.
+const persistentDeviceID = 1
+
+// migratePersistentDeviceSchema creates the normalized device/peer state
+// tables if they don't already exist: devices holds the one settable,
+// non-peer IPC fields (private key, listen port, fwmark); peers and
+// allowed_ips hold one row per peer and per allowed-ip respectively, so a
+// caller can query a specific peer's counters or list every allowed-ip
+// without re-parsing an IpcGet dump.
+func migratePersistentDeviceSchema(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS devices (
+	id          INTEGER PRIMARY KEY,
+	private_key TEXT NOT NULL,
+	listen_port INTEGER NOT NULL DEFAULT 0,
+	fwmark      INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS peers (
+	id                   INTEGER PRIMARY KEY AUTOINCREMENT,
+	device_id            INTEGER NOT NULL,
+	public_key           TEXT NOT NULL,
+	preshared_key        TEXT NOT NULL DEFAULT '',
+	endpoint             TEXT NOT NULL DEFAULT '',
+	persistent_keepalive INTEGER NOT NULL DEFAULT 0,
+	last_handshake_sec   INTEGER NOT NULL DEFAULT 0,
+	last_handshake_nsec  INTEGER NOT NULL DEFAULT 0,
+	rx_bytes             INTEGER NOT NULL DEFAULT 0,
+	tx_bytes             INTEGER NOT NULL DEFAULT 0,
+	UNIQUE(device_id, public_key)
+);
+
+CREATE TABLE IF NOT EXISTS allowed_ips (
+	peer_id INTEGER NOT NULL,
+	cidr    TEXT NOT NULL,
+	UNIQUE(peer_id, cidr)
+);
+`)
+	return err
+}
+
 // newPersistentDevice creates a TUN device, WireGuard device, opens the state DB,
 // and restores previous IPC state if available. DB must already exist.
 func newPersistentDevice(ifname string, mtu int, dbPath string) (*persistentDevice, error) {
@@ -47,6 +93,10 @@ func newPersistentDevice(ifname string, mtu int, dbPath string) (*persistentDevi
 		_ = db.Close()
 		return nil, fmt.Errorf("ping state db: %w", err)
 	}
+	if err := migratePersistentDeviceSchema(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migrate state db: %w", err)
+	}
 
 	// Create TUN + WireGuard device
 	tunDev, err := tun.CreateTUN(ifname, mtu)
@@ -75,6 +125,57 @@ func newPersistentDevice(ifname string, mtu int, dbPath string) (*persistentDevi
 	return pd, nil
 }
 
+// newPersistentDeviceNetstack is newPersistentDevice's userspace-TUN
+// counterpart: it binds a gVisor netstack to localAddrsCSV (see
+// parseNetstackAddrs) instead of opening a kernel TUN, so a persisted
+// device can be restored the same way on platforms without /dev/net/tun.
+func newPersistentDeviceNetstack(ifname, localAddrsCSV string, mtu int, dbPath string) (*persistentDevice, error) {
+	addrs, err := parseNetstackAddrs(localAddrsCSV)
+	if err != nil || len(addrs) == 0 {
+		return nil, fmt.Errorf("parse netstack addrs: %w", err)
+	}
+
+	// Open state DB
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("open state db: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ping state db: %w", err)
+	}
+	if err := migratePersistentDeviceSchema(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("migrate state db: %w", err)
+	}
+
+	// Create netstack TUN + WireGuard device
+	tunDev, _, err := netstack.CreateNetTUN(addrs, nil, mtu)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create netstack tun: %w", err)
+	}
+
+	logger := device.NewLogger(device.LogLevelError, "("+ifname+") ")
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+	if dev == nil {
+		_ = tunDev.Close()
+		_ = db.Close()
+		return nil, fmt.Errorf("create device")
+	}
+
+	pd := &persistentDevice{dev: dev, tun: tunDev, db: db}
+
+	// Restore previous state if exists
+	if err := pd.restore(); err != nil {
+		dev.Close()
+		_ = db.Close()
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+
+	return pd, nil
+}
+
 // ipcSet applies config to the device and persists the full state.
 func (pd *persistentDevice) ipcSet(config string) error {
 	if err := pd.dev.IpcSet(config); err != nil {
@@ -88,51 +189,191 @@ func (pd *persistentDevice) ipcGet() (string, error) {
 	return pd.dev.IpcGet()
 }
 
-// persist writes the settable IpcGet state to the state DB.
-// Filters out read-only fields that IpcSet rejects.
+// persist parses the current IpcGet dump into ipcDeviceRow/ipcPeerRow and
+// writes it to the devices/peers/allowed_ips tables inside one transaction,
+// replacing whatever this device previously persisted — the structured
+// analogue of the single-TEXT-blob ipc_state row this used to write.
 func (pd *persistentDevice) persist() error {
 	dump, err := pd.dev.IpcGet()
 	if err != nil {
 		return fmt.Errorf("ipc get: %w", err)
 	}
-	filtered := filterIpcDump(dump)
-	_, err = pd.db.Exec(
-		"INSERT OR REPLACE INTO ipc_state (id, dump) VALUES (1, ?)", filtered)
-	return err
+	row := parseIpcDump(dump)
+
+	tx, err := pd.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO devices (id, private_key, listen_port, fwmark) VALUES (?, ?, ?, ?)",
+		persistentDeviceID, row.privateKey, row.listenPort, row.fwmark,
+	); err != nil {
+		return fmt.Errorf("persist device: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM allowed_ips WHERE peer_id IN (SELECT id FROM peers WHERE device_id = ?)",
+		persistentDeviceID,
+	); err != nil {
+		return fmt.Errorf("clear allowed ips: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM peers WHERE device_id = ?", persistentDeviceID); err != nil {
+		return fmt.Errorf("clear peers: %w", err)
+	}
+
+	for _, p := range row.peers {
+		res, err := tx.Exec(
+			`INSERT INTO peers (device_id, public_key, preshared_key, endpoint, persistent_keepalive,
+				last_handshake_sec, last_handshake_nsec, rx_bytes, tx_bytes)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			persistentDeviceID, p.publicKey, p.presharedKey, p.endpoint, p.persistentKeepalive,
+			p.lastHandshakeSec, p.lastHandshakeNsec, p.rxBytes, p.txBytes,
+		)
+		if err != nil {
+			return fmt.Errorf("persist peer %s: %w", p.publicKey, err)
+		}
+		peerID, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("peer id: %w", err)
+		}
+		for _, cidr := range p.allowedIPs {
+			if _, err := tx.Exec(
+				"INSERT INTO allowed_ips (peer_id, cidr) VALUES (?, ?)", peerID, cidr,
+			); err != nil {
+				return fmt.Errorf("persist allowed ip %s: %w", cidr, err)
+			}
+		}
+	}
+
+	return tx.Commit()
 }
 
-// filterIpcDump removes read-only fields from IpcGet output
-// so the dump can be fed back into IpcSet without errors.
-func filterIpcDump(dump string) string {
-	var result []byte
+// ipcPeerRow is one peer block parsed out of an IpcGet dump.
+type ipcPeerRow struct {
+	publicKey           string
+	presharedKey        string
+	endpoint            string
+	persistentKeepalive int
+	lastHandshakeSec    int64
+	lastHandshakeNsec   int64
+	rxBytes             int64
+	txBytes             int64
+	allowedIPs          []string
+}
+
+// ipcDeviceRow is an IpcGet dump parsed into its device-level fields plus
+// every peer block, in the order IpcGet reported them.
+type ipcDeviceRow struct {
+	privateKey string
+	listenPort int
+	fwmark     int
+	peers      []ipcPeerRow
+}
+
+// parseIpcDump walks dump line by line: device-level fields (private_key,
+// listen_port, fwmark) come first, then each public_key= line starts a new
+// peer block that collects fields up to the next public_key= or EOF, the
+// same layout device.Device.IpcGetOperation writes.
+func parseIpcDump(dump string) ipcDeviceRow {
+	var row ipcDeviceRow
+	var peer *ipcPeerRow
+
 	for _, line := range strings.Split(dump, "\n") {
-		if strings.HasPrefix(line, "last_handshake_time_sec=") ||
-			strings.HasPrefix(line, "last_handshake_time_nsec=") ||
-			strings.HasPrefix(line, "rx_bytes=") ||
-			strings.HasPrefix(line, "tx_bytes=") ||
-			strings.HasPrefix(line, "protocol_version=") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
 			continue
 		}
-		result = append(result, line...)
-		result = append(result, '\n')
+		switch key {
+		case "private_key":
+			row.privateKey = value
+		case "listen_port":
+			row.listenPort, _ = strconv.Atoi(value)
+		case "fwmark":
+			row.fwmark, _ = strconv.Atoi(value)
+		case "public_key":
+			row.peers = append(row.peers, ipcPeerRow{publicKey: value})
+			peer = &row.peers[len(row.peers)-1]
+		case "preshared_key":
+			if peer != nil {
+				peer.presharedKey = value
+			}
+		case "endpoint":
+			if peer != nil {
+				peer.endpoint = value
+			}
+		case "persistent_keepalive_interval":
+			if peer != nil {
+				peer.persistentKeepalive, _ = strconv.Atoi(value)
+			}
+		case "last_handshake_time_sec":
+			if peer != nil {
+				peer.lastHandshakeSec, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "last_handshake_time_nsec":
+			if peer != nil {
+				peer.lastHandshakeNsec, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "rx_bytes":
+			if peer != nil {
+				peer.rxBytes, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "tx_bytes":
+			if peer != nil {
+				peer.txBytes, _ = strconv.ParseInt(value, 10, 64)
+			}
+		case "allowed_ip":
+			if peer != nil {
+				peer.allowedIPs = append(peer.allowedIPs, value)
+			}
+		}
 	}
-	return string(result)
+	return row
 }
 
 // restore loads previous IPC state from DB and applies it to the device.
 func (pd *persistentDevice) restore() error {
-	var dump string
-	err := pd.db.QueryRow("SELECT dump FROM ipc_state WHERE id = 1").Scan(&dump)
+	var privateKey string
+	var listenPort, fwmark int
+	err := pd.db.QueryRow(
+		"SELECT private_key, listen_port, fwmark FROM devices WHERE id = ?", persistentDeviceID,
+	).Scan(&privateKey, &listenPort, &fwmark)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil // fresh DB, no state to restore
 	}
 	if err != nil {
-		return fmt.Errorf("read state: %w", err)
+		return fmt.Errorf("read device: %w", err)
 	}
-	if dump == "" {
-		return nil
+
+	peers, err := ListPeers(pd.db, persistentDeviceID)
+	if err != nil {
+		return fmt.Errorf("read peers: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "private_key=%s\n", privateKey)
+	if listenPort != 0 {
+		fmt.Fprintf(&b, "listen_port=%d\n", listenPort)
+	}
+	if fwmark != 0 {
+		fmt.Fprintf(&b, "fwmark=%d\n", fwmark)
+	}
+	for _, p := range peers {
+		fmt.Fprintf(&b, "public_key=%s\n", p.PublicKey)
+		if p.PresharedKey != "" {
+			fmt.Fprintf(&b, "preshared_key=%s\n", p.PresharedKey)
+		}
+		if p.Endpoint != "" {
+			fmt.Fprintf(&b, "endpoint=%s\n", p.Endpoint)
+		}
+		fmt.Fprintf(&b, "persistent_keepalive_interval=%d\n", p.PersistentKeepalive)
+		for _, cidr := range p.AllowedIPs {
+			fmt.Fprintf(&b, "allowed_ip=%s\n", cidr)
+		}
 	}
-	return pd.dev.IpcSet(dump)
+
+	return pd.dev.IpcSet(b.String())
 }
 
 // close shuts down the device and closes the state DB.
@@ -140,3 +381,151 @@ func (pd *persistentDevice) close() {
 	pd.dev.Close()
 	_ = pd.db.Close()
 }
+
+// addPeer configures pubkeyHex as a peer via a minimal IpcSet fragment —
+// just this one peer's lines, not a full device replace — then persists
+// the resulting state. allowedIPsCSV is a comma-separated CIDR list;
+// pskHex may be empty to leave the peer without a preshared key.
+func (pd *persistentDevice) addPeer(pubkeyHex, pskHex, endpoint string, keepalive int, allowedIPsCSV string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "public_key=%s\n", pubkeyHex)
+	if pskHex != "" {
+		fmt.Fprintf(&b, "preshared_key=%s\n", pskHex)
+	}
+	if endpoint != "" {
+		fmt.Fprintf(&b, "endpoint=%s\n", endpoint)
+	}
+	fmt.Fprintf(&b, "persistent_keepalive_interval=%d\n", keepalive)
+	for _, cidr := range strings.Split(allowedIPsCSV, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "allowed_ip=%s\n", cidr)
+	}
+	return pd.ipcSet(b.String())
+}
+
+// removePeer drops pubkeyHex via a minimal IpcSet fragment (remove=true,
+// the same mechanism multihop_failover.go's promoteMultihopPeer uses to
+// drop a failed candidate) then persists the resulting state.
+func (pd *persistentDevice) removePeer(pubkeyHex string) error {
+	return pd.ipcSet(fmt.Sprintf("public_key=%s\nremove=true\n", pubkeyHex))
+}
+
+// updatePeerEndpoint changes pubkeyHex's endpoint via a minimal IpcSet
+// fragment; IpcSet only touches fields present in the fragment it's given,
+// so the peer's preshared key, keepalive, and allowed-ips are untouched.
+func (pd *persistentDevice) updatePeerEndpoint(pubkeyHex, endpoint string) error {
+	return pd.ipcSet(fmt.Sprintf("public_key=%s\nendpoint=%s\n", pubkeyHex, endpoint))
+}
+
+// listPeers returns every peer persisted for this device.
+func (pd *persistentDevice) listPeers() ([]PeerRecord, error) {
+	return ListPeers(pd.db, persistentDeviceID)
+}
+
+// peerStats returns pubkeyHex's persisted record, or (nil, nil) if this
+// device has never persisted a peer under that key.
+func (pd *persistentDevice) peerStats(pubkeyHex string) (*PeerRecord, error) {
+	return GetPeerStats(pd.db, persistentDeviceID, pubkeyHex)
+}
+
+// PeerRecord is one persisted peer, as returned by ListPeers/GetPeerStats.
+type PeerRecord struct {
+	PublicKey           string   `json:"public_key"`
+	PresharedKey        string   `json:"preshared_key,omitempty"`
+	Endpoint            string   `json:"endpoint,omitempty"`
+	PersistentKeepalive int      `json:"persistent_keepalive"`
+	LastHandshakeSec    int64    `json:"last_handshake_sec"`
+	LastHandshakeNsec   int64    `json:"last_handshake_nsec"`
+	RxBytes             int64    `json:"rx_bytes"`
+	TxBytes             int64    `json:"tx_bytes"`
+	AllowedIPs          []string `json:"allowed_ips,omitempty"`
+}
+
+// ListPeers returns every peer persisted under deviceID, in insertion
+// order, reading straight from the peers/allowed_ips tables rather than a
+// live device's IpcGet — a dashboard can call this against the state DB
+// file with no running device or UAPI socket involved at all.
+func ListPeers(db *sql.DB, deviceID int64) ([]PeerRecord, error) {
+	rows, err := db.Query(
+		`SELECT id, public_key, preshared_key, endpoint, persistent_keepalive,
+			last_handshake_sec, last_handshake_nsec, rx_bytes, tx_bytes
+		FROM peers WHERE device_id = ? ORDER BY id`, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("query peers: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var out []PeerRecord
+	for rows.Next() {
+		var id int64
+		var rec PeerRecord
+		if err := rows.Scan(&id, &rec.PublicKey, &rec.PresharedKey, &rec.Endpoint,
+			&rec.PersistentKeepalive, &rec.LastHandshakeSec, &rec.LastHandshakeNsec,
+			&rec.RxBytes, &rec.TxBytes); err != nil {
+			return nil, fmt.Errorf("scan peer: %w", err)
+		}
+		ids = append(ids, id)
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, id := range ids {
+		ips, err := allowedIPsForPeer(db, id)
+		if err != nil {
+			return nil, err
+		}
+		out[i].AllowedIPs = ips
+	}
+	return out, nil
+}
+
+// GetPeerStats returns pubkey's persisted record under deviceID, or
+// (nil, nil) if no such peer has ever been persisted.
+func GetPeerStats(db *sql.DB, deviceID int64, pubkey string) (*PeerRecord, error) {
+	var id int64
+	rec := PeerRecord{PublicKey: pubkey}
+	err := db.QueryRow(
+		`SELECT id, preshared_key, endpoint, persistent_keepalive,
+			last_handshake_sec, last_handshake_nsec, rx_bytes, tx_bytes
+		FROM peers WHERE device_id = ? AND public_key = ?`, deviceID, pubkey,
+	).Scan(&id, &rec.PresharedKey, &rec.Endpoint, &rec.PersistentKeepalive,
+		&rec.LastHandshakeSec, &rec.LastHandshakeNsec, &rec.RxBytes, &rec.TxBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query peer: %w", err)
+	}
+
+	ips, err := allowedIPsForPeer(db, id)
+	if err != nil {
+		return nil, err
+	}
+	rec.AllowedIPs = ips
+	return &rec, nil
+}
+
+// allowedIPsForPeer returns peerID's allowed-ips, sorted for stable output.
+func allowedIPsForPeer(db *sql.DB, peerID int64) ([]string, error) {
+	rows, err := db.Query("SELECT cidr FROM allowed_ips WHERE peer_id = ? ORDER BY cidr", peerID)
+	if err != nil {
+		return nil, fmt.Errorf("query allowed ips: %w", err)
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var cidr string
+		if err := rows.Scan(&cidr); err != nil {
+			return nil, fmt.Errorf("scan allowed ip: %w", err)
+		}
+		ips = append(ips, cidr)
+	}
+	return ips, rows.Err()
+}